@@ -0,0 +1,247 @@
+package scenario
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// CleanupMode defines how tracked messages are deleted when the user leaves a scene.
+type CleanupMode int
+
+const (
+	// CleanupNone doesn't track messages.
+	CleanupNone CleanupMode = iota
+	// CleanupEach deletes messages one by one.
+	CleanupEach
+	// CleanupBulk deletes messages with deleteMessages, up to 100 at once.
+	CleanupBulk
+)
+
+// deleteBatch is the maximum number of messages deleteMessages accepts.
+const deleteBatch = 100
+
+// CleanupPolicy defines which messages of a scene are removed on leave.
+// Messages sent with Context Send, Reply and SendAlbum are tracked while the policy
+// has a mode; other messages can be tracked with Context.Track.
+type CleanupPolicy struct {
+	Mode CleanupMode
+	// UserMessages also tracks messages of the user.
+	UserMessages bool
+	// KeepLast keeps the last tracked messages, e.g. a final summary.
+	KeepLast int
+	// RemoveKeyboard removes a reply keyboard sent in the scene.
+	RemoveKeyboard bool
+	// Unpin unpins messages pinned with Context.Pin.
+	Unpin bool
+}
+
+func (p CleanupPolicy) enabled() bool {
+	return p.Mode != CleanupNone || p.RemoveKeyboard || p.Unpin
+}
+
+// CleanupScene is implemented by scenes with their own cleanup policy.
+// A nil policy falls back to Scenario.WithCleanup.
+type CleanupScene interface {
+	Scene
+	CleanupPolicy() *CleanupPolicy
+}
+
+// WithCleanup sets the cleanup policy of scenes that don't set their own.
+func (s *Scenario) WithCleanup(policy CleanupPolicy) *Scenario {
+	s.cleanupPolicy = policy
+	return s
+}
+
+func (s *Scenario) cleanupOf(scene SceneName) CleanupPolicy {
+	if scene == "" {
+		return CleanupPolicy{}
+	}
+	sc, _ := s.scene(scene)
+	if cs, ok := sc.(CleanupScene); ok {
+		if policy := cs.CleanupPolicy(); policy != nil {
+			return *policy
+		}
+	}
+	return s.cleanupPolicy
+}
+
+// Send sends a message to the current recipient and tracks it for cleanup.
+func (c *Context[T]) Send(what any, opts ...any) error {
+	if !c.tracking() {
+		return c.Context.Send(what, opts...)
+	}
+	m, err := c.Bot().Send(c.Recipient(), what, opts...)
+	if err != nil {
+		return err
+	}
+	c.trackSent(opts, m)
+	return nil
+}
+
+// Reply replies to the current message and tracks the reply for cleanup.
+func (c *Context[T]) Reply(what any, opts ...any) error {
+	msg := c.Message()
+	if !c.tracking() || msg == nil {
+		return c.Context.Reply(what, opts...)
+	}
+	m, err := c.Bot().Reply(msg, what, opts...)
+	if err != nil {
+		return err
+	}
+	c.trackSent(opts, m)
+	return nil
+}
+
+// SendAlbum sends an album to the current recipient and tracks it for cleanup.
+func (c *Context[T]) SendAlbum(a tele.Album, opts ...any) error {
+	if !c.tracking() {
+		return c.Context.SendAlbum(a, opts...)
+	}
+	msgs, err := c.Bot().SendAlbum(c.Recipient(), a, opts...)
+	if err != nil {
+		return err
+	}
+	ptrs := make([]*tele.Message, len(msgs))
+	for i := range msgs {
+		ptrs[i] = &msgs[i]
+	}
+	c.trackSent(opts, ptrs...)
+	return nil
+}
+
+// Track adds messages to be deleted when the user leaves the scene.
+func (c *Context[T]) Track(msgs ...*tele.Message) {
+	meta := c.meta()
+	for _, m := range msgs {
+		if m != nil && !slices.Contains(meta.Messages, m.ID) {
+			meta.Messages = append(meta.Messages, m.ID)
+		}
+	}
+	c.setMeta(meta)
+}
+
+// Untrack keeps messages in the chat on leave.
+func (c *Context[T]) Untrack(msgs ...*tele.Message) {
+	meta := c.meta()
+	meta.Messages = slices.DeleteFunc(meta.Messages, func(id int) bool {
+		return slices.ContainsFunc(msgs, func(m *tele.Message) bool { return m != nil && m.ID == id })
+	})
+	c.setMeta(meta)
+}
+
+// Pin pins a message; it's unpinned on leave if the cleanup policy says so.
+func (c *Context[T]) Pin(m *tele.Message, opts ...any) error {
+	if err := c.Bot().Pin(m, opts...); err != nil {
+		return err
+	}
+	meta := c.meta()
+	if !slices.Contains(meta.Pinned, m.ID) {
+		meta.Pinned = append(meta.Pinned, m.ID)
+		c.setMeta(meta)
+	}
+	return nil
+}
+
+func (c *Context[T]) tracking() bool {
+	return c.Scenario.cleanupOf(c.Session.Scene).enabled()
+}
+
+func (c *Context[T]) trackSent(opts []any, msgs ...*tele.Message) {
+	c.Track(msgs...)
+	if hasReplyKeyboard(opts) {
+		meta := c.meta()
+		meta.Keyboard = true
+		c.setMeta(meta)
+	}
+}
+
+// trackUpdate tracks the message of the user if the policy asks for it.
+func (c *Context[T]) trackUpdate() {
+	if !c.Scenario.cleanupOf(c.Session.Scene).UserMessages || c.Callback() != nil {
+		return
+	}
+	c.Track(c.Message())
+}
+
+// cleanupMessages removes messages tracked in base according to the policy of scene
+// and clears them from base. Failures are logged, messages may be too old to delete.
+func (s *Scenario) cleanupMessages(ctx context.Context, scene SceneName, base *SessionBase) {
+	meta := decodeMeta(base.Meta)
+	policy := s.cleanupOf(scene)
+	messages, pinned, keyboard := meta.Messages, meta.Pinned, meta.Keyboard
+	meta.Messages, meta.Pinned, meta.Keyboard = nil, nil, false
+	meta.Anchor, meta.AnchorAt = 0, 0 // the next scene renders its own anchor
+	base.Meta = encodeMeta(meta)
+
+	mode := policy.Mode
+	switch {
+	case mode == CleanupNone:
+		// only the keyboard removal message below is deleted
+		messages, mode = nil, CleanupEach
+	case policy.KeepLast > 0:
+		messages = messages[:max(len(messages)-policy.KeepLast, 0)]
+	}
+
+	chat := &tele.Chat{ID: base.ChatID}
+	if policy.Unpin {
+		for _, id := range pinned {
+			if err := s.bot.Unpin(chat, id); err != nil {
+				slog.ErrorContext(ctx, "failed to unpin message", "message", id, "error", err)
+			}
+		}
+	}
+	if policy.RemoveKeyboard && keyboard {
+		if m, err := s.bot.Send(chat, "…", &tele.ReplyMarkup{RemoveKeyboard: true}); err != nil {
+			slog.ErrorContext(ctx, "failed to remove keyboard", "error", err)
+		} else {
+			// the removal message itself isn't needed once the keyboard is gone
+			messages = append(messages, m.ID)
+		}
+	}
+	s.deleteMessages(ctx, mode, base.ChatID, messages)
+}
+
+func (s *Scenario) deleteMessages(ctx context.Context, mode CleanupMode, chatID int64, ids []int) {
+	edit := func(id int) tele.Editable {
+		return tele.StoredMessage{MessageID: strconv.Itoa(id), ChatID: chatID}
+	}
+
+	switch mode {
+	case CleanupEach:
+		for _, id := range ids {
+			if err := s.bot.Delete(edit(id)); err != nil {
+				slog.ErrorContext(ctx, "failed to delete message", "message", id, "error", err)
+			}
+		}
+	case CleanupBulk:
+		for batch := range slices.Chunk(ids, deleteBatch) {
+			msgs := make([]tele.Editable, len(batch))
+			for i, id := range batch {
+				msgs[i] = edit(id)
+			}
+			if err := s.bot.DeleteMany(msgs); err != nil {
+				slog.ErrorContext(ctx, "failed to delete messages", "count", len(msgs), "error", err)
+			}
+		}
+	}
+}
+
+func hasReplyKeyboard(opts []any) bool {
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *tele.ReplyMarkup:
+			if o != nil && len(o.ReplyKeyboard) > 0 {
+				return true
+			}
+		case *tele.SendOptions:
+			if o != nil && o.ReplyMarkup != nil && len(o.ReplyMarkup.ReplyKeyboard) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package scenario_test
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+func newSurveyBot(t *testing.T, policy scenario.CleanupPolicy) (*scenariotest.Bot, *scenario.Scenario) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	yesNo := &tele.ReplyMarkup{ResizeKeyboard: true}
+	yesNo.Reply(yesNo.Row(yesNo.Text("Да"), yesNo.Text("Нет")))
+
+	scn.Use(scenario.NewWizard[userData]("survey",
+		func(c *scenario.Context[userData]) (bool, error) {
+			return true, c.Send("Имя?")
+		},
+		func(c *scenario.Context[userData]) (bool, error) {
+			c.SetData(userData{Name: c.Text()})
+			return true, c.Send("Подписаться на новости?", yesNo)
+		},
+		func(c *scenario.Context[userData]) (bool, error) {
+			return true, c.Send("Готово, " + c.GetData().Name)
+		},
+	).WithCleanup(policy))
+
+	bot.Handle("/survey", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[userData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("survey")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	return bot, scn
+}
+
+func callsOf(bot *scenariotest.Bot, method string) []scenariotest.Call {
+	var calls []scenariotest.Call
+	for _, call := range bot.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func TestCleanupBulk(t *testing.T) {
+	bot, scn := newSurveyBot(t, scenario.CleanupPolicy{
+		Mode:           scenario.CleanupBulk,
+		UserMessages:   true,
+		KeepLast:       1,
+		RemoveKeyboard: true,
+	})
+
+	conv := bot.Conversation(scn).
+		Send("/survey").ExpectReply("Имя?").
+		Send("Bob").ExpectReply("Подписаться на новости?").
+		Send("Да").ExpectReply("Готово, Bob").
+		ExpectScene("")
+
+	sent := map[string]string{}
+	for _, call := range bot.Calls() {
+		if call.IsMessage() {
+			sent[call.Text()] = strconv.Itoa(call.MessageID)
+		}
+	}
+
+	deletes := callsOf(bot, "deleteMessages")
+	require.Len(t, deletes, 1)
+	var ids []string
+	require.NoError(t, json.Unmarshal([]byte(deletes[0].Params["message_ids"]), &ids))
+	// the summary is kept, the keyboard removal message is deleted as well
+	assert.Subset(t, ids, []string{sent["Имя?"], sent["Подписаться на новости?"], sent["…"]})
+	assert.NotContains(t, ids, sent["Готово, Bob"])
+	assert.Len(t, ids, 5, "two user answers are deleted too")
+
+	removal := callsOf(bot, "sendMessage")
+	assert.True(t, removal[len(removal)-1].ReplyMarkup().RemoveKeyboard)
+	assert.Nil(t, scenariotest.Session[userData](conv).Meta)
+}
+
+func TestCleanupEach(t *testing.T) {
+	bot, scn := newSurveyBot(t, scenario.CleanupPolicy{Mode: scenario.CleanupEach})
+
+	bot.Conversation(scn).
+		Send("/survey").ExpectReply("Имя?").
+		Send("Bob").ExpectReply("Подписаться на новости?").
+		Send("Да").ExpectReply("Готово, Bob")
+
+	assert.Len(t, callsOf(bot, "deleteMessage"), 3)
+	assert.Empty(t, callsOf(bot, "deleteMessages"))
+}
+
+func TestCleanupNone(t *testing.T) {
+	bot, scn := newSurveyBot(t, scenario.CleanupPolicy{})
+
+	bot.Conversation(scn).
+		Send("/survey").ExpectReply("Имя?").
+		Send("Bob").ExpectReply("Подписаться на новости?").
+		Send("Да").ExpectReply("Готово, Bob")
+
+	assert.Empty(t, callsOf(bot, "deleteMessage"))
+	assert.Empty(t, callsOf(bot, "deleteMessages"))
+}
+
+func TestCleanupUnpin(t *testing.T) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot).WithCleanup(scenario.CleanupPolicy{Unpin: true})
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[userData]("order",
+		func(c *scenario.Context[userData]) (bool, error) {
+			m, err := c.Bot().Send(c.Recipient(), "Заказ #1")
+			if err != nil {
+				return false, err
+			}
+			return true, c.Pin(m)
+		},
+		func(c *scenario.Context[userData]) (bool, error) {
+			return true, nil
+		},
+	))
+	bot.Handle("/order", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[userData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("order")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+
+	bot.Conversation(scn).
+		Send("/order").ExpectReply("Заказ #1").
+		Send("ok").ExpectScene("")
+
+	pinned := callsOf(bot, "pinChatMessage")
+	require.Len(t, pinned, 1)
+	unpinned := callsOf(bot, "unpinChatMessage")
+	require.Len(t, unpinned, 1)
+	assert.Equal(t, pinned[0].Params["message_id"], unpinned[0].Params["message_id"])
+}
@@ -0,0 +1,192 @@
+package scenario
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ErrUnknownCodec is returned when no codec is registered under the requested name.
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// Codec serializes session data.
+// Codec name is stored with every session, so rows written with different codecs
+// keep decoding after the codec is switched.
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSONCodec encodes data with encoding/json. It is the default codec.
+	JSONCodec Codec = jsonCodec{}
+	// MsgpackCodec encodes data with MessagePack. It keeps int64 precision for values stored in any
+	// and honours json struct tags, so field names match JSONCodec.
+	MsgpackCodec Codec = msgpackCodec{}
+	// GobCodec encodes data with encoding/gob. Types stored in interfaces must be registered with gob.Register.
+	// Its data can't be upgraded by UpgradeFunc, Scenario.Validate reports scenes with upgrades.
+	GobCodec Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// codecSet holds the codec used for writing and all codecs known for reading.
+// A nil *codecSet behaves as JSON only.
+type codecSet struct {
+	current Codec
+	byName  map[string]Codec
+}
+
+func newCodecSet() *codecSet {
+	set := &codecSet{
+		current: JSONCodec,
+		byName:  make(map[string]Codec),
+	}
+	for _, codec := range []Codec{JSONCodec, MsgpackCodec, GobCodec} {
+		set.byName[codec.Name()] = codec
+	}
+	return set
+}
+
+func (c *codecSet) register(codec Codec) {
+	c.byName[codec.Name()] = codec
+}
+
+// encode marshals v with the current codec.
+func (c *codecSet) encode(v any) (string, json.RawMessage, error) {
+	if c == nil {
+		return c.encodeWith("", v)
+	}
+	return c.encodeWith(c.current.Name(), v)
+}
+
+// encodeWith marshals v with the named codec.
+// Binary codecs are wrapped into a base64 JSON string, so Data always stays valid JSON.
+func (c *codecSet) encodeWith(name string, v any) (string, json.RawMessage, error) {
+	codec, err := c.lookup(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s.Marshal: %w", codec.Name(), err)
+	}
+	if codec.Name() == JSONCodec.Name() {
+		return codec.Name(), data, nil
+	}
+
+	wrapped, err := json.Marshal(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+	return codec.Name(), wrapped, nil
+}
+
+// decode unmarshals data written by the named codec into v.
+func (c *codecSet) decode(name string, data json.RawMessage, v any) error {
+	codec, err := c.lookup(name)
+	if err != nil {
+		return err
+	}
+	if codec.Name() == JSONCodec.Name() {
+		if err = json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("json.Unmarshal: %w", err)
+		}
+		return nil
+	}
+
+	var raw []byte
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	if err = codec.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%s.Unmarshal: %w", codec.Name(), err)
+	}
+	return nil
+}
+
+// decodeMap unmarshals data written by the named codec into a generic map for upgrades.
+func (c *codecSet) decodeMap(name string, data json.RawMessage) (map[string]any, error) {
+	var m map[string]any
+	codec, err := c.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	switch codec.Name() {
+	case GobCodec.Name():
+		return nil, fmt.Errorf("%s data can't be decoded into a map", codec.Name())
+	case JSONCodec.Name():
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err = dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %w", err)
+		}
+		return m, nil
+	}
+	if err = c.decode(name, data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// lookup returns the named codec. Empty name means JSON,
+// as written before codecs were introduced.
+func (c *codecSet) lookup(name string) (Codec, error) {
+	if name == "" || name == JSONCodec.Name() {
+		return JSONCodec, nil
+	}
+	if c != nil {
+		if codec, ok := c.byName[name]; ok {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+}
@@ -0,0 +1,96 @@
+package scenario
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	type UserData struct {
+		Name     string
+		Birthday time.Time
+		Score    int64
+	}
+
+	data := UserData{
+		Name:     "Bob",
+		Birthday: time.Date(1990, 5, 1, 10, 0, 0, 0, time.FixedZone("MSK", 3*60*60)),
+		Score:    1<<62 + 1,
+	}
+
+	for _, codec := range []Codec{JSONCodec, MsgpackCodec, GobCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			scenario := New(nil).WithCodec(codec)
+
+			sess := &Session[UserData]{ChatID: 1, UserID: 2, Data: data}
+			base, err := sess.toBase(scenario.codecs)
+			require.NoError(t, err)
+			assert.Equal(t, codec.Name(), base.Codec)
+			assert.True(t, json.Valid(base.Data), "data must stay valid JSON")
+
+			decoded, err := fromBase[UserData](base, scenario.codecs)
+			require.NoError(t, err)
+			assert.Equal(t, data.Name, decoded.Data.Name)
+			assert.Equal(t, data.Score, decoded.Data.Score)
+			assert.True(t, data.Birthday.Equal(decoded.Data.Birthday))
+		})
+	}
+}
+
+func TestCodecMsgpackKeepsInt64InAny(t *testing.T) {
+	scenario := New(nil).WithCodec(MsgpackCodec)
+
+	sess := &Session[map[string]any]{Data: map[string]any{"id": int64(1<<62 + 1)}}
+	base, err := sess.toBase(scenario.codecs)
+	require.NoError(t, err)
+
+	decoded, err := fromBase[map[string]any](base, scenario.codecs)
+	require.NoError(t, err)
+	assert.EqualValues(t, int64(1<<62+1), decoded.Data["id"])
+}
+
+func TestCodecMixedRows(t *testing.T) {
+	type UserData struct {
+		Name string
+	}
+
+	writer := New(nil).WithCodec(MsgpackCodec)
+	base, err := (&Session[UserData]{Data: UserData{Name: "Alice"}}).toBase(writer.codecs)
+	require.NoError(t, err)
+
+	// reader writes JSON but still decodes rows written with msgpack
+	reader := New(nil)
+	decoded, err := fromBase[UserData](base, reader.codecs)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", decoded.Data.Name)
+
+	// rows written before codecs were introduced have no codec name
+	legacy := &SessionBase{Data: []byte(`{"Name":"Bob"}`)}
+	decoded, err = fromBase[UserData](legacy, reader.codecs)
+	require.NoError(t, err)
+	assert.Equal(t, "Bob", decoded.Data.Name)
+}
+
+type upperCodec struct{ jsonCodec }
+
+func (upperCodec) Name() string { return "custom" }
+
+func TestCodecUnknown(t *testing.T) {
+	type UserData struct{ Name string }
+
+	writer := New(nil).WithCodec(upperCodec{})
+	base, err := (&Session[UserData]{Data: UserData{Name: "Bob"}}).toBase(writer.codecs)
+	require.NoError(t, err)
+	assert.Equal(t, "custom", base.Codec)
+
+	_, err = fromBase[UserData](base, New(nil).codecs)
+	assert.ErrorIs(t, err, ErrUnknownCodec)
+
+	decoded, err := fromBase[UserData](base, New(nil).RegisterCodec(upperCodec{}).codecs)
+	require.NoError(t, err)
+	assert.Equal(t, "Bob", decoded.Data.Name)
+}
@@ -14,47 +14,66 @@ import (
 
 // SessionBase is the base session structure used for storage.
 // It stores Data as json.RawMessage to allow deserialization into different types.
+// Codec is the name of the codec Data was encoded with; data of binary codecs
+// is stored as a base64 JSON string. DataVersion is the scene data schema version.
+// State is the current state of an FSMScene, which doesn't use Step.
+// SceneData keeps data of inactive scenes when scene namespaces are enabled.
+// Meta is state of the library itself, such as tracked messages.
 type SessionBase struct {
-	ChatID    int64           `json:"chat_id" db:"chat_id"`
-	UserID    int64           `json:"user_id" db:"user_id"`
-	Scene     SceneName       `json:"scene" db:"scene"`
-	Step      int             `json:"step" db:"step"`
-	Data      json.RawMessage `json:"data" db:"data"`
-	UpdatedAt time.Time       `json:"updated_at" db:"updated_at"`
+	ChatID      int64           `json:"chat_id" db:"chat_id"`
+	UserID      int64           `json:"user_id" db:"user_id"`
+	Scene       SceneName       `json:"scene" db:"scene"`
+	Step        int             `json:"step" db:"step"`
+	State       string          `json:"state,omitempty" db:"state"`
+	Data        json.RawMessage `json:"data" db:"data"`
+	Codec       string          `json:"codec,omitempty" db:"codec"`
+	DataVersion int             `json:"data_version,omitempty" db:"data_version"`
+	SceneData   json.RawMessage `json:"scene_data,omitempty" db:"scene_data"`
+	Meta        json.RawMessage `json:"meta,omitempty" db:"meta"`
+	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
 }
 
 // Session is per-user (and optionally per-chat) state persisted between updates.
 // T is the type of data stored in this session.
 type Session[T any] struct {
-	ChatID    int64     `json:"chat_id" db:"chat_id"`
-	UserID    int64     `json:"user_id" db:"user_id"`
-	Scene     SceneName `json:"scene" db:"scene"`
-	Step      int       `json:"step" db:"step"`
-	Data      T         `json:"data" db:"data"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ChatID      int64           `json:"chat_id" db:"chat_id"`
+	UserID      int64           `json:"user_id" db:"user_id"`
+	Scene       SceneName       `json:"scene" db:"scene"`
+	Step        int             `json:"step" db:"step"`
+	State       string          `json:"state,omitempty" db:"state"`
+	Data        T               `json:"data" db:"data"`
+	DataVersion int             `json:"data_version" db:"data_version"`
+	SceneData   json.RawMessage `json:"scene_data,omitempty" db:"scene_data"`
+	Meta        json.RawMessage `json:"meta,omitempty" db:"meta"`
+	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
 }
 
 // toBase converts Session[T] to SessionBase for storage.
-func (s *Session[T]) toBase() (*SessionBase, error) {
-	data, err := json.Marshal(s.Data)
+func (s *Session[T]) toBase(codecs *codecSet) (*SessionBase, error) {
+	codec, data, err := codecs.encode(s.Data)
 	if err != nil {
-		return nil, fmt.Errorf("json.Marshal: %w", err)
+		return nil, err
 	}
 	now := time.Now()
 	return &SessionBase{
-		ChatID:    s.ChatID,
-		UserID:    s.UserID,
-		Scene:     s.Scene,
-		Step:      s.Step,
-		Data:      data,
-		UpdatedAt: now,
+		ChatID:      s.ChatID,
+		UserID:      s.UserID,
+		Scene:       s.Scene,
+		Step:        s.Step,
+		State:       s.State,
+		Data:        data,
+		Codec:       codec,
+		DataVersion: s.DataVersion,
+		SceneData:   s.SceneData,
+		Meta:        s.Meta,
+		UpdatedAt:   now,
 	}, nil
 }
 
 var nullBytes = []byte("null")
 
 // fromBase creates Session[T] from SessionBase by deserializing Data.
-func fromBase[T any](base *SessionBase) (*Session[T], error) {
+func fromBase[T any](base *SessionBase, codecs *codecSet) (*Session[T], error) {
 	if base == nil {
 		base = &SessionBase{}
 	}
@@ -63,19 +82,23 @@ func fromBase[T any](base *SessionBase) (*Session[T], error) {
 	if len(base.Data) > 0 {
 		// Optimized check: use bytes.Equal to avoid string conversion
 		if !bytes.Equal(base.Data, nullBytes) {
-			if err := json.Unmarshal(base.Data, &data); err != nil {
-				return nil, fmt.Errorf("json.Unmarshal: %w", err)
+			if err := codecs.decode(base.Codec, base.Data, &data); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrDataDecode, err)
 			}
 		}
 	}
 
 	return &Session[T]{
-		ChatID:    base.ChatID,
-		UserID:    base.UserID,
-		Scene:     base.Scene,
-		Step:      base.Step,
-		Data:      data,
-		UpdatedAt: base.UpdatedAt,
+		ChatID:      base.ChatID,
+		UserID:      base.UserID,
+		Scene:       base.Scene,
+		Step:        base.Step,
+		State:       base.State,
+		Data:        data,
+		DataVersion: base.DataVersion,
+		SceneData:   base.SceneData,
+		Meta:        base.Meta,
+		UpdatedAt:   base.UpdatedAt,
 	}, nil
 }
 
@@ -100,6 +123,9 @@ type ContextBase interface {
 	isDirty() bool
 	markDirty()
 	clearDirty()
+	trackUpdate()
+	teleContext() tele.Context
+	detach()
 }
 
 // Context wraps tele.Context and carries scene/session helpers.
@@ -112,6 +138,7 @@ type Context[T any] struct {
 	cachedBase *SessionBase // cached SessionBase to avoid repeated conversions
 	chatID     int64        // cached chatID to avoid repeated lookups
 	userID     int64        // cached userID to avoid repeated lookups
+	detached   bool         // the session moved to a scene with another data type
 }
 
 func (c *Context[T]) getScenario() *Scenario {
@@ -119,12 +146,15 @@ func (c *Context[T]) getScenario() *Scenario {
 }
 
 func (c *Context[T]) getSessionBase() (*SessionBase, error) {
+	if c.detached {
+		return nil, ErrContextDetached
+	}
 	// Use cached base if available and not dirty
 	if c.cachedBase != nil && !c.dirty {
 		return c.cachedBase, nil
 	}
 
-	base, err := c.Session.toBase()
+	base, err := c.Session.toBase(c.Scenario.codecs)
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +163,7 @@ func (c *Context[T]) getSessionBase() (*SessionBase, error) {
 }
 
 func (c *Context[T]) setSessionBase(base *SessionBase) error {
-	sess, err := fromBase[T](base)
+	sess, err := fromBase[T](base, c.Scenario.codecs)
 	if err != nil {
 		return err
 	}
@@ -144,7 +174,7 @@ func (c *Context[T]) setSessionBase(base *SessionBase) error {
 }
 
 func (c *Context[T]) isDirty() bool {
-	return c.dirty
+	return c.dirty && !c.detached
 }
 
 func (c *Context[T]) markDirty() {
@@ -156,6 +186,18 @@ func (c *Context[T]) clearDirty() {
 	c.dirty = false
 }
 
+func (c *Context[T]) teleContext() tele.Context {
+	return c.Context
+}
+
+// detach stops saving the context, the session is handled by the context
+// of a scene with another data type from now on.
+func (c *Context[T]) detach() {
+	c.detached = true
+	c.dirty = false
+	c.cachedBase = nil
+}
+
 func newCtx[T any](scenario *Scenario, c tele.Context, sess *Session[T]) *Context[T] {
 	cid, uid := getChatUserIDs(c)
 	sess.ChatID = cid
@@ -190,7 +232,7 @@ func NewContext[T any](scenario *Scenario, c tele.Context) (*Context[T], error)
 		}
 	}
 
-	sess, err := fromBase[T](base)
+	sess, err := fromBase[T](base, scenario.codecs)
 	if err != nil {
 		return nil, fmt.Errorf("fromBase: %w", err)
 	}
@@ -198,7 +240,24 @@ func NewContext[T any](scenario *Scenario, c tele.Context) (*Context[T], error)
 	return newCtx(scenario, c, sess), nil
 }
 
-// Enter helpers
+// GetSession loads the session of userID in chatID and decodes its data into T,
+// upgrading it with the data schema of the active scene if it declares one.
+func GetSession[T any](ctx context.Context, scenario *Scenario, chatID, userID int64) (*Session[T], error) {
+	base, err := scenario.store.GetSession(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema *DataSchema
+	sc, _ := scenario.scene(base.Scene)
+	if vs, ok := sc.(VersionedScene); ok {
+		schema = vs.DataSchema()
+	}
+	return decodeSession[T](scenario.codecs, base, schema)
+}
+
+// Enter enters scene. If the scene stores another type of data, c is detached
+// from the session afterwards: changes made through it are no longer saved.
 func (c *Context[T]) Enter(scene SceneName) error {
 	return c.Scenario.enter(c, scene)
 }
@@ -210,7 +269,7 @@ func (c *Context[T]) Reenter() error {
 
 // Leave .
 func (c *Context[T]) Leave() error {
-	err := c.Scenario.leave(c)
+	err := c.Scenario.leave(c, ReasonLeave)
 	if err != nil {
 		return fmt.Errorf("c.Scenario.leave: %w", err)
 	}
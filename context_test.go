@@ -28,7 +28,7 @@ func TestSessionToBase(t *testing.T) {
 		UpdatedAt: time.Now(),
 	}
 
-	base, err := sess.toBase()
+	base, err := sess.toBase(nil)
 	require.NoError(t, err)
 	assert.Equal(t, int64(123), base.ChatID)
 	assert.Equal(t, int64(456), base.UserID)
@@ -61,7 +61,7 @@ func TestFromBase(t *testing.T) {
 			UpdatedAt: time.Now(),
 		}
 
-		sess, err := fromBase[UserData](base)
+		sess, err := fromBase[UserData](base, nil)
 		require.NoError(t, err)
 		assert.Equal(t, int64(789), sess.ChatID)
 		assert.Equal(t, int64(101), sess.UserID)
@@ -78,7 +78,7 @@ func TestFromBase(t *testing.T) {
 			Data:   []byte("null"),
 		}
 
-		sess, err := fromBase[UserData](base)
+		sess, err := fromBase[UserData](base, nil)
 		require.NoError(t, err)
 		assert.Equal(t, UserData{}, sess.Data)
 	})
@@ -90,13 +90,13 @@ func TestFromBase(t *testing.T) {
 			Data:   []byte("{}"),
 		}
 
-		sess, err := fromBase[UserData](base)
+		sess, err := fromBase[UserData](base, nil)
 		require.NoError(t, err)
 		assert.Equal(t, UserData{}, sess.Data)
 	})
 
 	t.Run("nil base", func(t *testing.T) {
-		sess, err := fromBase[UserData](nil)
+		sess, err := fromBase[UserData](nil, nil)
 		require.NoError(t, err)
 		assert.NotNil(t, sess)
 		assert.Equal(t, UserData{}, sess.Data)
@@ -0,0 +1,590 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tele "gopkg.in/telebot.v3"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidDefinition is returned when a scene definition document is malformed.
+var ErrInvalidDefinition = errors.New("invalid scene definition")
+
+// Answer types of declarative questions.
+const (
+	AnswerText    = "text"
+	AnswerNumber  = "number"
+	AnswerChoice  = "choice"
+	AnswerContact = "contact"
+)
+
+// EndQuestion is a branch target that completes the scene.
+const EndQuestion = "end"
+
+// questionKey is the data key holding the id of the question the user was asked last.
+const questionKey = "_question"
+
+// ScenesDefinition is a YAML or JSON document with declarative scenes.
+//
+//	scenes:
+//	  - name: survey
+//	    command: /survey
+//	    questions:
+//	      - id: name
+//	        prompt: Как вас зовут?
+//	        validate: {min_length: 2}
+//	      - id: adult
+//	        prompt: Вам есть 18?
+//	        type: choice
+//	        options: [{text: Да, value: "yes"}, {text: Нет, value: "no"}]
+//	        next: [{when: "no", goto: end}]
+//	      - id: age
+//	        prompt: Сколько вам лет?
+//	        type: number
+//	        validate: {min: 18, max: 120}
+//	    final: Спасибо, {name}!
+type ScenesDefinition struct {
+	Scenes []SceneDefinition `yaml:"scenes" json:"scenes"`
+}
+
+// SceneDefinition describes a questionnaire scene.
+type SceneDefinition struct {
+	Name SceneName `yaml:"name" json:"name"`
+	// Command enters the scene, e.g. "/survey".
+	Command   string               `yaml:"command,omitempty" json:"command,omitempty"`
+	Questions []QuestionDefinition `yaml:"questions" json:"questions"`
+	// Final is sent on completion, {id} is replaced by the answer to question id.
+	Final string `yaml:"final,omitempty" json:"final,omitempty"`
+}
+
+// QuestionDefinition describes a single question.
+type QuestionDefinition struct {
+	ID     string `yaml:"id" json:"id"`
+	Prompt string `yaml:"prompt" json:"prompt"`
+	// Type is one of AnswerText (default), AnswerNumber, AnswerChoice, AnswerContact.
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// Keyboard is a reply keyboard shown with the prompt.
+	Keyboard [][]string `yaml:"keyboard,omitempty" json:"keyboard,omitempty"`
+	// Options of an AnswerChoice question, shown as an inline keyboard.
+	Options  []OptionDefinition `yaml:"options,omitempty" json:"options,omitempty"`
+	Validate *RulesDefinition   `yaml:"validate,omitempty" json:"validate,omitempty"`
+	// Error is sent when the answer doesn't pass validation.
+	Error string `yaml:"error,omitempty" json:"error,omitempty"`
+	// Next lists branches checked in order; without a match the next question is asked.
+	Next []BranchDefinition `yaml:"next,omitempty" json:"next,omitempty"`
+}
+
+// OptionDefinition is a choice option; Value defaults to Text.
+type OptionDefinition struct {
+	Text  string `yaml:"text" json:"text"`
+	Value string `yaml:"value,omitempty" json:"value,omitempty"`
+}
+
+// RulesDefinition holds answer validation rules.
+type RulesDefinition struct {
+	MinLength int      `yaml:"min_length,omitempty" json:"min_length,omitempty"`
+	MaxLength int      `yaml:"max_length,omitempty" json:"max_length,omitempty"`
+	Pattern   string   `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	Min       *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	Max       *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+}
+
+// BranchDefinition jumps to Goto when the answer equals When; empty When always matches.
+type BranchDefinition struct {
+	When string `yaml:"when,omitempty" json:"when,omitempty"`
+	Goto string `yaml:"goto" json:"goto"`
+}
+
+// ParseScenes reads a YAML or JSON document and validates it.
+// Unknown fields are rejected, so typos are reported at load time.
+func ParseScenes(r io.Reader) (*ScenesDefinition, error) {
+	var def ScenesDefinition
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&def); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDefinition, err)
+	}
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &def, nil
+}
+
+// Validate checks names, question ids, types, rules and branch targets.
+func (d *ScenesDefinition) Validate() error {
+	var errs []error
+	fail := func(path, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s: %s", ErrInvalidDefinition, path, fmt.Sprintf(format, args...)))
+	}
+
+	names := make(map[SceneName]bool)
+	commands := make(map[string]bool)
+	for i, sc := range d.Scenes {
+		path := fmt.Sprintf("scenes[%d]", i)
+		switch {
+		case sc.Name == "":
+			fail(path+".name", "required")
+		case names[sc.Name]:
+			fail(path+".name", "duplicate scene %q", sc.Name)
+		}
+		names[sc.Name] = true
+
+		if sc.Command != "" {
+			if !strings.HasPrefix(sc.Command, "/") {
+				fail(path+".command", "must start with /")
+			}
+			if commands[sc.Command] {
+				fail(path+".command", "duplicate command %q", sc.Command)
+			}
+			commands[sc.Command] = true
+		}
+
+		if len(sc.Questions) == 0 {
+			fail(path+".questions", "at least one question required")
+		}
+
+		ids := make(map[string]bool)
+		for j, q := range sc.Questions {
+			qpath := fmt.Sprintf("%s.questions[%d]", path, j)
+			switch {
+			case q.ID == "":
+				fail(qpath+".id", "required")
+			case q.ID == EndQuestion || strings.HasPrefix(q.ID, "_"):
+				fail(qpath+".id", "%q is reserved", q.ID)
+			case ids[q.ID]:
+				fail(qpath+".id", "duplicate question %q", q.ID)
+			}
+			ids[q.ID] = true
+
+			if q.Prompt == "" {
+				fail(qpath+".prompt", "required")
+			}
+
+			switch q.Type {
+			case "", AnswerText, AnswerNumber, AnswerContact:
+				if len(q.Options) > 0 {
+					fail(qpath+".options", "only for %s questions", AnswerChoice)
+				}
+			case AnswerChoice:
+				if len(q.Options) == 0 {
+					fail(qpath+".options", "required for %s questions", AnswerChoice)
+				}
+				for k, opt := range q.Options {
+					if opt.Text == "" {
+						fail(fmt.Sprintf("%s.options[%d].text", qpath, k), "required")
+					}
+					if len(opt.value()) > 64 {
+						fail(fmt.Sprintf("%s.options[%d].value", qpath, k), "longer than 64 bytes")
+					}
+				}
+			default:
+				fail(qpath+".type", "unknown answer type %q", q.Type)
+			}
+
+			if rules := q.Validate; rules != nil {
+				if rules.Pattern != "" {
+					if _, err := regexp.Compile(rules.Pattern); err != nil {
+						fail(qpath+".validate.pattern", "%v", err)
+					}
+				}
+				if rules.MaxLength > 0 && rules.MinLength > rules.MaxLength {
+					fail(qpath+".validate", "min_length is greater than max_length")
+				}
+				if rules.Min != nil && rules.Max != nil && *rules.Min > *rules.Max {
+					fail(qpath+".validate", "min is greater than max")
+				}
+			}
+		}
+
+		for j, q := range sc.Questions {
+			for k, b := range q.Next {
+				if b.Goto != EndQuestion && !ids[b.Goto] {
+					fail(fmt.Sprintf("%s.questions[%d].next[%d].goto", path, j, k), "unknown question %q", b.Goto)
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Build turns definitions into wizard scenes. Definitions must be valid.
+func (d *ScenesDefinition) Build() []*WizardScene[map[string]any] {
+	scenes := make([]*WizardScene[map[string]any], 0, len(d.Scenes))
+	for _, def := range d.Scenes {
+		scenes = append(scenes, newQuestionnaire(def).wizard())
+	}
+	return scenes
+}
+
+// LoadScenes parses definitions from r and registers them as wizard scenes.
+// Scene commands are dispatched by Middleware, which telebot runs only for updates
+// with a handler: register an OnText handler so that commands reach it, and an
+// OnCallback handler for buttons of choice questions.
+//
+// Calling LoadScenes again reloads definitions: scenes are swapped at once, scenes missing
+// from the new document are unregistered and their sessions follow the orphan policy.
+// In-flight sessions continue from the question they were asked if it still exists,
+// otherwise from the question at their step. Nothing is registered if the document is invalid.
+func (s *Scenario) LoadScenes(r io.Reader) error {
+	def, err := ParseScenes(r)
+	if err != nil {
+		return err
+	}
+
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	s.mu.RLock()
+	for _, sc := range def.Scenes {
+		if _, ok := s.scenes[sc.Name]; ok && !s.loaded[sc.Name] {
+			s.mu.RUnlock()
+			return fmt.Errorf("%w: %q is already registered", ErrDuplicateScene, sc.Name)
+		}
+	}
+	s.mu.RUnlock()
+
+	var add []Scene
+	next := make(map[SceneName]bool, len(def.Scenes))
+	for _, w := range def.Build() {
+		add = append(add, w)
+		next[w.Name()] = true
+	}
+
+	var remove []SceneName
+	for name := range s.loaded {
+		if !next[name] {
+			remove = append(remove, name)
+		}
+	}
+	s.swapScenes(remove, add)
+	s.loaded = next
+
+	s.mu.Lock()
+	for command, scene := range s.commands {
+		if !next[scene] {
+			delete(s.commands, command)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sc := range def.Scenes {
+		if sc.Command != "" {
+			s.handleCommand(sc.Command, sc.Name)
+		}
+	}
+
+	return nil
+}
+
+// LoadScenesFile loads scene definitions from a YAML or JSON file, see LoadScenes.
+func (s *Scenario) LoadScenesFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := s.LoadScenes(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// handleCommand binds a bot command to entering a scene.
+// Commands are dispatched by Middleware, so loads at runtime never touch bot handlers.
+func (s *Scenario) handleCommand(command string, scene SceneName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.commands == nil {
+		s.commands = make(map[string]SceneName)
+	}
+	s.commands[command] = scene
+}
+
+// commandScene returns the loaded scene entered by the command of the update.
+func (s *Scenario) commandScene(c tele.Context) (SceneName, bool) {
+	m := c.Message()
+	if m == nil || !strings.HasPrefix(m.Text, "/") || c.Callback() != nil {
+		return "", false
+	}
+	command, _, _ := strings.Cut(m.Text, " ")
+	command, _, _ = strings.Cut(command, "@")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scene, ok := s.commands[command]
+	return scene, ok
+}
+
+// enterCommand enters a loaded scene by its command.
+func (s *Scenario) enterCommand(c tele.Context, scene SceneName) error {
+	sceneCtx, err := NewContext[map[string]any](s, c)
+	if err != nil {
+		return err
+	}
+	return sceneCtx.Enter(scene)
+}
+
+func (o OptionDefinition) value() string {
+	if o.Value == "" {
+		return o.Text
+	}
+	return o.Value
+}
+
+// question is a compiled QuestionDefinition.
+type question struct {
+	QuestionDefinition
+	index   int
+	pattern *regexp.Regexp
+}
+
+// questionnaire runs the questions of one scene definition.
+type questionnaire struct {
+	def       SceneDefinition
+	questions []*question
+	byID      map[string]*question
+	keyboards bool // some question shows a reply keyboard that must be removed later
+}
+
+func newQuestionnaire(def SceneDefinition) *questionnaire {
+	qn := &questionnaire{def: def, byID: make(map[string]*question, len(def.Questions))}
+	for i, qd := range def.Questions {
+		q := &question{QuestionDefinition: qd, index: i}
+		if q.Type == "" {
+			q.Type = AnswerText
+		}
+		if q.Validate != nil && q.Validate.Pattern != "" {
+			q.pattern = regexp.MustCompile(q.Validate.Pattern)
+		}
+		if len(q.Keyboard) > 0 || q.Type == AnswerContact {
+			qn.keyboards = true
+		}
+		qn.questions = append(qn.questions, q)
+		qn.byID[q.ID] = q
+	}
+	return qn
+}
+
+func (qn *questionnaire) wizard() *WizardScene[map[string]any] {
+	steps := make([]WizardStep[map[string]any], len(qn.questions))
+	names := make([]string, len(qn.questions))
+	for i, q := range qn.questions {
+		steps[i] = qn.step
+		names[i] = q.ID
+	}
+
+	w := NewWizard[map[string]any](qn.def.Name, steps...).
+		WithStepNames(names...).
+		WithOnEnter(func(c *Context[map[string]any]) error {
+			c.SetData(map[string]any{})
+			return nil
+		})
+
+	for _, q := range qn.questions {
+		for _, b := range q.Next {
+			if b.Goto != EndQuestion {
+				w.DeclareBranch(q.index, qn.byID[b.Goto].index, b.When)
+			}
+		}
+	}
+
+	return w
+}
+
+// step handles an answer to the question the user was asked last.
+// Every step shares it: the asked question is kept in data, so sessions
+// survive reloads that reorder questions.
+func (qn *questionnaire) step(c *Context[map[string]any]) (bool, error) {
+	data := c.GetData()
+	if data == nil {
+		data = make(map[string]any)
+	}
+
+	asked, _ := data[questionKey].(string)
+	q, ok := qn.byID[asked]
+	if !ok {
+		idx := c.Session.Step
+		if idx < 0 || idx >= len(qn.questions) {
+			idx = 0
+		}
+		return false, qn.ask(c, data, qn.questions[idx])
+	}
+
+	answer, valid := q.parse(c)
+	if c.Callback() != nil {
+		if err := c.Respond(); err != nil {
+			return false, err
+		}
+	}
+	if !valid {
+		return false, c.Send(q.errorMessage())
+	}
+	data[q.ID] = answer
+
+	next := qn.next(q, answer)
+	if next == nil {
+		delete(data, questionKey)
+		c.SetData(data)
+		if qn.def.Final != "" {
+			if err := c.Send(qn.final(data), qn.removeKeyboard()); err != nil {
+				return false, err
+			}
+		}
+		return false, c.Scenario.leave(c, ReasonCompleted)
+	}
+
+	return false, qn.ask(c, data, next)
+}
+
+func (qn *questionnaire) ask(c *Context[map[string]any], data map[string]any, q *question) error {
+	data[questionKey] = q.ID
+	c.SetData(data)
+	c.Session.Step = q.index
+	c.markDirty()
+
+	return c.Send(q.Prompt, qn.markup(q))
+}
+
+func (qn *questionnaire) next(q *question, answer any) *question {
+	value := fmt.Sprint(answer)
+	for _, b := range q.Next {
+		if b.When == "" || b.When == value {
+			return qn.byID[b.Goto] // nil for EndQuestion
+		}
+	}
+	if q.index+1 < len(qn.questions) {
+		return qn.questions[q.index+1]
+	}
+	return nil
+}
+
+func (qn *questionnaire) final(data map[string]any) string {
+	pairs := make([]string, 0, 2*len(data))
+	for id, answer := range data {
+		pairs = append(pairs, "{"+id+"}", fmt.Sprint(answer))
+	}
+	for _, q := range qn.questions {
+		if _, ok := data[q.ID]; !ok {
+			pairs = append(pairs, "{"+q.ID+"}", "")
+		}
+	}
+	return strings.NewReplacer(pairs...).Replace(qn.def.Final)
+}
+
+func (qn *questionnaire) markup(q *question) *tele.ReplyMarkup {
+	switch {
+	case q.Type == AnswerChoice:
+		markup := &tele.ReplyMarkup{}
+		rows := make([]tele.Row, 0, len(q.Options))
+		for _, opt := range q.Options {
+			rows = append(rows, markup.Row(tele.Btn{Text: opt.Text, Data: opt.value()}))
+		}
+		markup.Inline(rows...)
+		return markup
+	case len(q.Keyboard) > 0:
+		markup := &tele.ReplyMarkup{ResizeKeyboard: true, OneTimeKeyboard: true}
+		rows := make([]tele.Row, 0, len(q.Keyboard))
+		for _, row := range q.Keyboard {
+			btns := make([]tele.Btn, 0, len(row))
+			for _, text := range row {
+				btns = append(btns, markup.Text(text))
+			}
+			rows = append(rows, markup.Row(btns...))
+		}
+		markup.Reply(rows...)
+		return markup
+	case q.Type == AnswerContact:
+		markup := &tele.ReplyMarkup{ResizeKeyboard: true, OneTimeKeyboard: true}
+		markup.Reply(markup.Row(markup.Contact("Отправить контакт")))
+		return markup
+	default:
+		return qn.removeKeyboard()
+	}
+}
+
+func (qn *questionnaire) removeKeyboard() *tele.ReplyMarkup {
+	if !qn.keyboards {
+		return nil
+	}
+	return &tele.ReplyMarkup{RemoveKeyboard: true}
+}
+
+func (q *question) errorMessage() string {
+	if q.Error != "" {
+		return q.Error
+	}
+	return "Некорректный ответ, попробуйте ещё раз"
+}
+
+// parse extracts and validates the answer from the update.
+func (q *question) parse(c *Context[map[string]any]) (any, bool) {
+	switch q.Type {
+	case AnswerChoice:
+		input := strings.TrimSpace(c.Text())
+		if cb := c.Callback(); cb != nil {
+			input = cb.Data
+		}
+		for _, opt := range q.Options {
+			if input == opt.value() || input == opt.Text {
+				return opt.value(), true
+			}
+		}
+		return nil, false
+
+	case AnswerContact:
+		m := c.Message()
+		if c.Callback() != nil || m == nil || m.Contact == nil {
+			return nil, false
+		}
+		if m.Sender == nil || m.Contact.UserID != m.Sender.ID {
+			return nil, false // a forwarded contact of someone else
+		}
+		return m.Contact.PhoneNumber, true
+
+	case AnswerNumber:
+		if c.Callback() != nil {
+			return nil, false
+		}
+		n, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(c.Text()), ",", "."), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, false
+		}
+		if rules := q.Validate; rules != nil {
+			if rules.Min != nil && n < *rules.Min || rules.Max != nil && n > *rules.Max {
+				return nil, false
+			}
+		}
+		return n, true
+
+	default:
+		if c.Callback() != nil {
+			return nil, false
+		}
+		text := strings.TrimSpace(c.Text())
+		if text == "" {
+			return nil, false
+		}
+		if rules := q.Validate; rules != nil {
+			n := utf8.RuneCountInString(text)
+			if n < rules.MinLength || rules.MaxLength > 0 && n > rules.MaxLength {
+				return nil, false
+			}
+		}
+		if q.pattern != nil && !q.pattern.MatchString(text) {
+			return nil, false
+		}
+		return text, true
+	}
+}
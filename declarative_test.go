@@ -0,0 +1,215 @@
+package scenario_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+const surveyYAML = `
+scenes:
+  - name: survey
+    command: /survey
+    questions:
+      - id: name
+        prompt: Как вас зовут?
+        validate: {min_length: 2}
+        error: Имя слишком короткое
+      - id: adult
+        prompt: Вам есть 18?
+        type: choice
+        options: [{text: Да, value: "yes"}, {text: Нет, value: "no"}]
+        next: [{when: "no", goto: end}]
+      - id: age
+        prompt: Сколько вам лет?
+        type: number
+        validate: {min: 18, max: 120}
+    final: Спасибо, {name}! {age}
+`
+
+func newDeclarativeBot(t *testing.T, doc string) (*scenariotest.Bot, *scenario.Scenario) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+	require.NoError(t, scn.LoadScenes(strings.NewReader(doc)))
+
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	bot.Handle(tele.OnCallback, func(tele.Context) error { return nil })
+	return bot, scn
+}
+
+func TestLoadScenesQuestionnaire(t *testing.T) {
+	bot, scn := newDeclarativeBot(t, surveyYAML)
+
+	conv := bot.Conversation(scn).
+		Send("/survey").ExpectReply("Как вас зовут?").ExpectScene("survey").
+		Send("B").ExpectReply("Имя слишком короткое").
+		Send("Bob").ExpectReplyFunc(func(call scenariotest.Call) error {
+		assert.Equal(t, "Вам есть 18?", call.Text())
+		assert.Equal(t, "yes", call.ReplyMarkup().InlineKeyboard[0][0].Data)
+		return nil
+	}).
+		PressButton("Да").ExpectReply("Сколько вам лет?").ExpectStep(2).
+		Send("12").ExpectReply("Некорректный ответ, попробуйте ещё раз").
+		Send("30").ExpectReply("Спасибо, Bob! 30").ExpectScene("")
+
+	scenariotest.ExpectData(conv, map[string]any{"name": "Bob", "adult": "yes", "age": float64(30)})
+}
+
+func TestLoadScenesBranchToEnd(t *testing.T) {
+	bot, scn := newDeclarativeBot(t, surveyYAML)
+
+	bot.Conversation(scn).
+		Send("/survey").ExpectReply("Как вас зовут?").
+		Send("Bob").ExpectReply("Вам есть 18?").
+		Send("Нет").ExpectReply("Спасибо, Bob! ").ExpectScene("")
+}
+
+func TestLoadScenesReloadInFlight(t *testing.T) {
+	bot, scn := newDeclarativeBot(t, surveyYAML)
+
+	conv := bot.Conversation(scn).
+		Send("/survey").ExpectReply("Как вас зовут?").
+		Send("Bob").ExpectReply("Вам есть 18?")
+
+	// the asked question moves to another position and a question is added before it
+	require.NoError(t, scn.LoadScenes(strings.NewReader(`
+scenes:
+  - name: survey
+    command: /survey
+    questions:
+      - id: city
+        prompt: Ваш город?
+      - id: adult
+        prompt: Вам уже исполнилось 18?
+        type: choice
+        options: [{text: Да, value: "yes"}, {text: Нет, value: "no"}]
+    final: Готово, {name}
+`)))
+
+	conv.PressButton("Да").ExpectReply("Готово, Bob").ExpectScene("")
+	conv.Send("/survey").ExpectReply("Ваш город?")
+}
+
+func TestLoadScenesReloadRemovesScenes(t *testing.T) {
+	bot, scn := newDeclarativeBot(t, surveyYAML)
+	bot.Conversation(scn).Send("/survey").ExpectReply("Как вас зовут?")
+
+	require.NoError(t, scn.LoadScenes(strings.NewReader(`
+scenes:
+  - name: feedback
+    command: /feedback
+    questions:
+      - id: text
+        prompt: Ваш отзыв?
+`)))
+	require.NoError(t, scn.Validate())
+
+	// commands added by a reload are dispatched without new bot handlers
+	bot.ConversationWith(scn, &tele.Chat{ID: 2}, &tele.User{ID: 2}).
+		Send("/feedback").ExpectReply("Ваш отзыв?").ExpectScene("feedback")
+
+	var names []scenario.SceneName
+	for _, node := range scn.Graph().Nodes {
+		names = append(names, node.Scene)
+	}
+	assert.Equal(t, []scenario.SceneName{"feedback"}, names)
+}
+
+func TestLoadScenesNumberNotFinite(t *testing.T) {
+	bot, scn := newDeclarativeBot(t, `
+scenes:
+  - name: weight
+    command: /weight
+    questions:
+      - id: kg
+        prompt: Ваш вес?
+        type: number
+    final: Вес {kg}
+`)
+
+	bot.Conversation(scn).
+		Send("/weight").ExpectReply("Ваш вес?").
+		Send("nan").ExpectReply("Некорректный ответ, попробуйте ещё раз").
+		Send("NaN").ExpectReply("Некорректный ответ, попробуйте ещё раз").
+		Send("inf").ExpectReply("Некорректный ответ, попробуйте ещё раз").
+		Send("-Inf").ExpectReply("Некорректный ответ, попробуйте ещё раз").
+		Send("70,5").ExpectReply("Вес 70.5").ExpectScene("")
+}
+
+func TestLoadScenesContactOwner(t *testing.T) {
+	bot, scn := newDeclarativeBot(t, `
+scenes:
+  - name: signup
+    command: /signup
+    questions:
+      - id: phone
+        prompt: Поделитесь номером
+        type: contact
+    final: Номер {phone}
+`)
+	bot.Handle(tele.OnContact, func(tele.Context) error { return nil })
+
+	conv := bot.Conversation(scn).Send("/signup").ExpectReply("Поделитесь номером")
+	conv.SendMessage(&tele.Message{Contact: &tele.Contact{PhoneNumber: "+70000000000", UserID: 99}}).
+		ExpectReply("Некорректный ответ, попробуйте ещё раз").
+		SendContact("+71111111111").ExpectReply("Номер +71111111111").ExpectScene("")
+}
+
+func TestParseScenesErrors(t *testing.T) {
+	_, err := scenario.ParseScenes(strings.NewReader(`
+scenes:
+  - name: broken
+    command: broken
+    questions:
+      - id: a
+        prompt: A
+        type: choice
+      - id: a
+        prompt: ""
+        type: date
+        validate: {pattern: "(", min: 5, max: 1}
+        next: [{goto: nowhere}]
+  - name: broken
+    questions: []
+`))
+	require.ErrorIs(t, err, scenario.ErrInvalidDefinition)
+
+	for _, msg := range []string{
+		`scenes[0].command: must start with /`,
+		`scenes[0].questions[0].options: required for choice questions`,
+		`scenes[0].questions[1].id: duplicate question "a"`,
+		`scenes[0].questions[1].prompt: required`,
+		`scenes[0].questions[1].type: unknown answer type "date"`,
+		`scenes[0].questions[1].validate.pattern`,
+		`scenes[0].questions[1].validate: min is greater than max`,
+		`scenes[0].questions[1].next[0].goto: unknown question "nowhere"`,
+		`scenes[1].name: duplicate scene "broken"`,
+		`scenes[1].questions: at least one question required`,
+	} {
+		assert.Contains(t, err.Error(), msg)
+	}
+
+	_, err = scenario.ParseScenes(strings.NewReader(`{"scenes": [{"name": "x", "questoins": []}]}`))
+	assert.ErrorIs(t, err, scenario.ErrInvalidDefinition)
+	assert.Contains(t, err.Error(), "questoins")
+}
+
+func TestLoadScenesKeepsPreviousOnError(t *testing.T) {
+	bot, scn := newDeclarativeBot(t, surveyYAML)
+
+	assert.Error(t, scn.LoadScenes(strings.NewReader(`scenes: [{name: survey}]`)))
+	bot.Conversation(scn).Send("/survey").ExpectReply("Как вас зовут?")
+}
+
+func TestLoadScenesConflictsWithCodeScene(t *testing.T) {
+	scn := scenario.New(nil)
+	scn.Use(scenario.NewWizard[struct{}]("survey"))
+	assert.ErrorIs(t, scn.LoadScenes(strings.NewReader(surveyYAML)), scenario.ErrDuplicateScene)
+}
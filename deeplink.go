@@ -0,0 +1,266 @@
+package scenario
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// ErrInvalidDeepLink is returned when a deep link pattern is malformed.
+var ErrInvalidDeepLink = errors.New("invalid deep link")
+
+// ReasonDeepLink is recorded when a deep link makes the user leave the active scene.
+const ReasonDeepLink = "deeplink"
+
+// DeepLinkPolicy defines what happens to the active scene when the user opens a deep link.
+type DeepLinkPolicy int
+
+const (
+	// DeepLinkLeave leaves the active scene and enters the scene of the link.
+	DeepLinkLeave DeepLinkPolicy = iota
+	// DeepLinkIgnore drops the link, the active scene goes on.
+	DeepLinkIgnore
+)
+
+// DeepLinkArgs are arguments parsed from a /start payload by the pattern of a deep link.
+// Values of {name:int} parameters are int64, others are strings.
+type DeepLinkArgs map[string]any
+
+// String returns the argument as a string.
+func (a DeepLinkArgs) String(name string) string {
+	switch v := a[name].(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return ""
+}
+
+// Int returns an {name:int} argument.
+func (a DeepLinkArgs) Int(name string) int64 {
+	v, _ := a[name].(int64)
+	return v
+}
+
+// deepLink is a /start payload pattern routed to a scene.
+type deepLink struct {
+	pattern string
+	re      *regexp.Regexp
+	ints    map[string]bool
+	scene   SceneName
+	enter   func(s *Scenario, c tele.Context, args DeepLinkArgs) error
+}
+
+var deepLinkParam = regexp.MustCompile(`\{(\w+)(?::(\w+))?\}`)
+
+// compileDeepLink turns a pattern like "promo_{code}" or "ref_{id:int}" into a regexp.
+func compileDeepLink(pattern string) (*regexp.Regexp, map[string]bool, error) {
+	if pattern == "" {
+		return nil, nil, fmt.Errorf("%w: empty pattern", ErrInvalidDeepLink)
+	}
+
+	var expr strings.Builder
+	ints := make(map[string]bool)
+	seen := make(map[string]bool)
+	last := 0
+	expr.WriteString("^")
+	for _, m := range deepLinkParam.FindAllStringSubmatchIndex(pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:m[0]]))
+		name, kind := pattern[m[2]:m[3]], ""
+		if m[4] >= 0 {
+			kind = pattern[m[4]:m[5]]
+		}
+		if seen[name] {
+			return nil, nil, fmt.Errorf("%w: duplicate parameter %q in %q", ErrInvalidDeepLink, name, pattern)
+		}
+		seen[name] = true
+
+		switch kind {
+		case "", "str":
+			fmt.Fprintf(&expr, "(?P<%s>.+?)", name)
+		case "int":
+			fmt.Fprintf(&expr, `(?P<%s>-?\d+)`, name)
+			ints[name] = true
+		default:
+			return nil, nil, fmt.Errorf("%w: unknown type %q of parameter %q in %q", ErrInvalidDeepLink, kind, name, pattern)
+		}
+		last = m[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]))
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidDeepLink, err)
+	}
+	return re, ints, nil
+}
+
+func (l *deepLink) match(payload string) (DeepLinkArgs, bool) {
+	m := l.re.FindStringSubmatch(payload)
+	if m == nil {
+		return nil, false
+	}
+	args := make(DeepLinkArgs)
+	for i, name := range l.re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if !l.ints[name] {
+			args[name] = m[i]
+			continue
+		}
+		n, err := strconv.ParseInt(m[i], 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		args[name] = n
+	}
+	return args, true
+}
+
+// DeepLink routes /start payloads matching pattern to scene, e.g. "promo_{code}"
+// or "ref_{id:int}" for t.me/bot?start=ref_42. Payloads are also matched base64url-decoded
+// if they are EncodeDeepLink of UTF-8 text.
+// bind, if not nil, stores the arguments in the session before the scene is entered.
+// Links are matched in order of registration; invalid patterns are reported by Scenario.Validate.
+func DeepLink[T any](s *Scenario, pattern string, scene SceneName, bind func(c *Context[T], args DeepLinkArgs) error) *Scenario {
+	re, ints, err := compileDeepLink(pattern)
+	if err != nil {
+		s.mu.Lock()
+		s.linkErrs = append(s.linkErrs, err)
+		s.mu.Unlock()
+		return s
+	}
+
+	link := &deepLink{pattern: pattern, re: re, ints: ints, scene: scene}
+	link.enter = func(s *Scenario, c tele.Context, args DeepLinkArgs) error {
+		sceneCtx, err := NewContext[T](s, c)
+		if err != nil {
+			return err
+		}
+		if bind != nil {
+			if err := bind(sceneCtx, args); err != nil {
+				return err
+			}
+		}
+		return sceneCtx.Enter(scene)
+	}
+
+	s.mu.Lock()
+	s.links = append(s.links, link)
+	s.mu.Unlock()
+	return s.Declare("", scene, "/start "+pattern)
+}
+
+// WithDeepLinkPolicy sets what happens to the active scene when the user opens a deep link.
+func (s *Scenario) WithDeepLinkPolicy(policy DeepLinkPolicy) *Scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.linkPolicy = policy
+	return s
+}
+
+// WithDeepLinkFallback sets a handler for /start payloads matching no deep link,
+// called even in an active scene. Without it such updates are handled as usual.
+func (s *Scenario) WithDeepLinkFallback(fn tele.HandlerFunc) *Scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.linkFallback = fn
+	return s
+}
+
+// routeDeepLink enters the scene of the deep link in the /start payload of the update
+// and reports whether the update was handled.
+func (s *Scenario) routeDeepLink(c tele.Context, base *SessionBase) (bool, error) {
+	payload, ok := startPayload(c)
+	if !ok {
+		return false, nil
+	}
+	link, args, ok := s.deepLink(payload)
+	s.mu.RLock()
+	policy, fallback := s.linkPolicy, s.linkFallback
+	s.mu.RUnlock()
+	if !ok {
+		if fallback == nil {
+			return false, nil
+		}
+		return true, fallback(c)
+	}
+
+	if sc, active := s.scene(base.Scene); base.Scene != "" && active {
+		if policy == DeepLinkIgnore {
+			return true, nil
+		}
+		sceneCtx, err := createTypedContext(sc, s, c, base)
+		if err != nil {
+			return true, fmt.Errorf("createTypedContext: %w", err)
+		}
+		if err := s.leave(sceneCtx, ReasonDeepLink); err != nil {
+			return true, fmt.Errorf("leave: %w", err)
+		}
+	}
+	return true, link.enter(s, c, args)
+}
+
+// deepLink finds the link matching the payload as is or base64url-decoded.
+func (s *Scenario) deepLink(payload string) (*deepLink, DeepLinkArgs, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates := []string{payload}
+	if decoded, ok := decodeDeepLink(payload); ok {
+		candidates = append(candidates, decoded)
+	}
+	for _, p := range candidates {
+		for _, link := range s.links {
+			if args, ok := link.match(p); ok {
+				return link, args, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+func (s *Scenario) hasDeepLinks() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.links) > 0 || s.linkFallback != nil
+}
+
+// startPayload returns the payload of a /start command.
+func startPayload(c tele.Context) (string, bool) {
+	m := c.Message()
+	if m == nil || c.Callback() != nil {
+		return "", false
+	}
+	command, payload, _ := strings.Cut(m.Text, " ")
+	if name, _, _ := strings.Cut(command, "@"); name != "/start" {
+		return "", false
+	}
+	payload = strings.TrimSpace(payload)
+	return payload, payload != ""
+}
+
+// decodeDeepLink decodes a payload of EncodeDeepLink. Plain payloads that happen
+// to be valid base64 rarely decode to UTF-8 text encoding back to themselves.
+func decodeDeepLink(payload string) (string, bool) {
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || !utf8.Valid(decoded) || EncodeDeepLink(string(decoded)) != payload {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// EncodeDeepLink encodes a payload that doesn't fit the characters allowed in a /start
+// parameter (A-Z, a-z, 0-9, _ and -) with base64url.
+func EncodeDeepLink(payload string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(payload))
+}
@@ -0,0 +1,117 @@
+package scenario_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+type promoData struct {
+	Code     string `json:"code"`
+	Referrer int64  `json:"referrer"`
+}
+
+func newPromoBot(t *testing.T, policy scenario.DeepLinkPolicy) (*scenariotest.Bot, *scenario.Scenario) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot).
+		WithDeepLinkPolicy(policy).
+		WithDeepLinkFallback(func(c tele.Context) error { return c.Send("Ссылка недействительна") })
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[promoData]("promo",
+		func(c *scenario.Context[promoData]) (bool, error) {
+			data := c.GetData()
+			if data.Referrer != 0 {
+				return true, c.Send("Приглашение от " + strconv.FormatInt(data.Referrer, 10))
+			}
+			return true, c.Send("Промокод " + data.Code + ". Ваш email?")
+		},
+		func(c *scenario.Context[promoData]) (bool, error) {
+			return true, c.Send("Готово")
+		},
+	))
+
+	scenario.DeepLink(scn, "promo_{code}", "promo", func(c *scenario.Context[promoData], args scenario.DeepLinkArgs) error {
+		c.SetData(promoData{Code: args.String("code")})
+		return nil
+	})
+	scenario.DeepLink(scn, "ref_{id:int}", "promo", func(c *scenario.Context[promoData], args scenario.DeepLinkArgs) error {
+		c.SetData(promoData{Referrer: args.Int("id")})
+		return nil
+	})
+
+	bot.Handle("/start", func(c tele.Context) error { return c.Send("Привет!") })
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	return bot, scn
+}
+
+func TestDeepLinkRouting(t *testing.T) {
+	bot, scn := newPromoBot(t, scenario.DeepLinkLeave)
+
+	conv := bot.Conversation(scn).
+		Send("/start").ExpectReply("Привет!").
+		Send("/start promo_ABC").ExpectReply("Промокод ABC. Ваш email?").
+		ExpectScene("promo")
+	scenariotest.ExpectData(conv, promoData{Code: "ABC"})
+
+	conv.Send("a@b.c").ExpectReply("Готово").
+		Send("/start ref_42").ExpectReply("Приглашение от 42").
+		Send("ok").
+		Send("/start ref_x").ExpectReply("Ссылка недействительна").
+		ExpectScene("")
+}
+
+func TestDeepLinkBase64(t *testing.T) {
+	bot, scn := newPromoBot(t, scenario.DeepLinkLeave)
+
+	payload := scenario.EncodeDeepLink("promo_Лето 2026")
+	bot.Conversation(scn).
+		Send("/start " + payload).ExpectReply("Промокод Лето 2026. Ваш email?")
+}
+
+func TestDeepLinkBase64Canonical(t *testing.T) {
+	bot, scn := newPromoBot(t, scenario.DeepLinkLeave)
+
+	// same bytes as EncodeDeepLink("promo_AB") with non-zero trailing bits
+	payload := scenario.EncodeDeepLink("promo_AB")
+	payload = payload[:len(payload)-1] + "J"
+	require.NotEqual(t, scenario.EncodeDeepLink("promo_AB"), payload)
+
+	bot.Conversation(scn).
+		Send("/start " + payload).ExpectReply("Ссылка недействительна").
+		Send("/start " + scenario.EncodeDeepLink("promo_AB")).ExpectReply("Промокод AB. Ваш email?")
+}
+
+func TestDeepLinkActiveScene(t *testing.T) {
+	bot, scn := newPromoBot(t, scenario.DeepLinkLeave)
+
+	conv := bot.Conversation(scn).
+		Send("/start promo_OLD").ExpectReply("Промокод OLD. Ваш email?").
+		Send("/start promo_NEW").ExpectReply("Промокод NEW. Ваш email?").
+		ExpectStep(1)
+	scenariotest.ExpectData(conv, promoData{Code: "NEW"})
+
+	bot, scn = newPromoBot(t, scenario.DeepLinkIgnore)
+	conv = bot.Conversation(scn).
+		Send("/start promo_OLD").ExpectReply("Промокод OLD. Ваш email?").
+		Send("/start promo_NEW").ExpectNoReply().
+		ExpectStep(1)
+	scenariotest.ExpectData(conv, promoData{Code: "OLD"})
+}
+
+func TestDeepLinkValidate(t *testing.T) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	scenario.DeepLink[any](scn, "ref_{id:float}", "promo", nil)
+	scenario.DeepLink[any](scn, "promo_{code}", "missing", nil)
+
+	err := scn.Validate()
+	assert.ErrorIs(t, err, scenario.ErrInvalidDeepLink)
+	assert.ErrorIs(t, err, scenario.ErrSceneNotFound)
+}
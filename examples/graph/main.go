@@ -0,0 +1,49 @@
+// Example graph prints the scene graph as a Mermaid or Graphviz diagram.
+//
+// It draws the sample scenes. Scenario.WriteGraph works on any scenario: copy this
+// example and replace demo.Register with the registration of your own scenes to
+// commit the diagram to docs:
+//
+//	go run ./examples/graph -format mermaid -o docs/scenes.mmd
+//	go run ./examples/graph -format dot | dot -Tsvg > scenes.svg
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/internal/demo"
+)
+
+func main() {
+	format := flag.String("format", scenario.GraphMermaid, "diagram format: mermaid or dot")
+	output := flag.String("o", "", "output file, stdout by default")
+	flag.Parse()
+
+	bot, err := tele.NewBot(tele.Settings{Offline: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scn := scenario.New(bot)
+	demo.Register(bot, scn)
+	if err := scn.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			log.Fatal(err)
+		}
+		defer out.Close()
+	}
+
+	if err := scn.WriteGraph(out, *format); err != nil {
+		log.Fatal(err)
+	}
+}
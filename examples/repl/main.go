@@ -0,0 +1,41 @@
+// Example repl walks through scenes in the terminal without a bot token or network.
+//
+// It runs the sample order wizard with scenariotest.REPL. To try your own scenes,
+// copy it and replace demo.Register with their registration, the same as in production:
+//
+//	go run ./examples/repl
+//	> /start
+//	bot: Выберите размер
+//	  [S](/btn S) [M](/btn M) [L](/btn L)
+//	> /btn M
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/internal/demo"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+func main() {
+	bot, err := scenariotest.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer bot.Close()
+
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+	demo.Register(bot.Bot, scn)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := scenariotest.NewREPL(bot, scn).Run(ctx, os.Stdin, os.Stdout); err != nil {
+		log.Println(err)
+	}
+}
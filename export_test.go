@@ -0,0 +1,9 @@
+package scenario
+
+import "time"
+
+// WithAlbumTimer makes MediaStep start album timers with after instead of time.AfterFunc.
+func WithAlbumTimer(opts MediaOptions, after func(d time.Duration, f func()) (stop func() bool)) MediaOptions {
+	opts.after = after
+	return opts
+}
@@ -0,0 +1,413 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// FSMAnyState matches any state in FSMTransition.From.
+const FSMAnyState = "*"
+
+// FSMGuard allows a transition depending on session data.
+type FSMGuard[T any] func(data T) bool
+
+// FSMAction is a state entry/exit or transition action.
+type FSMAction[T any] func(c *Context[T]) error
+
+// FSMTransition moves the machine from one state to another on event.
+type FSMTransition[T any] struct {
+	From  string
+	Event string
+	To    string
+	Guard FSMGuard[T]
+	// GuardName describes the guard in the transition table.
+	GuardName string
+	Action    FSMAction[T]
+}
+
+// FSMScene is a scene driven by a finite state machine. The current state
+// is persisted in the session State; Step is 0 while the scene is active.
+// Events come from updates (see WithEvents) or from outside via Fire.
+// T is the type of data stored in the session.
+type FSMScene[T any] struct {
+	name        SceneName
+	initial     string
+	states      []string
+	entry       map[string]FSMAction[T]
+	exit        map[string]FSMAction[T]
+	final       map[string]bool
+	transitions []FSMTransition[T]
+	events      func(*Context[T]) string
+	unhandled   FSMAction[T]
+	idleAfter   time.Duration
+	idleText    string
+	dataPolicy  DataPolicy
+	cleanup     *CleanupPolicy
+	rateLimit   *RateLimit
+}
+
+// NewFSM creates a state machine scene starting in the initial state.
+func NewFSM[T any](name SceneName, initial string) *FSMScene[T] {
+	return &FSMScene[T]{
+		name:    name,
+		initial: initial,
+		states:  []string{initial},
+		entry:   make(map[string]FSMAction[T]),
+		exit:    make(map[string]FSMAction[T]),
+		final:   make(map[string]bool),
+		events:  defaultFSMEvent[T],
+	}
+}
+
+// Name returns the scene name.
+func (f *FSMScene[T]) Name() SceneName { return f.name }
+
+// States declares states of the machine.
+func (f *FSMScene[T]) States(states ...string) *FSMScene[T] {
+	for _, state := range states {
+		if !f.hasState(state) {
+			f.states = append(f.states, state)
+		}
+	}
+	return f
+}
+
+// Final marks states that complete the scene when entered.
+func (f *FSMScene[T]) Final(states ...string) *FSMScene[T] {
+	f.States(states...)
+	for _, state := range states {
+		f.final[state] = true
+	}
+	return f
+}
+
+// OnEntry sets an action run when the machine enters state.
+func (f *FSMScene[T]) OnEntry(state string, action FSMAction[T]) *FSMScene[T] {
+	f.entry[state] = action
+	return f
+}
+
+// OnExit sets an action run when the machine leaves state.
+func (f *FSMScene[T]) OnExit(state string, action FSMAction[T]) *FSMScene[T] {
+	f.exit[state] = action
+	return f
+}
+
+// On adds an unguarded transition.
+func (f *FSMScene[T]) On(from, event, to string) *FSMScene[T] {
+	return f.AddTransition(FSMTransition[T]{From: from, Event: event, To: to})
+}
+
+// AddTransition adds a transition. Transitions are checked in order,
+// the first one with matching state, event and passing guard is taken.
+func (f *FSMScene[T]) AddTransition(t FSMTransition[T]) *FSMScene[T] {
+	f.transitions = append(f.transitions, t)
+	return f
+}
+
+// WithEvents sets how updates are turned into events; an empty event is ignored.
+// By default the event is the unique of a pressed button, its data, or the message text.
+func (f *FSMScene[T]) WithEvents(fn func(*Context[T]) string) *FSMScene[T] {
+	f.events = fn
+	return f
+}
+
+// OnUnhandled sets an action for updates with no matching transition.
+func (f *FSMScene[T]) OnUnhandled(action FSMAction[T]) *FSMScene[T] {
+	f.unhandled = action
+	return f
+}
+
+// WithDataPolicy sets what happens to session data when the user leaves the scene.
+func (f *FSMScene[T]) WithDataPolicy(policy DataPolicy) *FSMScene[T] {
+	f.dataPolicy = policy
+	return f
+}
+
+// DataPolicy returns the policy set by WithDataPolicy.
+func (f *FSMScene[T]) DataPolicy() DataPolicy { return f.dataPolicy }
+
+// WithCleanup sets which messages of the scene are removed when the user leaves it.
+func (f *FSMScene[T]) WithCleanup(policy CleanupPolicy) *FSMScene[T] {
+	f.cleanup = &policy
+	return f
+}
+
+// CleanupPolicy returns the policy set by WithCleanup.
+func (f *FSMScene[T]) CleanupPolicy() *CleanupPolicy { return f.cleanup }
+
+// WithRateLimit limits updates in the scene on top of the rate limit of the scenario.
+func (f *FSMScene[T]) WithRateLimit(limit RateLimit) *FSMScene[T] {
+	f.rateLimit = &limit
+	return f
+}
+
+// RateLimit returns the limit set by WithRateLimit.
+func (f *FSMScene[T]) RateLimit() *RateLimit { return f.rateLimit }
+
+// WithIdleReminder sends text to users inactive in the machine for after.
+// {state} in text is replaced with the current state. Requires Scenario.WithScheduler.
+func (f *FSMScene[T]) WithIdleReminder(after time.Duration, text string) *FSMScene[T] {
+	f.idleAfter, f.idleText = after, text
+	return f
+}
+
+// IdleReminder returns the reminder set by WithIdleReminder.
+func (f *FSMScene[T]) IdleReminder() (time.Duration, string) {
+	return f.idleAfter, f.idleText
+}
+
+// Table returns the transitions of the machine.
+func (f *FSMScene[T]) Table() []FSMTransition[T] {
+	return append([]FSMTransition[T](nil), f.transitions...)
+}
+
+// TransitionTable renders the transitions as a Markdown table.
+func (f *FSMScene[T]) TransitionTable() string {
+	var b strings.Builder
+	b.WriteString("| From | Event | Guard | To |\n|------|-------|-------|----|\n")
+	for _, t := range f.transitions {
+		guard := t.GuardName
+		if guard == "" && t.Guard != nil {
+			guard = "yes"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", t.From, t.Event, guard, t.To)
+	}
+	return b.String()
+}
+
+// Steps returns state names for the scene graph.
+func (f *FSMScene[T]) Steps() []string {
+	return append([]string(nil), f.states...)
+}
+
+// Transitions returns the transitions as scene graph edges between states.
+func (f *FSMScene[T]) Transitions() []Edge {
+	var edges []Edge
+	for _, t := range f.transitions {
+		label := t.Event
+		if t.GuardName != "" {
+			label += " [" + t.GuardName + "]"
+		}
+		for _, from := range f.expand(t.From) {
+			edges = append(edges, Edge{From: f.name, FromStep: f.index(from), To: f.name, ToStep: f.index(t.To), Label: label})
+		}
+	}
+	return edges
+}
+
+// Validate checks that transitions refer to declared states.
+func (f *FSMScene[T]) Validate() error {
+	var errs []error
+	if f.initial == "" {
+		errs = append(errs, fmt.Errorf("%w: empty initial state", ErrInvalidScene))
+	}
+	for _, t := range f.transitions {
+		if t.From != FSMAnyState && !f.hasState(t.From) {
+			errs = append(errs, fmt.Errorf("%w: transition %q from unknown state %q", ErrInvalidScene, t.Event, t.From))
+		}
+		if !f.hasState(t.To) {
+			errs = append(errs, fmt.Errorf("%w: transition %q to unknown state %q", ErrInvalidScene, t.Event, t.To))
+		}
+		if t.Event == "" {
+			errs = append(errs, fmt.Errorf("%w: transition from %q with empty event", ErrInvalidScene, t.From))
+		}
+	}
+	for state, final := range f.final {
+		if !final {
+			continue
+		}
+		for _, t := range f.transitions {
+			if t.From == state {
+				errs = append(errs, fmt.Errorf("%w: transition %q from final state %q", ErrInvalidScene, t.Event, state))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CreateContext creates a typed Context[T] from SessionBase.
+func (f *FSMScene[T]) CreateContext(scenario *Scenario, c tele.Context, base *SessionBase) (ContextBase, error) {
+	sess, err := fromBase[T](base, scenario.codecs)
+	if err != nil {
+		return nil, fmt.Errorf("fromBase[%T]: %w", *new(T), err)
+	}
+	return newCtx(scenario, c, sess), nil
+}
+
+// Enter puts the machine into the initial state and runs its entry action.
+// The update that entered the scene is not treated as an event.
+func (f *FSMScene[T]) Enter(c ContextBase) error {
+	ctx, ok := c.(*Context[T])
+	if !ok {
+		return fmt.Errorf("FSMScene[%T]: expected Context[%T], got %T", *new(T), *new(T), c)
+	}
+	ctx.Session.Step = 0
+	ctx.Session.State = f.initial
+	ctx.markDirty()
+
+	if action := f.entry[f.initial]; action != nil {
+		return action(ctx)
+	}
+	return nil
+}
+
+// OnUpdate turns the update into an event and fires it.
+func (f *FSMScene[T]) OnUpdate(c ContextBase) error {
+	ctx, ok := c.(*Context[T])
+	if !ok {
+		return fmt.Errorf("FSMScene[%T]: expected Context[%T], got %T", *new(T), *new(T), c)
+	}
+
+	event := f.events(ctx)
+	if event == "" {
+		return nil
+	}
+	return f.handle(ctx, event)
+}
+
+// Leave clears the state.
+func (f *FSMScene[T]) Leave(c ContextBase) error {
+	ctx, ok := c.(*Context[T])
+	if !ok {
+		return fmt.Errorf("FSMScene[%T]: expected Context[%T], got %T", *new(T), *new(T), c)
+	}
+	ctx.Session.Step = -1
+	ctx.Session.State = ""
+	ctx.markDirty()
+	return nil
+}
+
+// Fire delivers an external event, e.g. a payment webhook, to the session of userID in chatID.
+// Actions may send messages to the chat. ErrSceneNotFound is returned
+// if the session is not in this scene, ErrNoBot if scenario has no bot.
+// Fire waits for an update of the session in progress; from a handler pass UpdateContext.
+func (f *FSMScene[T]) Fire(ctx context.Context, scenario *Scenario, chatID, userID int64, event string) error {
+	if scenario.bot == nil {
+		return ErrNoBot
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// updates of the session wait for the event and vice versa
+	unlock, err := scenario.sessions.lock(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	base, err := scenario.store.GetSession(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if base.Scene != f.name {
+		return fmt.Errorf("%w: session is in scene %q, not %q", ErrSceneNotFound, base.Scene, f.name)
+	}
+
+	c := &updateContext{
+		Context: scenario.bot.NewContext(tele.Update{Message: &tele.Message{
+			Chat:   &tele.Chat{ID: chatID},
+			Sender: &tele.User{ID: userID},
+		}}),
+		ctx: scenario.sessions.hold(ctx, chatID, userID),
+	}
+	sceneCtx, err := f.CreateContext(scenario, c, base)
+	if err != nil {
+		return err
+	}
+
+	if err := f.handle(sceneCtx.(*Context[T]), event); err != nil {
+		return err
+	}
+	return scenario.persist(ctx, sceneCtx, base.Scene, base.Step)
+}
+
+// handle takes the first matching transition: exit action, transition action,
+// state change, entry action. Entering a final state leaves the scene.
+func (f *FSMScene[T]) handle(ctx *Context[T], event string) error {
+	state := ctx.Session.State
+
+	for _, t := range f.transitions {
+		if t.Event != event || t.From != state && t.From != FSMAnyState {
+			continue
+		}
+		if t.Guard != nil && !t.Guard(ctx.GetData()) {
+			continue
+		}
+
+		if action := f.exit[state]; action != nil {
+			if err := action(ctx); err != nil {
+				return fmt.Errorf("exit %q: %w", state, err)
+			}
+		}
+		if t.Action != nil {
+			if err := t.Action(ctx); err != nil {
+				return fmt.Errorf("transition %q -> %q: %w", state, t.To, err)
+			}
+		}
+
+		ctx.Session.State = t.To
+		ctx.markDirty()
+		if base, err := ctx.getSessionBase(); err == nil {
+			rctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			ctx.Scenario.recordState(rctx, base, state, t.To, event)
+			cancel()
+		}
+
+		if action := f.entry[t.To]; action != nil {
+			if err := action(ctx); err != nil {
+				return fmt.Errorf("entry %q: %w", t.To, err)
+			}
+		}
+		if f.final[t.To] {
+			return ctx.Scenario.leave(ctx, ReasonCompleted)
+		}
+		return nil
+	}
+
+	if f.unhandled != nil {
+		return f.unhandled(ctx)
+	}
+	return nil
+}
+
+func (f *FSMScene[T]) passiveEnter() {}
+
+func (f *FSMScene[T]) hasState(state string) bool {
+	return f.index(state) >= 0
+}
+
+func (f *FSMScene[T]) index(state string) int {
+	for i, s := range f.states {
+		if s == state {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *FSMScene[T]) expand(from string) []string {
+	if from == FSMAnyState {
+		return f.states
+	}
+	return []string{from}
+}
+
+func defaultFSMEvent[T any](c *Context[T]) string {
+	if cb := c.Callback(); cb != nil {
+		if cb.Unique != "" {
+			return cb.Unique
+		}
+		return cb.Data
+	}
+	if m := c.Message(); m != nil {
+		return strings.TrimSpace(m.Text)
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+package scenario_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+type order struct {
+	Items int      `json:"items"`
+	Log   []string `json:"log"`
+}
+
+func newOrderFSM() *scenario.FSMScene[order] {
+	logAction := func(msg string) scenario.FSMAction[order] {
+		return func(c *scenario.Context[order]) error {
+			data := c.GetData()
+			data.Log = append(data.Log, msg)
+			c.SetData(data)
+			return nil
+		}
+	}
+
+	return scenario.NewFSM[order]("order", "draft").
+		States("awaiting_payment").
+		Final("paid", "cancelled").
+		OnEntry("draft", func(c *scenario.Context[order]) error { return c.Send("Черновик заказа") }).
+		OnExit("draft", logAction("exit draft")).
+		OnEntry("awaiting_payment", func(c *scenario.Context[order]) error { return c.Send("Ожидаем оплату") }).
+		OnEntry("paid", func(c *scenario.Context[order]) error { return c.Send("Оплачено") }).
+		OnEntry("cancelled", func(c *scenario.Context[order]) error { return c.Send("Заказ отменён") }).
+		AddTransition(scenario.FSMTransition[order]{
+			From: "draft", Event: "add", To: "draft",
+			Action: func(c *scenario.Context[order]) error {
+				data := c.GetData()
+				data.Items++
+				c.SetData(data)
+				return nil
+			},
+		}).
+		AddTransition(scenario.FSMTransition[order]{
+			From: "draft", Event: "pay", To: "awaiting_payment",
+			Guard:     func(o order) bool { return o.Items > 0 },
+			GuardName: "has items",
+		}).
+		On("awaiting_payment", "paid", "paid").
+		On(scenario.FSMAnyState, "/cancel", "cancelled").
+		OnUnhandled(func(c *scenario.Context[order]) error { return c.Send("Недоступно") })
+}
+
+func newOrderBot(t *testing.T) (*scenariotest.Bot, *scenario.Scenario, *scenario.FSMScene[order]) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	fsm := newOrderFSM()
+	scn.Use(fsm)
+	require.NoError(t, scn.Validate())
+
+	bot.Handle("/order", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[order](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("order")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	return bot, scn, fsm
+}
+
+func TestFSMSceneFlow(t *testing.T) {
+	bot, scn, fsm := newOrderBot(t)
+
+	conv := bot.Conversation(scn).
+		Send("/order").ExpectReply("Черновик заказа").ExpectNoReply().
+		Send("pay").ExpectReply("Недоступно"). // guarded: no items yet
+		Send("add").ExpectReply("Черновик заказа").
+		Send("pay").ExpectReply("Ожидаем оплату")
+
+	sess := scenariotest.Session[order](conv)
+	assert.Equal(t, "awaiting_payment", sess.State)
+	assert.Equal(t, 0, sess.Step)
+	assert.Equal(t, order{Items: 1, Log: []string{"exit draft", "exit draft"}}, sess.Data)
+
+	// external event, e.g. a payment webhook
+	require.NoError(t, fsm.Fire(context.Background(), scn, conv.Chat().ID, conv.User().ID, "paid"))
+	calls := bot.Calls()
+	assert.Equal(t, "Оплачено", calls[len(calls)-1].Text())
+
+	conv.ExpectScene("")
+	assert.Equal(t, "", scenariotest.Session[order](conv).State)
+	assert.ErrorIs(t, fsm.Fire(context.Background(), scn, conv.Chat().ID, conv.User().ID, "paid"), scenario.ErrSceneNotFound)
+}
+
+func TestFSMSceneRecordsTransitions(t *testing.T) {
+	bot, scn, fsm := newOrderBot(t)
+	history := scenario.NewMemoryHistory()
+	scn.WithHistory(history, false)
+
+	conv := bot.Conversation(scn).
+		Send("/order").Send("add").Send("pay")
+	require.NoError(t, fsm.Fire(context.Background(), scn, conv.Chat().ID, conv.User().ID, "paid"))
+
+	timeline, err := history.Timeline(context.Background(), scenario.HistoryQuery{ChatID: conv.Chat().ID, UserID: conv.User().ID})
+	require.NoError(t, err)
+	var got [][3]string
+	for _, tr := range timeline {
+		got = append(got, [3]string{tr.FromState, tr.ToState, tr.Reason})
+	}
+	assert.Equal(t, [][3]string{
+		{"", "", scenario.ReasonEnter},
+		{"draft", "draft", "event:add"},
+		{"draft", "awaiting_payment", "event:pay"},
+		{"awaiting_payment", "paid", "event:paid"},
+		{"", "", scenario.ReasonCompleted},
+	}, got)
+}
+
+func TestFSMSceneFireConcurrent(t *testing.T) {
+	bot, scn, fsm := newOrderBot(t)
+	conv := bot.Conversation(scn).Send("/order").ExpectReply("Черновик заказа")
+
+	// events and updates of the session don't overwrite each other
+	const n = 20
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, fsm.Fire(context.Background(), scn, conv.Chat().ID, conv.User().ID, "add"))
+		}()
+		go func() {
+			defer wg.Done()
+			bot.ProcessUpdate(tele.Update{Message: &tele.Message{Chat: conv.Chat(), Sender: conv.User(), Text: "add"}})
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, bot.Errors())
+	assert.Equal(t, 2*n, scenariotest.Session[order](conv).Data.Items)
+}
+
+func TestFSMSceneFireWithoutBot(t *testing.T) {
+	scn := scenario.New(nil)
+	fsm := newOrderFSM()
+	scn.Use(fsm)
+
+	assert.ErrorIs(t, fsm.Fire(context.Background(), scn, 1, 2, "paid"), scenario.ErrNoBot)
+}
+
+func TestFSMSceneAnyState(t *testing.T) {
+	bot, scn, _ := newOrderBot(t)
+
+	bot.Conversation(scn).
+		Send("/order").ExpectReply("Черновик заказа").
+		Send("/cancel").ExpectReply("Заказ отменён").ExpectScene("")
+}
+
+func TestFSMSceneTable(t *testing.T) {
+	fsm := newOrderFSM()
+
+	assert.Len(t, fsm.Table(), 4)
+	assert.Equal(t, `| From | Event | Guard | To |
+|------|-------|-------|----|
+| draft | add |  | draft |
+| draft | pay | has items | awaiting_payment |
+| awaiting_payment | paid |  | paid |
+| * | /cancel |  | cancelled |
+`, fsm.TransitionTable())
+
+	assert.Equal(t, []string{"draft", "awaiting_payment", "paid", "cancelled"}, fsm.Steps())
+	edges := fsm.Transitions()
+	assert.Len(t, edges, 3+4) // the wildcard expands to every state
+	assert.Equal(t, scenario.Edge{From: "order", FromStep: 0, To: "order", ToStep: 1, Label: "pay [has items]"}, edges[1])
+}
+
+func TestFSMSceneValidate(t *testing.T) {
+	fsm := scenario.NewFSM[order]("order", "draft").
+		Final("done").
+		On("draft", "go", "nowhere").
+		On("done", "back", "draft")
+
+	err := fsm.Validate()
+	assert.ErrorIs(t, err, scenario.ErrInvalidScene)
+	assert.Contains(t, err.Error(), `unknown state "nowhere"`)
+	assert.Contains(t, err.Error(), `from final state "done"`)
+}
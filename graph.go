@@ -0,0 +1,245 @@
+package scenario
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Graph formats supported by Scenario.WriteGraph.
+const (
+	GraphMermaid = "mermaid"
+	GraphDOT     = "dot"
+)
+
+// NoStep marks an edge end that refers to a whole scene rather than a wizard step.
+const NoStep = -1
+
+// Edge is a declared transition. Empty From is an entry point outside of scenes,
+// e.g. a command handler; Label describes the trigger.
+type Edge struct {
+	From     SceneName
+	FromStep int
+	To       SceneName
+	ToStep   int
+	Label    string
+}
+
+// GraphNode is a scene of the graph with its named steps, if any.
+type GraphNode struct {
+	Scene SceneName
+	Steps []string
+}
+
+// Graph is the registry of scenes and declared transitions between them.
+type Graph struct {
+	Nodes []GraphNode
+	Edges []Edge
+}
+
+// DeclaringScene is implemented by scenes that declare their steps and transitions.
+type DeclaringScene interface {
+	Scene
+	// Steps returns step names, nil for scenes without steps.
+	Steps() []string
+	// Transitions returns transitions the scene may perform.
+	Transitions() []Edge
+}
+
+// Declare registers a transition performed outside of scenes, e.g. by a command handler.
+// Use an empty from for entry points.
+func (s *Scenario) Declare(from, to SceneName, label string) *Scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.edges = append(s.edges, Edge{From: from, FromStep: NoStep, To: to, ToStep: NoStep, Label: label})
+	return s
+}
+
+// Graph returns registered scenes and declared transitions ordered by scene name.
+func (s *Scenario) Graph() Graph {
+	var g Graph
+
+	s.mu.RLock()
+	g.Edges = append(g.Edges, s.edges...)
+	commands := make([]string, 0, len(s.commands))
+	for command := range s.commands {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		g.Edges = append(g.Edges, Edge{From: "", FromStep: NoStep, To: s.commands[command], ToStep: NoStep, Label: command})
+	}
+	s.mu.RUnlock()
+
+	for _, name := range s.sceneNames() {
+		node := GraphNode{Scene: name}
+		sc, _ := s.scene(name)
+		if ds, ok := sc.(DeclaringScene); ok {
+			node.Steps = ds.Steps()
+			g.Edges = append(g.Edges, ds.Transitions()...)
+		}
+		g.Nodes = append(g.Nodes, node)
+	}
+
+	return g
+}
+
+// WriteGraph writes the scene graph in GraphMermaid or GraphDOT format.
+func (s *Scenario) WriteGraph(w io.Writer, format string) error {
+	var out string
+	switch format {
+	case GraphMermaid:
+		out = s.Graph().Mermaid()
+	case GraphDOT:
+		out = s.Graph().DOT()
+	default:
+		return fmt.Errorf("unknown graph format %q", format)
+	}
+	_, err := io.WriteString(w, out)
+	return err
+}
+
+// Mermaid renders the graph as a Mermaid flowchart. Wizard steps are grouped into subgraphs.
+func (g Graph) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+
+	steps := g.stepCounts()
+	for _, node := range g.Nodes {
+		id := nodeID(node.Scene)
+		if len(node.Steps) == 0 {
+			fmt.Fprintf(&b, "    %s[%s]\n", id, strconv.Quote(string(node.Scene)))
+			continue
+		}
+		fmt.Fprintf(&b, "    subgraph %s [%s]\n", id, strconv.Quote(string(node.Scene)))
+		for i, step := range node.Steps {
+			fmt.Fprintf(&b, "        %s[%s]\n", stepID(node.Scene, i), strconv.Quote(stepLabel(i, step)))
+		}
+		b.WriteString("    end\n")
+	}
+
+	for _, e := range g.Edges {
+		from := g.endID(e.From, e.FromStep, steps)
+		if e.From == "" {
+			from = "start((start))"
+		}
+		arrow := "-->"
+		if e.Label != "" {
+			arrow = "-->|" + strconv.Quote(e.Label) + "|"
+		}
+		fmt.Fprintf(&b, "    %s %s %s\n", from, arrow, g.endID(e.To, e.ToStep, steps))
+	}
+
+	return b.String()
+}
+
+// DOT renders the graph in Graphviz format. Wizard steps are grouped into clusters.
+func (g Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph scenes {\n    compound=true;\n    node [shape=box];\n")
+
+	steps := g.stepCounts()
+	for _, node := range g.Nodes {
+		id := nodeID(node.Scene)
+		if len(node.Steps) == 0 {
+			fmt.Fprintf(&b, "    %s [label=%s];\n", id, strconv.Quote(string(node.Scene)))
+			continue
+		}
+		fmt.Fprintf(&b, "    subgraph cluster_%s {\n        label=%s;\n", id, strconv.Quote(string(node.Scene)))
+		for i, step := range node.Steps {
+			fmt.Fprintf(&b, "        %s [label=%s];\n", stepID(node.Scene, i), strconv.Quote(stepLabel(i, step)))
+		}
+		b.WriteString("    }\n")
+	}
+
+	hasStart := false
+	for _, e := range g.Edges {
+		if e.From == "" && !hasStart {
+			b.WriteString("    start [shape=circle];\n")
+			hasStart = true
+		}
+
+		from, ltail := g.dotEnd(e.From, e.FromStep, steps)
+		to, lhead := g.dotEnd(e.To, e.ToStep, steps)
+		if e.From == "" {
+			from, ltail = "start", ""
+		}
+
+		var attrs []string
+		if e.Label != "" {
+			attrs = append(attrs, "label="+strconv.Quote(e.Label))
+		}
+		if ltail != "" {
+			attrs = append(attrs, "ltail="+ltail)
+		}
+		if lhead != "" {
+			attrs = append(attrs, "lhead="+lhead)
+		}
+
+		fmt.Fprintf(&b, "    %s -> %s", from, to)
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (g Graph) stepCounts() map[SceneName]int {
+	counts := make(map[SceneName]int, len(g.Nodes))
+	for _, node := range g.Nodes {
+		counts[node.Scene] = len(node.Steps)
+	}
+	return counts
+}
+
+// endID returns the Mermaid id of an edge end: a step node or the scene node (subgraph).
+func (g Graph) endID(scene SceneName, step int, steps map[SceneName]int) string {
+	if step >= 0 && step < steps[scene] {
+		return stepID(scene, step)
+	}
+	return nodeID(scene)
+}
+
+// dotEnd returns the DOT node of an edge end. Edges to a whole wizard are drawn
+// to its first step and clipped at the cluster border.
+func (g Graph) dotEnd(scene SceneName, step int, steps map[SceneName]int) (id, cluster string) {
+	n := steps[scene]
+	switch {
+	case n == 0:
+		return nodeID(scene), ""
+	case step >= 0 && step < n:
+		return stepID(scene, step), ""
+	default:
+		return stepID(scene, 0), "cluster_" + nodeID(scene)
+	}
+}
+
+// nodeID makes a scene name safe to use as a Mermaid or DOT identifier.
+func nodeID(scene SceneName) string {
+	var b strings.Builder
+	b.WriteString("scene_")
+	for _, r := range string(scene) {
+		if r < 128 && (r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			b.WriteRune(r)
+		} else {
+			fmt.Fprintf(&b, "_%x", r)
+		}
+	}
+	return b.String()
+}
+
+func stepID(scene SceneName, step int) string {
+	return nodeID(scene) + "__" + strconv.Itoa(step)
+}
+
+func stepLabel(i int, name string) string {
+	if name == "" {
+		return "step " + strconv.Itoa(i)
+	}
+	return strconv.Itoa(i) + ": " + name
+}
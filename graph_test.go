@@ -0,0 +1,75 @@
+package scenario
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGraphScenario() *Scenario {
+	type Data struct{}
+	step := func(c *Context[Data]) (bool, error) { return true, nil }
+
+	scenario := New(nil)
+	scenario.Use(NewWizard[Data]("register", step, step, step).
+		WithStepNames("name", "", "confirm").
+		DeclareBranch(2, 0, "edit").
+		DeclareEnter(2, "main menu", "done"))
+	scenario.Use(NewWizard[Data]("main menu"))
+	scenario.Declare("", "register", "/start")
+	return scenario
+}
+
+func TestScenarioGraph(t *testing.T) {
+	g := newGraphScenario().Graph()
+
+	require.Len(t, g.Nodes, 2)
+	assert.Equal(t, SceneName("main menu"), g.Nodes[0].Scene)
+	assert.Empty(t, g.Nodes[0].Steps)
+	assert.Equal(t, []string{"name", "", "confirm"}, g.Nodes[1].Steps)
+
+	assert.Equal(t, []Edge{
+		{From: "", FromStep: NoStep, To: "register", ToStep: NoStep, Label: "/start"},
+		{From: "register", FromStep: 0, To: "register", ToStep: 1},
+		{From: "register", FromStep: 1, To: "register", ToStep: 2},
+		{From: "register", FromStep: 2, To: "register", ToStep: 0, Label: "edit"},
+		{From: "register", FromStep: 2, To: "main menu", ToStep: NoStep, Label: "done"},
+	}, g.Edges)
+}
+
+func TestGraphMermaid(t *testing.T) {
+	out := newGraphScenario().Graph().Mermaid()
+
+	assert.Equal(t, `flowchart TD
+    scene_main_20menu["main menu"]
+    subgraph scene_register ["register"]
+        scene_register__0["0: name"]
+        scene_register__1["step 1"]
+        scene_register__2["2: confirm"]
+    end
+    start((start)) -->|"/start"| scene_register
+    scene_register__0 --> scene_register__1
+    scene_register__1 --> scene_register__2
+    scene_register__2 -->|"edit"| scene_register__0
+    scene_register__2 -->|"done"| scene_main_20menu
+`, out)
+}
+
+func TestGraphDOT(t *testing.T) {
+	out := newGraphScenario().Graph().DOT()
+
+	assert.True(t, strings.HasPrefix(out, "digraph scenes {\n"))
+	assert.Contains(t, out, `subgraph cluster_scene_register {`)
+	assert.Contains(t, out, `start -> scene_register__0 [label="/start", lhead=cluster_scene_register];`)
+	assert.Contains(t, out, `scene_register__2 -> scene_main_20menu [label="done"];`)
+	assert.Contains(t, out, "scene_register__0 -> scene_register__1;")
+}
+
+func TestWriteGraphUnknownFormat(t *testing.T) {
+	var b strings.Builder
+	assert.Error(t, New(nil).WriteGraph(&b, "svg"))
+	require.NoError(t, New(nil).WriteGraph(&b, GraphDOT))
+	assert.Equal(t, "digraph scenes {\n    compound=true;\n    node [shape=box];\n}\n", b.String())
+}
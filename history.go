@@ -0,0 +1,143 @@
+package scenario
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Transition reasons recorded by Scenario.
+const (
+	ReasonEnter     = "enter"
+	ReasonStep      = "step"
+	ReasonLeave     = "leave"
+	ReasonCancel    = "cancel"
+	ReasonCompleted = "completed"
+	// ReasonEvent prefixes FSM transitions, recorded as "event:<name>".
+	ReasonEvent = "event"
+)
+
+// Transition is a single record of the scene audit log.
+type Transition struct {
+	Time     time.Time `json:"time" db:"created_at"`
+	ChatID   int64     `json:"chat_id" db:"chat_id"`
+	UserID   int64     `json:"user_id" db:"user_id"`
+	Scene    SceneName `json:"scene" db:"scene"`
+	FromStep int       `json:"from_step" db:"from_step"`
+	ToStep   int       `json:"to_step" db:"to_step"`
+	// FromState and ToState are states of an FSMScene, empty for other scenes.
+	FromState string          `json:"from_state,omitempty" db:"from_state"`
+	ToState   string          `json:"to_state,omitempty" db:"to_state"`
+	Reason    string          `json:"reason" db:"reason"`
+	Data      json.RawMessage `json:"data,omitempty" db:"data"`
+}
+
+// HistoryQuery selects transitions of one user in one chat.
+// Zero Since/Until are not applied, zero Limit returns all transitions.
+type HistoryQuery struct {
+	ChatID int64
+	UserID int64
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// HistoryStore is an append-only log of scene transitions.
+type HistoryStore interface {
+	AddTransition(ctx context.Context, t Transition) error
+	// Timeline returns transitions ordered by time, oldest first.
+	Timeline(ctx context.Context, q HistoryQuery) ([]Transition, error)
+}
+
+// WithHistory makes Scenario record scene transitions to history.
+// With snapshots every record also stores session data at the moment of transition.
+// Snapshots are written as is: with an encrypted store wrap history too, see encrypt.Storage.History.
+func (s *Scenario) WithHistory(history HistoryStore, snapshots bool) *Scenario {
+	s.history = history
+	s.historySnapshots = snapshots
+	return s
+}
+
+// record appends a transition to the history store if one is configured.
+// History failures are logged and don't interrupt the update.
+func (s *Scenario) record(ctx context.Context, base *SessionBase, scene SceneName, from, to int, reason string) {
+	if s.history == nil || base == nil {
+		return
+	}
+	s.addTransition(ctx, base, Transition{
+		Scene:    scene,
+		FromStep: from,
+		ToStep:   to,
+		Reason:   reason,
+	})
+}
+
+// recordState appends a transition between states of an FSM scene.
+func (s *Scenario) recordState(ctx context.Context, base *SessionBase, from, to, event string) {
+	if s.history == nil || base == nil {
+		return
+	}
+	s.addTransition(ctx, base, Transition{
+		Scene:     base.Scene,
+		FromStep:  base.Step,
+		ToStep:    base.Step,
+		FromState: from,
+		ToState:   to,
+		Reason:    ReasonEvent + ":" + event,
+	})
+}
+
+func (s *Scenario) addTransition(ctx context.Context, base *SessionBase, t Transition) {
+	t.Time, t.ChatID, t.UserID = time.Now(), base.ChatID, base.UserID
+	if s.historySnapshots {
+		t.Data = base.Data
+	}
+
+	if err := s.history.AddTransition(ctx, t); err != nil {
+		slog.ErrorContext(ctx, "failed to record scene transition", "error", err)
+	}
+}
+
+// MemoryHistory is an in-memory HistoryStore, useful for tests and small bots.
+type MemoryHistory struct {
+	mu          sync.RWMutex
+	transitions map[string][]Transition
+}
+
+// NewMemoryHistory .
+func NewMemoryHistory() *MemoryHistory {
+	return &MemoryHistory{transitions: make(map[string][]Transition)}
+}
+
+// AddTransition .
+func (h *MemoryHistory) AddTransition(_ context.Context, t Transition) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := key(t.ChatID, t.UserID)
+	h.transitions[k] = append(h.transitions[k], t)
+	return nil
+}
+
+// Timeline .
+func (h *MemoryHistory) Timeline(_ context.Context, q HistoryQuery) ([]Transition, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var result []Transition
+	for _, t := range h.transitions[key(q.ChatID, q.UserID)] {
+		if !q.Since.IsZero() && t.Time.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && !t.Time.Before(q.Until) {
+			continue
+		}
+		result = append(result, t)
+		if q.Limit > 0 && len(result) == q.Limit {
+			break
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,138 @@
+package scenario
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario/mocks"
+)
+
+func TestMemoryHistoryTimeline(t *testing.T) {
+	history := NewMemoryHistory()
+	ctx := context.Background()
+	start := time.Now()
+
+	for i := 0; i < 5; i++ {
+		err := history.AddTransition(ctx, Transition{
+			Time:   start.Add(time.Duration(i) * time.Minute),
+			ChatID: 1,
+			UserID: 2,
+			ToStep: i,
+			Reason: ReasonStep,
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, history.AddTransition(ctx, Transition{Time: start, ChatID: 1, UserID: 3}))
+
+	all, err := history.Timeline(ctx, HistoryQuery{ChatID: 1, UserID: 2})
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+
+	window, err := history.Timeline(ctx, HistoryQuery{
+		ChatID: 1,
+		UserID: 2,
+		Since:  start.Add(time.Minute),
+		Until:  start.Add(4 * time.Minute),
+		Limit:  2,
+	})
+	require.NoError(t, err)
+	require.Len(t, window, 2)
+	assert.Equal(t, 1, window[0].ToStep)
+	assert.Equal(t, 2, window[1].ToStep)
+}
+
+func TestScenarioRecordsWizardTransitions(t *testing.T) {
+	type TestData struct {
+		Name string `json:"name"`
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	text := "/start"
+	mockCtx := mocks.NewMockContext(ctrl)
+	mockCtx.EXPECT().Sender().Return(&tele.User{ID: 1}).AnyTimes()
+	mockCtx.EXPECT().Message().DoAndReturn(func() *tele.Message {
+		return &tele.Message{Text: text, Chat: &tele.Chat{ID: 2}}
+	}).AnyTimes()
+
+	history := NewMemoryHistory()
+	scenario := New(nil).WithHistory(history, true)
+	scenario.Use(NewWizard[TestData]("register",
+		func(c *Context[TestData]) (bool, error) {
+			if c.Message().Text == "/start" {
+				return false, nil
+			}
+			c.SetData(TestData{Name: c.Message().Text})
+			return true, nil
+		},
+		func(c *Context[TestData]) (bool, error) {
+			return true, nil
+		},
+	))
+
+	sceneCtx, err := NewContext[TestData](scenario, mockCtx)
+	require.NoError(t, err)
+	require.NoError(t, sceneCtx.Enter("register"))
+
+	middleware := scenario.Middleware(func(tele.Context) error { return nil })
+	text = "Bob"
+	require.NoError(t, middleware(mockCtx))
+	text = "done"
+	require.NoError(t, middleware(mockCtx))
+
+	timeline, err := history.Timeline(context.Background(), HistoryQuery{ChatID: 2, UserID: 1})
+	require.NoError(t, err)
+	require.Len(t, timeline, 3)
+
+	assert.Equal(t, ReasonEnter, timeline[0].Reason)
+	assert.Equal(t, SceneName("register"), timeline[0].Scene)
+	assert.Equal(t, -1, timeline[0].FromStep)
+	assert.Equal(t, 0, timeline[0].ToStep)
+
+	assert.Equal(t, ReasonStep, timeline[1].Reason)
+	assert.Equal(t, 0, timeline[1].FromStep)
+	assert.Equal(t, 1, timeline[1].ToStep)
+	assert.JSONEq(t, `{"name":"Bob"}`, string(timeline[1].Data))
+
+	assert.Equal(t, ReasonCompleted, timeline[2].Reason)
+	assert.Equal(t, 1, timeline[2].FromStep)
+	assert.Equal(t, -1, timeline[2].ToStep)
+}
+
+func TestScenarioRecordsCancel(t *testing.T) {
+	type TestData struct{}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockCtx := mocks.NewMockContext(ctrl)
+	mockCtx.EXPECT().Sender().Return(&tele.User{ID: 1}).AnyTimes()
+	mockCtx.EXPECT().Message().Return(&tele.Message{Text: "/cancel", Chat: &tele.Chat{ID: 2}}).AnyTimes()
+	mockCtx.EXPECT().Reply("Отменено").Return(nil)
+
+	history := NewMemoryHistory()
+	scenario := New(nil).WithHistory(history, false)
+	scenario.Use(NewWizard[TestData]("register", func(c *Context[TestData]) (bool, error) {
+		return false, nil
+	}))
+	require.NoError(t, scenario.store.SetSession(context.Background(), &SessionBase{
+		ChatID: 2,
+		UserID: 1,
+		Scene:  "register",
+	}))
+
+	require.NoError(t, scenario.Middleware(func(tele.Context) error { return nil })(mockCtx))
+
+	timeline, err := history.Timeline(context.Background(), HistoryQuery{ChatID: 2, UserID: 1})
+	require.NoError(t, err)
+	require.Len(t, timeline, 1)
+	assert.Equal(t, ReasonCancel, timeline[0].Reason)
+	assert.Empty(t, timeline[0].Data)
+}
@@ -0,0 +1,64 @@
+// Package demo holds sample scenes used by the commands of this module.
+package demo
+
+import (
+	"fmt"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+)
+
+// OrderData represents the data structure for the order scene.
+type OrderData struct {
+	Size string `json:"size"`
+	Name string `json:"name"`
+}
+
+// Register registers the demo scenes and their command handlers.
+func Register(bot *tele.Bot, scn *scenario.Scenario) {
+	sizes := &tele.ReplyMarkup{}
+	sizeBtn := sizes.Data("", "size")
+	sizes.Inline(sizes.Row(sizes.Data("S", "size", "S"), sizes.Data("M", "size", "M"), sizes.Data("L", "size", "L")))
+
+	scn.Use(scenario.NewWizard[OrderData]("order",
+		func(c *scenario.Context[OrderData]) (bool, error) {
+			if c.Callback() == nil {
+				return false, c.Send("Выберите размер", sizes)
+			}
+
+			c.SetData(OrderData{Size: c.Callback().Data})
+			if err := c.Respond(); err != nil {
+				return false, err
+			}
+			return true, c.Send("Как вас зовут?")
+		},
+		func(c *scenario.Context[OrderData]) (bool, error) {
+			name := strings.TrimSpace(c.Text())
+			if name == "" {
+				return false, c.Send("Как вас зовут?")
+			}
+
+			data := c.GetData()
+			data.Name = name
+			c.SetData(data)
+			return true, c.Send(fmt.Sprintf("Заказ принят: размер %s, %s", data.Size, data.Name))
+		},
+	).WithStepNames("size", "name"))
+
+	bot.Handle("/start", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[OrderData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("order")
+	})
+	scn.Declare("", "order", "/start")
+
+	// Fallback handlers to ensure scenario middleware receives updates
+	bot.Handle(&sizeBtn, func(tele.Context) error { return nil })
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	bot.Handle(tele.OnContact, func(tele.Context) error { return nil })
+	bot.Handle(tele.OnPhoto, func(tele.Context) error { return nil })
+}
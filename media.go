@@ -0,0 +1,284 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// ErrMediaRejected is returned when received files don't satisfy the media options.
+var ErrMediaRejected = errors.New("media rejected")
+
+// MediaKind is a kind of file accepted by MediaStep.
+type MediaKind string
+
+const (
+	MediaPhoto    MediaKind = "photo"
+	MediaDocument MediaKind = "document"
+	MediaVideo    MediaKind = "video"
+	MediaVoice    MediaKind = "voice"
+)
+
+// DefaultAlbumWait is how long MediaStep waits for the next part of an album.
+const DefaultAlbumWait = time.Second
+
+// Media is a file collected by MediaStep.
+type Media struct {
+	Kind     MediaKind `json:"kind"`
+	FileID   string    `json:"file_id"`
+	UniqueID string    `json:"unique_id,omitempty"`
+	FileName string    `json:"file_name,omitempty"`
+	MIME     string    `json:"mime,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	Caption  string    `json:"caption,omitempty"`
+}
+
+// MediaOptions constrains files accepted by MediaStep. Zero values don't restrict.
+type MediaOptions struct {
+	// Kinds are accepted kinds of files.
+	Kinds []MediaKind
+	// MIME are accepted MIME types, e.g. "application/pdf" or "image/*".
+	// Photos have type image/jpeg.
+	MIME []string
+	// MaxSize is the maximum size of a file in bytes.
+	MaxSize int64
+	// MinFiles and MaxFiles limit the number of files in one input.
+	MinFiles int
+	MaxFiles int
+	// AlbumWait is how long to wait for the next part of an album, DefaultAlbumWait by default.
+	AlbumWait time.Duration
+	// Invalid is sent when the input is rejected.
+	Invalid string
+	// Done is sent when the input is accepted, e.g. the prompt of the next step.
+	Done string
+
+	after func(d time.Duration, f func()) (stop func() bool) // album timer, set by tests
+}
+
+// Check returns ErrMediaRejected if files don't satisfy the options.
+func (o MediaOptions) Check(files []Media) error {
+	if len(files) == 0 || len(files) < o.MinFiles {
+		return fmt.Errorf("%w: %d file(s), at least %d expected", ErrMediaRejected, len(files), max(o.MinFiles, 1))
+	}
+	if o.MaxFiles > 0 && len(files) > o.MaxFiles {
+		return fmt.Errorf("%w: %d files, at most %d expected", ErrMediaRejected, len(files), o.MaxFiles)
+	}
+	for _, f := range files {
+		if len(o.Kinds) > 0 && !slices.Contains(o.Kinds, f.Kind) {
+			return fmt.Errorf("%w: %s is not accepted", ErrMediaRejected, f.Kind)
+		}
+		if o.MaxSize > 0 && f.Size > o.MaxSize {
+			return fmt.Errorf("%w: %s of %d bytes is larger than %d", ErrMediaRejected, f.Kind, f.Size, o.MaxSize)
+		}
+		if len(o.MIME) > 0 && !slices.ContainsFunc(o.MIME, func(pattern string) bool { return matchMIME(pattern, f.MIME) }) {
+			return fmt.Errorf("%w: type %q is not accepted", ErrMediaRejected, f.MIME)
+		}
+	}
+	return nil
+}
+
+func (o MediaOptions) invalid() string {
+	if o.Invalid != "" {
+		return o.Invalid
+	}
+	return "Этот файл не подходит, попробуйте ещё раз"
+}
+
+func (o MediaOptions) albumWait() time.Duration {
+	if o.AlbumWait > 0 {
+		return o.AlbumWait
+	}
+	return DefaultAlbumWait
+}
+
+func (o MediaOptions) afterFunc(d time.Duration, f func()) func() bool {
+	if o.after != nil {
+		return o.after(d, f)
+	}
+	return time.AfterFunc(d, f).Stop
+}
+
+// MediaStep returns a wizard step that accepts photos, documents, videos or voice
+// messages sent as one message or as an album. Parts of an album are aggregated
+// into one input once no new part arrives within AlbumWait; the album is handled
+// in turn with updates of the session. Accepted files are
+// passed to save with the session data, answered with Done and the wizard advances;
+// a rejected input is answered with Invalid.
+func MediaStep[T any](opts MediaOptions, save func(data *T, files []Media)) WizardStep[T] {
+	albums := newAlbumCollector()
+
+	return func(c *Context[T]) (bool, error) {
+		m := c.Message()
+		if m == nil {
+			return false, c.Send(opts.invalid())
+		}
+
+		file, ok := MediaOf(m)
+		if m.AlbumID != "" {
+			albumKey := key(c.chatID, c.userID) + ":" + m.AlbumID
+			if !ok {
+				// the album is complete, see flushAlbum
+				files, ready := albums.take(albumKey)
+				if !ready {
+					return false, nil
+				}
+				return acceptMedia(c, opts, files, save)
+			}
+			flush := &tele.Message{AlbumID: m.AlbumID, Chat: &tele.Chat{ID: c.chatID}, Sender: &tele.User{ID: c.userID}}
+			scene, step := c.Session.Scene, c.Session.Step
+			albums.add(albumKey, file, opts, func() { flushAlbum(c.Scenario, flush, scene, step, albumKey, albums) })
+			return false, nil
+		}
+
+		if !ok {
+			return false, c.Send(opts.invalid())
+		}
+		return acceptMedia(c, opts, []Media{file}, save)
+	}
+}
+
+func acceptMedia[T any](c *Context[T], opts MediaOptions, files []Media, save func(*T, []Media)) (bool, error) {
+	if err := opts.Check(files); err != nil {
+		return false, c.Send(opts.invalid())
+	}
+	data := c.GetData()
+	save(&data, files)
+	c.SetData(data)
+	if opts.Done == "" {
+		return true, nil
+	}
+	return true, c.Send(opts.Done)
+}
+
+// flushAlbum runs the step again with m, a message of the album without media, under
+// the lock of the session and with the session read anew, unless the user has moved on.
+func flushAlbum(s *Scenario, m *tele.Message, scene SceneName, step int, key string, albums *albumCollector) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sc, ok := s.scene(scene)
+	if !ok {
+		albums.drop(key)
+		return
+	}
+	dropped := false
+	_, err := s.runMessage(ctx, m, scene, func(sceneCtx ContextBase) error {
+		// dropped under the lock, parts of updates waiting for it start a new album
+		defer albums.drop(key)
+		dropped = true
+
+		base, err := sceneCtx.getSessionBase()
+		if err != nil || base.Step != step {
+			return err
+		}
+		return sc.OnUpdate(sceneCtx)
+	})
+	if !dropped {
+		albums.drop(key)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to handle album", "album", m.AlbumID, "error", err)
+	}
+}
+
+// MediaOf returns the photo, document, video or voice of m.
+func MediaOf(m *tele.Message) (Media, bool) {
+	switch {
+	case m.Photo != nil:
+		return Media{Kind: MediaPhoto, FileID: m.Photo.FileID, UniqueID: m.Photo.UniqueID, MIME: "image/jpeg", Size: m.Photo.FileSize, Caption: m.Caption}, true
+	case m.Document != nil:
+		d := m.Document
+		return Media{Kind: MediaDocument, FileID: d.FileID, UniqueID: d.UniqueID, FileName: d.FileName, MIME: d.MIME, Size: d.FileSize, Caption: m.Caption}, true
+	case m.Video != nil:
+		v := m.Video
+		return Media{Kind: MediaVideo, FileID: v.FileID, UniqueID: v.UniqueID, FileName: v.FileName, MIME: v.MIME, Size: v.FileSize, Caption: m.Caption}, true
+	case m.Voice != nil:
+		v := m.Voice
+		return Media{Kind: MediaVoice, FileID: v.FileID, UniqueID: v.UniqueID, MIME: v.MIME, Size: v.FileSize, Caption: m.Caption}, true
+	}
+	return Media{}, false
+}
+
+func matchMIME(pattern, mime string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mime, prefix+"/")
+	}
+	return strings.EqualFold(pattern, mime)
+}
+
+// albumCollector buffers album parts in memory until the album is complete.
+type albumCollector struct {
+	mu     sync.Mutex
+	albums map[string]*album
+}
+
+type album struct {
+	files []Media
+	stop  func() bool
+	gen   int  // number of the last timer, only it may flush
+	ready bool // the album is being flushed
+}
+
+func newAlbumCollector() *albumCollector {
+	return &albumCollector{albums: make(map[string]*album)}
+}
+
+// add buffers a part and restarts the debounce timer calling flush.
+func (a *albumCollector) add(key string, file Media, opts MediaOptions, flush func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	al, ok := a.albums[key]
+	if !ok {
+		al = &album{}
+		a.albums[key] = al
+	} else {
+		al.stop()
+	}
+	al.files = append(al.files, file)
+	al.gen++
+	gen := al.gen
+	al.stop = opts.afterFunc(opts.albumWait(), func() {
+		if a.ready(key, gen) {
+			flush()
+		}
+	})
+}
+
+// ready marks the album as flushed by timer gen. A timer that fired before it was
+// stopped by a later part isn't the last one and doesn't flush.
+func (a *albumCollector) ready(key string, gen int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	al, ok := a.albums[key]
+	if !ok || al.gen != gen || al.ready {
+		return false
+	}
+	al.ready = true
+	return true
+}
+
+// take returns parts of a complete album.
+func (a *albumCollector) take(key string) ([]Media, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	al, ok := a.albums[key]
+	if !ok || !al.ready {
+		return nil, false
+	}
+	delete(a.albums, key)
+	return al.files, true
+}
+
+func (a *albumCollector) drop(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.albums, key)
+}
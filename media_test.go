@@ -0,0 +1,148 @@
+package scenario_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+type application struct {
+	Photos   []scenario.Media `json:"photos"`
+	Contract scenario.Media   `json:"contract"`
+}
+
+// albumTimers fires album timers on demand instead of after AlbumWait.
+type albumTimers struct {
+	mu     sync.Mutex
+	timers []func()
+}
+
+func (a *albumTimers) AfterFunc(_ time.Duration, f func()) func() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.timers = append(a.timers, f)
+	return func() bool { return true }
+}
+
+// fire runs all started timers, stopped ones too, as if they had fired before being stopped.
+func (a *albumTimers) fire() {
+	a.mu.Lock()
+	timers := a.timers
+	a.timers = nil
+	a.mu.Unlock()
+
+	for _, f := range timers {
+		f()
+	}
+}
+
+func newApplicationBot(t *testing.T) (*scenariotest.Bot, *scenario.Scenario, *albumTimers) {
+	timers := &albumTimers{}
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[application]("application",
+		func(c *scenario.Context[application]) (bool, error) {
+			return true, c.Send("Пришлите фото")
+		},
+		scenario.MediaStep(scenario.WithAlbumTimer(scenario.MediaOptions{
+			Kinds:    []scenario.MediaKind{scenario.MediaPhoto},
+			MaxFiles: 3,
+			Invalid:  "Нужно от 1 до 3 фото",
+			Done:     "Пришлите договор в PDF",
+		}, timers.AfterFunc), func(data *application, files []scenario.Media) {
+			data.Photos = files
+		}),
+		scenario.MediaStep(scenario.MediaOptions{
+			Kinds:   []scenario.MediaKind{scenario.MediaDocument},
+			MIME:    []string{"application/pdf"},
+			MaxSize: 1 << 20,
+			Done:    "Спасибо",
+		}, func(data *application, files []scenario.Media) {
+			data.Contract = files[0]
+		}),
+		func(c *scenario.Context[application]) (bool, error) {
+			return false, nil
+		},
+	))
+
+	bot.Handle("/apply", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[application](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("application")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	bot.Handle(tele.OnMedia, func(tele.Context) error { return nil })
+	return bot, scn, timers
+}
+
+func albumPhoto(albumID, fileID string) *tele.Message {
+	return &tele.Message{AlbumID: albumID, Photo: &tele.Photo{File: tele.File{FileID: fileID, UniqueID: fileID, FileSize: 100}}}
+}
+
+func TestMediaStepAlbum(t *testing.T) {
+	bot, scn, timers := newApplicationBot(t)
+
+	conv := bot.Conversation(scn).
+		Send("/apply").ExpectReply("Пришлите фото").
+		Send("вот").ExpectReply("Нужно от 1 до 3 фото").
+		SendMessage(albumPhoto("a1", "p1")).ExpectNoReply().
+		SendMessage(albumPhoto("a1", "p2")).ExpectNoReply().
+		ExpectStep(1)
+
+	// the timer of the first part was stopped by the second one, it doesn't flush even if fired
+	timers.timers[0]()
+	conv.ExpectStep(1)
+
+	// parts are aggregated into one input after the album wait, the next prompt follows
+	calls := len(bot.Calls())
+	timers.fire()
+	require.Len(t, bot.Calls(), calls+1)
+	assert.Equal(t, "Пришлите договор в PDF", bot.Calls()[calls].Text())
+	conv.ExpectStep(2)
+	assert.Equal(t, []scenario.Media{
+		{Kind: scenario.MediaPhoto, FileID: "p1", UniqueID: "p1", MIME: "image/jpeg", Size: 100},
+		{Kind: scenario.MediaPhoto, FileID: "p2", UniqueID: "p2", MIME: "image/jpeg", Size: 100},
+	}, scenariotest.Session[application](conv).Data.Photos)
+
+	conv.SendDocument("d1", "contract.docx", "application/msword").ExpectReply("Этот файл не подходит, попробуйте ещё раз").
+		SendDocument("d2", "contract.pdf", "application/pdf").ExpectReply("Спасибо").
+		ExpectStep(3)
+	assert.Equal(t, "d2", scenariotest.Session[application](conv).Data.Contract.FileID)
+}
+
+func TestMediaStepAlbumTooLarge(t *testing.T) {
+	bot, scn, timers := newApplicationBot(t)
+
+	conv := bot.Conversation(scn).Send("/apply").ExpectReply("Пришлите фото")
+	calls := len(bot.Calls())
+	for _, id := range []string{"p1", "p2", "p3", "p4"} {
+		conv.SendMessage(albumPhoto("a1", id)).ExpectNoReply()
+	}
+
+	// the album is flushed once, though every part started a timer
+	timers.fire()
+	require.Len(t, bot.Calls(), calls+1)
+	assert.Equal(t, "Нужно от 1 до 3 фото", bot.Calls()[calls].Text())
+	conv.ExpectStep(1)
+}
+
+func TestMediaOptionsCheck(t *testing.T) {
+	opts := scenario.MediaOptions{MIME: []string{"image/*"}, MaxSize: 10, MinFiles: 2}
+	photo := scenario.Media{Kind: scenario.MediaPhoto, MIME: "image/jpeg", Size: 5}
+
+	assert.NoError(t, opts.Check([]scenario.Media{photo, photo}))
+	assert.ErrorIs(t, opts.Check([]scenario.Media{photo}), scenario.ErrMediaRejected)
+	assert.ErrorIs(t, opts.Check([]scenario.Media{photo, {MIME: "video/mp4"}}), scenario.ErrMediaRejected)
+	assert.ErrorIs(t, opts.Check([]scenario.Media{photo, {MIME: "image/png", Size: 11}}), scenario.ErrMediaRejected)
+}
@@ -0,0 +1,438 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// menuUnique is the unique of MenuScene buttons, callback data is "\fm|op|args".
+const menuUnique = "m"
+
+// Callback operations of MenuScene buttons.
+const (
+	menuOpen  = "o"
+	menuPage  = "p"
+	menuBack  = "b"
+	menuClose = "c"
+)
+
+// MenuItem is a button produced by MenuNode.Items.
+type MenuItem struct {
+	ID    string
+	Title string
+}
+
+// MenuNode is a node of a MenuScene tree. A node opens when its button is pressed
+// and renders its text with buttons of Children followed by Items, paginated.
+// A node with Action runs it instead of opening.
+// arg is the ID of the item the node was opened with, children inherit it.
+// IDs of nodes and items must fit into callback data (64 bytes with the node ID),
+// item IDs must not contain "|"; otherwise rendering the node fails.
+type MenuNode[T any] struct {
+	ID    string
+	Title string
+	Text  string
+	// Render returns the text of the node instead of Text.
+	Render func(c *Context[T], arg string) (string, error)
+	// Children are static submenus.
+	Children []*MenuNode[T]
+	// Items returns dynamic buttons, each opens Item with the item ID as arg.
+	Items func(c *Context[T], arg string) ([]MenuItem, error)
+	Item  *MenuNode[T]
+	// Action is called when the button of the node is pressed. The current node is
+	// rendered again afterwards unless the action left the scene.
+	Action func(c *Context[T], arg string) error
+}
+
+func (n *MenuNode[T]) text(c *Context[T], arg string) (string, error) {
+	if n.Render != nil {
+		return n.Render(c, arg)
+	}
+	return n.Text, nil
+}
+
+// menuFrame is an open node in the navigation stack kept in session meta.
+type menuFrame struct {
+	Node string `json:"node"`
+	Arg  string `json:"arg,omitempty"`
+	Page int    `json:"page,omitempty"`
+}
+
+// MenuScene is a scene of hierarchical inline menus rendered in a single message
+// with Context.Render. Callbacks of its buttons are routed to nodes and answered;
+// the navigation stack and the current page are kept in the session.
+// T is the type of data stored in the session.
+type MenuScene[T any] struct {
+	name  SceneName
+	root  *MenuNode[T]
+	nodes map[string]*MenuNode[T]
+	dups  []string
+
+	pageSize  int
+	columns   int
+	backText  string
+	prevText  string
+	nextText  string
+	closeText string
+	onMessage func(*Context[T]) error
+	cleanup   *CleanupPolicy
+	rateLimit *RateLimit
+}
+
+// NewMenu creates a menu scene opening root on enter.
+func NewMenu[T any](name SceneName, root *MenuNode[T]) *MenuScene[T] {
+	m := &MenuScene[T]{
+		name:     name,
+		root:     root,
+		nodes:    make(map[string]*MenuNode[T]),
+		pageSize: 8,
+		columns:  1,
+		backText: "« Назад",
+		prevText: "‹",
+		nextText: "›",
+	}
+	m.index(root)
+	return m
+}
+
+func (m *MenuScene[T]) index(n *MenuNode[T]) {
+	if n == nil {
+		return
+	}
+	if _, ok := m.nodes[n.ID]; ok {
+		m.dups = append(m.dups, n.ID)
+		return
+	}
+	m.nodes[n.ID] = n
+	for _, child := range n.Children {
+		m.index(child)
+	}
+	m.index(n.Item)
+}
+
+// Name returns the scene name.
+func (m *MenuScene[T]) Name() SceneName { return m.name }
+
+// WithPageSize sets how many buttons of a node are shown per page, 8 by default.
+func (m *MenuScene[T]) WithPageSize(size int) *MenuScene[T] {
+	if size > 0 {
+		m.pageSize = size
+	}
+	return m
+}
+
+// WithColumns sets how many buttons are shown in a row, 1 by default.
+func (m *MenuScene[T]) WithColumns(columns int) *MenuScene[T] {
+	if columns > 0 {
+		m.columns = columns
+	}
+	return m
+}
+
+// WithLabels sets texts of the back, previous page and next page buttons.
+func (m *MenuScene[T]) WithLabels(back, prev, next string) *MenuScene[T] {
+	m.backText, m.prevText, m.nextText = back, prev, next
+	return m
+}
+
+// WithClose adds a button leaving the scene to the root node.
+func (m *MenuScene[T]) WithClose(text string) *MenuScene[T] {
+	m.closeText = text
+	return m
+}
+
+// OnMessage sets a handler for messages sent while the menu is open, e.g. a search query.
+// Messages are ignored by default.
+func (m *MenuScene[T]) OnMessage(fn func(*Context[T]) error) *MenuScene[T] {
+	m.onMessage = fn
+	return m
+}
+
+// WithCleanup sets which messages of the scene are removed when the user leaves it.
+func (m *MenuScene[T]) WithCleanup(policy CleanupPolicy) *MenuScene[T] {
+	m.cleanup = &policy
+	return m
+}
+
+// CleanupPolicy returns the policy set by WithCleanup.
+func (m *MenuScene[T]) CleanupPolicy() *CleanupPolicy { return m.cleanup }
+
+// WithRateLimit limits updates in the scene on top of the rate limit of the scenario.
+func (m *MenuScene[T]) WithRateLimit(limit RateLimit) *MenuScene[T] {
+	m.rateLimit = &limit
+	return m
+}
+
+// RateLimit returns the limit set by WithRateLimit.
+func (m *MenuScene[T]) RateLimit() *RateLimit { return m.rateLimit }
+
+// Steps returns IDs of the nodes.
+func (m *MenuScene[T]) Steps() []string {
+	var ids []string
+	var walk func(n *MenuNode[T])
+	walk = func(n *MenuNode[T]) {
+		if n == nil || slices.Contains(ids, n.ID) {
+			return
+		}
+		ids = append(ids, n.ID)
+		for _, child := range n.Children {
+			walk(child)
+		}
+		walk(n.Item)
+	}
+	walk(m.root)
+	return ids
+}
+
+// Transitions returns nil, a menu doesn't enter other scenes by itself.
+func (m *MenuScene[T]) Transitions() []Edge { return nil }
+
+// Validate checks that the menu has a root and nodes have unique IDs fitting into callback data.
+func (m *MenuScene[T]) Validate() error {
+	if m.root == nil {
+		return fmt.Errorf("%w: menu without root", ErrInvalidScene)
+	}
+	var errs []error
+	for _, id := range m.dups {
+		errs = append(errs, fmt.Errorf("%w: duplicate menu node %q", ErrInvalidScene, id))
+	}
+	for id, n := range m.nodes {
+		switch {
+		case id == "" || strings.Contains(id, "|"):
+			errs = append(errs, fmt.Errorf("%w: invalid menu node ID %q", ErrInvalidScene, id))
+		case len(id) > 32:
+			errs = append(errs, fmt.Errorf("%w: menu node ID %q is longer than 32 bytes", ErrInvalidScene, id))
+		}
+		if n.Items != nil && n.Item == nil {
+			errs = append(errs, fmt.Errorf("%w: menu node %q has Items without Item", ErrInvalidScene, id))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CreateContext creates a typed Context[T] from SessionBase.
+func (m *MenuScene[T]) CreateContext(scenario *Scenario, c tele.Context, base *SessionBase) (ContextBase, error) {
+	sess, err := fromBase[T](base, scenario.codecs)
+	if err != nil {
+		return nil, fmt.Errorf("fromBase[%T]: %w", *new(T), err)
+	}
+	return newCtx(scenario, c, sess), nil
+}
+
+// Enter opens the root node.
+func (m *MenuScene[T]) Enter(c ContextBase) error {
+	ctx, ok := c.(*Context[T])
+	if !ok {
+		return fmt.Errorf("MenuScene[%T]: expected Context[%T], got %T", *new(T), *new(T), c)
+	}
+	if m.root == nil {
+		return fmt.Errorf("%w: menu without root", ErrInvalidScene)
+	}
+	ctx.Session.Step = 0
+	meta := ctx.meta()
+	meta.Menu = []menuFrame{{Node: m.root.ID}}
+	ctx.setMeta(meta)
+	return m.render(ctx)
+}
+
+// OnUpdate routes a callback of a menu button, answering it even if handling fails.
+func (m *MenuScene[T]) OnUpdate(c ContextBase) (err error) {
+	ctx, ok := c.(*Context[T])
+	if !ok {
+		return fmt.Errorf("MenuScene[%T]: expected Context[%T], got %T", *new(T), *new(T), c)
+	}
+
+	cb := ctx.Callback()
+	if cb == nil {
+		if m.onMessage != nil {
+			return m.onMessage(ctx)
+		}
+		return nil
+	}
+	defer func() {
+		// the button keeps its spinner until the callback is answered
+		if respErr := ctx.Respond(); err == nil {
+			err = respErr
+		}
+	}()
+	return m.handle(ctx, cb)
+}
+
+func (m *MenuScene[T]) handle(ctx *Context[T], cb *tele.Callback) error {
+	op, args, ok := parseMenuData(cb)
+	if !ok {
+		return nil
+	}
+
+	meta := ctx.meta()
+	if len(meta.Menu) == 0 {
+		meta.Menu = []menuFrame{{Node: m.root.ID}}
+	}
+	top := &meta.Menu[len(meta.Menu)-1]
+
+	switch op {
+	case menuOpen:
+		if len(args) < 1 {
+			return nil
+		}
+		node, ok := m.nodes[args[0]]
+		if !ok {
+			break // a button of a removed node, render the current one
+		}
+		arg := ""
+		if len(args) > 1 {
+			arg = args[1]
+		}
+		if node.Action != nil {
+			if err := node.Action(ctx, arg); err != nil {
+				return err
+			}
+			if ctx.Session.Scene != m.name {
+				return nil
+			}
+			meta = ctx.meta() // the action may have changed meta
+			break
+		}
+		meta.Menu = append(meta.Menu, menuFrame{Node: node.ID, Arg: arg})
+	case menuPage:
+		if len(args) > 0 {
+			page, _ := strconv.Atoi(args[0])
+			top.Page = max(page, 0)
+		}
+	case menuBack:
+		if len(meta.Menu) > 1 {
+			meta.Menu = meta.Menu[:len(meta.Menu)-1]
+		}
+	case menuClose:
+		return ctx.Leave()
+	}
+
+	ctx.setMeta(meta)
+	return m.render(ctx)
+}
+
+// Leave clears the navigation stack.
+func (m *MenuScene[T]) Leave(c ContextBase) error {
+	ctx, ok := c.(*Context[T])
+	if !ok {
+		return fmt.Errorf("MenuScene[%T]: expected Context[%T], got %T", *new(T), *new(T), c)
+	}
+	ctx.Session.Step = -1
+	meta := ctx.meta()
+	meta.Menu = nil
+	ctx.setMeta(meta)
+	return nil
+}
+
+func (m *MenuScene[T]) passiveEnter() {}
+
+// render shows the node on top of the navigation stack.
+func (m *MenuScene[T]) render(ctx *Context[T]) error {
+	meta := ctx.meta()
+	frame := menuFrame{Node: m.root.ID}
+	if len(meta.Menu) > 0 {
+		frame = meta.Menu[len(meta.Menu)-1]
+	}
+	node, ok := m.nodes[frame.Node]
+	if !ok {
+		node, frame = m.root, menuFrame{Node: m.root.ID}
+	}
+
+	text, err := node.text(ctx, frame.Arg)
+	if err != nil {
+		return err
+	}
+	buttons, err := m.buttons(ctx, node, frame.Arg)
+	if err != nil {
+		return err
+	}
+
+	markup := &tele.ReplyMarkup{}
+	pages := max((len(buttons)+m.pageSize-1)/m.pageSize, 1)
+	page := min(frame.Page, pages-1)
+	start := page * m.pageSize
+	rows := markup.Split(m.columns, buttons[start:min(start+m.pageSize, len(buttons))])
+
+	var nav tele.Row
+	if page > 0 {
+		nav = append(nav, markup.Data(m.prevText, menuUnique, menuPage, strconv.Itoa(page-1)))
+	}
+	if page < pages-1 {
+		nav = append(nav, markup.Data(m.nextText, menuUnique, menuPage, strconv.Itoa(page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	switch {
+	case len(meta.Menu) > 1:
+		rows = append(rows, markup.Row(markup.Data(m.backText, menuUnique, menuBack)))
+	case m.closeText != "":
+		rows = append(rows, markup.Row(markup.Data(m.closeText, menuUnique, menuClose)))
+	}
+	markup.Inline(rows...)
+
+	return ctx.Render(text, markup)
+}
+
+func (m *MenuScene[T]) buttons(ctx *Context[T], node *MenuNode[T], arg string) ([]tele.Btn, error) {
+	var buttons []tele.Btn
+	for _, child := range node.Children {
+		btn, err := menuButton(child.Title, child.ID, arg)
+		if err != nil {
+			return nil, err
+		}
+		buttons = append(buttons, btn)
+	}
+	if node.Items != nil && node.Item != nil {
+		items, err := node.Items(ctx, arg)
+		if err != nil {
+			return nil, fmt.Errorf("menu node %q items: %w", node.ID, err)
+		}
+		for _, item := range items {
+			btn, err := menuButton(item.Title, node.Item.ID, item.ID)
+			if err != nil {
+				return nil, fmt.Errorf("menu node %q items: %w", node.ID, err)
+			}
+			buttons = append(buttons, btn)
+		}
+	}
+	return buttons, nil
+}
+
+// maxCallbackData is the limit of callback data set by Telegram.
+const maxCallbackData = 64
+
+// menuButton returns a button opening the node with arg, an item ID.
+func menuButton(title, node, arg string) (tele.Btn, error) {
+	if strings.Contains(arg, "|") {
+		return tele.Btn{}, fmt.Errorf("%w: menu item ID %q contains \"|\"", ErrInvalidScene, arg)
+	}
+	btn := (&tele.ReplyMarkup{}).Data(title, menuUnique, menuOpen, node, arg)
+	if size := len("\f" + btn.Unique + "|" + btn.Data); size > maxCallbackData {
+		return tele.Btn{}, fmt.Errorf("%w: callback data of menu item %q is %d bytes, more than %d",
+			ErrInvalidScene, arg, size, maxCallbackData)
+	}
+	return btn, nil
+}
+
+// parseMenuData parses callback data of a menu button. The unique is still
+// in Data unless a handler is registered for it.
+func parseMenuData(cb *tele.Callback) (op string, args []string, ok bool) {
+	data := cb.Data
+	if cb.Unique == "" {
+		var found bool
+		data, found = strings.CutPrefix(data, "\f"+menuUnique+"|")
+		if !found {
+			return "", nil, false
+		}
+	} else if cb.Unique != menuUnique {
+		return "", nil, false
+	}
+	parts := strings.Split(data, "|")
+	return parts[0], parts[1:], parts[0] != ""
+}
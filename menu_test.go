@@ -0,0 +1,236 @@
+package scenario_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+type cart struct {
+	Items []string `json:"items"`
+}
+
+var catalog = map[string][]scenario.MenuItem{
+	"fruit": {{ID: "apple", Title: "Яблоко"}, {ID: "pear", Title: "Груша"}, {ID: "plum", Title: "Слива"}},
+	"veg":   {{ID: "carrot", Title: "Морковь"}},
+}
+
+func newShopBot(t *testing.T) (*scenariotest.Bot, *scenario.Scenario, *scenario.MenuScene[cart]) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	product := &scenario.MenuNode[cart]{
+		ID: "product",
+		Render: func(c *scenario.Context[cart], arg string) (string, error) {
+			return "Товар: " + arg, nil
+		},
+		Children: []*scenario.MenuNode[cart]{{
+			ID:    "buy",
+			Title: "В корзину",
+			Action: func(c *scenario.Context[cart], arg string) error {
+				data := c.GetData()
+				data.Items = append(data.Items, arg)
+				c.SetData(data)
+				return nil
+			},
+		}},
+	}
+	menu := scenario.NewMenu[cart]("shop", &scenario.MenuNode[cart]{
+		ID:   "root",
+		Text: "Магазин",
+		Children: []*scenario.MenuNode[cart]{{
+			ID:    "catalog",
+			Title: "Каталог",
+			Text:  "Категории",
+			Items: func(*scenario.Context[cart], string) ([]scenario.MenuItem, error) {
+				return []scenario.MenuItem{{ID: "fruit", Title: "Фрукты"}, {ID: "veg", Title: "Овощи"}}, nil
+			},
+			Item: &scenario.MenuNode[cart]{
+				ID: "category",
+				Render: func(c *scenario.Context[cart], arg string) (string, error) {
+					return "Категория: " + arg, nil
+				},
+				Items: func(c *scenario.Context[cart], arg string) ([]scenario.MenuItem, error) {
+					return catalog[arg], nil
+				},
+				Item: product,
+			},
+		}},
+	}).WithPageSize(2).WithClose("Закрыть")
+	scn.Use(menu)
+
+	bot.Handle("/shop", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[cart](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("shop")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	bot.Handle(tele.OnCallback, func(tele.Context) error { return nil })
+	return bot, scn, menu
+}
+
+func buttonTexts(call scenariotest.Call) []string {
+	var texts []string
+	for _, row := range call.ReplyMarkup().InlineKeyboard {
+		for _, btn := range row {
+			texts = append(texts, btn.Text)
+		}
+	}
+	return texts
+}
+
+func TestMenuNavigation(t *testing.T) {
+	bot, scn, menu := newShopBot(t)
+	require.NoError(t, menu.Validate())
+
+	conv := bot.Conversation(scn).
+		Send("/shop").ExpectReply("Магазин").
+		PressButton("Каталог").ExpectReply("Категории").
+		PressButton("Фрукты").ExpectReplyFunc(func(call scenariotest.Call) error {
+		assert.Equal(t, "editMessageText", call.Method)
+		assert.Equal(t, "Категория: fruit", call.Text())
+		assert.Equal(t, []string{"Яблоко", "Груша", "›", "« Назад"}, buttonTexts(call))
+		return nil
+	}).
+		PressButton("›").ExpectReplyFunc(func(call scenariotest.Call) error {
+		assert.Equal(t, []string{"Слива", "‹", "« Назад"}, buttonTexts(call))
+		return nil
+	}).
+		PressButton("Слива").ExpectReply("Товар: plum").
+		PressButton("В корзину").ExpectReply("Товар: plum")
+	scenariotest.ExpectData(conv, cart{Items: []string{"plum"}})
+
+	// the page of the category is kept in the stack
+	conv.PressButton("« Назад").ExpectReplyFunc(func(call scenariotest.Call) error {
+		assert.Equal(t, []string{"Слива", "‹", "« Назад"}, buttonTexts(call))
+		return nil
+	}).
+		PressButton("« Назад").ExpectReply("Категории").
+		PressButton("« Назад").ExpectReply("Магазин").
+		PressButton("Закрыть").ExpectScene("")
+
+	var answered int
+	for _, call := range bot.Calls() {
+		if call.Method == "answerCallbackQuery" {
+			answered++
+		}
+	}
+	assert.Equal(t, 9, answered, "every press is answered")
+	assert.Empty(t, bot.Errors())
+}
+
+func TestMenuAnswersFailedPress(t *testing.T) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewMenu[cart]("shop", &scenario.MenuNode[cart]{
+		ID:   "root",
+		Text: "Магазин",
+		Children: []*scenario.MenuNode[cart]{{
+			ID:    "broken",
+			Title: "Сломано",
+			Action: func(*scenario.Context[cart], string) error {
+				return errors.New("out of stock")
+			},
+		}},
+	}))
+	bot.Handle("/shop", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[cart](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("shop")
+	})
+	bot.Handle(tele.OnCallback, func(tele.Context) error { return nil })
+
+	conv := bot.Conversation(scn).Send("/shop").ExpectReply("Магазин")
+	data := conv.Replies()[0].ReplyMarkup().InlineKeyboard[0][0].Data
+	bot.ProcessUpdate(tele.Update{Callback: &tele.Callback{ID: "cb", Sender: conv.User(), Data: data,
+		Message: &tele.Message{ID: conv.Replies()[0].MessageID, Chat: conv.Chat()}}})
+
+	calls := bot.Calls()
+	assert.Equal(t, "answerCallbackQuery", calls[len(calls)-1].Method)
+	require.Len(t, bot.Errors(), 1)
+	assert.ErrorContains(t, bot.Errors()[0], "out of stock")
+}
+
+func TestMenuStackPersisted(t *testing.T) {
+	bot, scn, _ := newShopBot(t)
+
+	conv := bot.Conversation(scn).
+		Send("/shop").ExpectReply("Магазин").
+		PressButton("Каталог").
+		PressButton("Овощи").ExpectReply("Категория: veg")
+	assert.JSONEq(t, `[{"node":"root"},{"node":"catalog"},{"node":"category","arg":"veg"}]`, menuStack(t, conv))
+
+	// a stale button of a removed node renders the current node
+	conv.Press("\fm|o|gone|").ExpectReply("Категория: veg")
+}
+
+func menuStack(t *testing.T, conv *scenariotest.Conversation) string {
+	var meta struct {
+		Menu []map[string]any `json:"menu"`
+	}
+	require.NoError(t, json.Unmarshal(scenariotest.Session[cart](conv).Meta, &meta))
+	raw, err := json.Marshal(meta.Menu)
+	require.NoError(t, err)
+	return string(raw)
+}
+
+func TestMenuValidate(t *testing.T) {
+	menu := scenario.NewMenu[cart]("broken", &scenario.MenuNode[cart]{
+		ID: "root",
+		Children: []*scenario.MenuNode[cart]{
+			{ID: "a|b"},
+			{ID: "root"},
+			{ID: "list", Items: func(*scenario.Context[cart], string) ([]scenario.MenuItem, error) { return nil, nil }},
+		},
+	})
+	assert.ErrorIs(t, menu.Validate(), scenario.ErrInvalidScene)
+	assert.ErrorContains(t, menu.Validate(), `duplicate menu node "root"`)
+	assert.ErrorContains(t, menu.Validate(), `invalid menu node ID "a|b"`)
+	assert.ErrorContains(t, menu.Validate(), `"list" has Items without Item`)
+}
+
+func TestMenuInvalidItemID(t *testing.T) {
+	for name, id := range map[string]string{
+		"separator": "a|b",
+		"too long":  strings.Repeat("x", 60),
+	} {
+		t.Run(name, func(t *testing.T) {
+			bot := scenariotest.NewBot(t)
+			scn := scenario.New(bot.Bot)
+			bot.Use(scn.Middleware)
+			scn.Use(scenario.NewMenu[cart]("list", &scenario.MenuNode[cart]{
+				ID:   "root",
+				Text: "Список",
+				Items: func(*scenario.Context[cart], string) ([]scenario.MenuItem, error) {
+					return []scenario.MenuItem{{ID: id, Title: "Элемент"}}, nil
+				},
+				Item: &scenario.MenuNode[cart]{ID: "item"},
+			}))
+
+			sceneCtx, err := scenario.NewContext[cart](scn, bot.NewContext(tele.Update{Message: &tele.Message{
+				Chat:   &tele.Chat{ID: 1},
+				Sender: &tele.User{ID: 1},
+			}}))
+			require.NoError(t, err)
+			err = sceneCtx.Enter("list")
+			assert.ErrorIs(t, err, scenario.ErrInvalidScene)
+			assert.ErrorContains(t, err, id)
+			assert.Empty(t, bot.Calls())
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package scenario
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// sessionMeta is state of the library kept in SessionBase.Meta.
+type sessionMeta struct {
+	Messages []int `json:"messages,omitempty"` // tracked messages, deleted on leave
+	Pinned   []int `json:"pinned,omitempty"`   // messages pinned in the scene
+	Keyboard bool  `json:"keyboard,omitempty"` // a reply keyboard was sent in the scene
+
+	Anchor   int   `json:"anchor,omitempty"`    // message edited by Context.Render
+	AnchorAt int64 `json:"anchor_at,omitempty"` // unix time the anchor was sent
+
+	Menu []menuFrame `json:"menu,omitempty"` // navigation stack of a MenuScene
+
+	Jobs []string `json:"job_ids,omitempty"` // jobs of Context.After, cancelled by the next update
+}
+
+// decodeMeta decodes Meta. Malformed meta is dropped, it's never worth failing an update.
+func decodeMeta(raw json.RawMessage) sessionMeta {
+	var meta sessionMeta
+	if hasData(raw) {
+		_ = json.Unmarshal(raw, &meta)
+	}
+	return meta
+}
+
+func encodeMeta(meta sessionMeta) json.RawMessage {
+	if reflect.ValueOf(meta).IsZero() {
+		return nil
+	}
+	raw, _ := json.Marshal(meta)
+	return raw
+}
+
+func (c *Context[T]) meta() sessionMeta {
+	return decodeMeta(c.Session.Meta)
+}
+
+func (c *Context[T]) setMeta(meta sessionMeta) {
+	c.Session.Meta = encodeMeta(meta)
+	c.markDirty()
+}
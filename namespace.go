@@ -0,0 +1,138 @@
+package scenario
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// SceneSlot is data a scene left in the session, kept in SessionBase.SceneData
+// until the scene is entered again.
+type SceneSlot struct {
+	Data        json.RawMessage `json:"data"`
+	Codec       string          `json:"codec,omitempty"`
+	DataVersion int             `json:"data_version,omitempty"`
+}
+
+// WithSceneNamespaces keeps data of every scene in its own slot, so scenes with
+// different data types don't overwrite each other. Data holds the slot of the
+// active scene: on leave or when switching scenes it's moved to SceneData,
+// or dropped if the scene DataPolicy is DataClear, and entering a scene
+// restores its slot.
+func (s *Scenario) WithSceneNamespaces(enabled bool) *Scenario {
+	s.namespaces = enabled
+	return s
+}
+
+// GetSceneData decodes the data of scene from the session of userID in chatID,
+// whether the scene is active or left its data in a slot. ok is false if the scene has no data.
+func GetSceneData[T any](ctx context.Context, scenario *Scenario, chatID, userID int64, scene SceneName) (data T, ok bool, err error) {
+	base, err := scenario.store.GetSession(ctx, chatID, userID)
+	if err != nil {
+		return data, false, err
+	}
+
+	slot := SceneSlot{Data: base.Data, Codec: base.Codec, DataVersion: base.DataVersion}
+	if base.Scene != scene {
+		slots, err := base.sceneSlots()
+		if err != nil {
+			return data, false, err
+		}
+		slot, ok = slots[scene]
+		if !ok {
+			return data, false, nil
+		}
+	}
+	if !hasData(slot.Data) {
+		return data, false, nil
+	}
+
+	if err = scenario.codecs.decode(slot.Codec, slot.Data, &data); err != nil {
+		return data, false, fmt.Errorf("%w: %w", ErrDataDecode, err)
+	}
+	return data, true, nil
+}
+
+// switchData returns base with data of the active scene stashed and data
+// of the entered one restored. Reentering the active scene keeps its data.
+func (s *Scenario) switchData(base *SessionBase, scene SceneName) (*SessionBase, error) {
+	if base.Scene == scene {
+		return base, nil
+	}
+
+	switched := *base
+	if err := s.stashData(&switched); err != nil {
+		return nil, fmt.Errorf("stashData: %w", err)
+	}
+	if err := s.restoreData(&switched, scene); err != nil {
+		return nil, fmt.Errorf("restoreData: %w", err)
+	}
+	return &switched, nil
+}
+
+// stashData moves data of the active scene into its slot, or drops it
+// if the scene clears data on leave.
+func (s *Scenario) stashData(base *SessionBase) error {
+	if base.Scene == "" {
+		return nil
+	}
+
+	slots, err := base.sceneSlots()
+	if err != nil {
+		return err
+	}
+	delete(slots, base.Scene)
+	sc, _ := s.scene(base.Scene)
+	if hasData(base.Data) && !s.clearsData(sc) {
+		slots[base.Scene] = SceneSlot{Data: base.Data, Codec: base.Codec, DataVersion: base.DataVersion}
+	}
+
+	base.Data, base.Codec, base.DataVersion = nil, "", 0
+	return base.setSceneSlots(slots)
+}
+
+// restoreData moves the slot of scene into Data. Without a slot Data is kept,
+// so data set before entering from outside of scenes reaches the scene.
+func (s *Scenario) restoreData(base *SessionBase, scene SceneName) error {
+	slots, err := base.sceneSlots()
+	if err != nil {
+		return err
+	}
+	slot, ok := slots[scene]
+	if !ok {
+		return nil
+	}
+
+	delete(slots, scene)
+	base.Data, base.Codec, base.DataVersion = slot.Data, slot.Codec, slot.DataVersion
+	return base.setSceneSlots(slots)
+}
+
+func (b *SessionBase) sceneSlots() (map[SceneName]SceneSlot, error) {
+	slots := make(map[SceneName]SceneSlot)
+	if !hasData(b.SceneData) {
+		return slots, nil
+	}
+	if err := json.Unmarshal(b.SceneData, &slots); err != nil {
+		return nil, fmt.Errorf("%w: scene data: %w", ErrDataDecode, err)
+	}
+	return slots, nil
+}
+
+func (b *SessionBase) setSceneSlots(slots map[SceneName]SceneSlot) error {
+	if len(slots) == 0 {
+		b.SceneData = nil
+		return nil
+	}
+	data, err := json.Marshal(slots)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	b.SceneData = data
+	return nil
+}
+
+func hasData(data json.RawMessage) bool {
+	return len(data) > 0 && !bytes.Equal(data, nullBytes)
+}
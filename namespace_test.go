@@ -0,0 +1,166 @@
+package scenario_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+type userData struct {
+	Name string `json:"name"`
+}
+
+type orderData struct {
+	Items []string `json:"items"`
+}
+
+func newNamespacesBot(t *testing.T, orderPolicy scenario.DataPolicy) (*scenariotest.Bot, *scenario.Scenario) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot).WithSceneNamespaces(true)
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[userData]("user",
+		func(c *scenario.Context[userData]) (bool, error) {
+			if name := c.GetData().Name; name != "" {
+				return true, c.Send("С возвращением, " + name + "! Новое имя?")
+			}
+			return true, c.Send("Имя?")
+		},
+		func(c *scenario.Context[userData]) (bool, error) {
+			c.SetData(userData{Name: c.Text()})
+			return true, nil
+		},
+	))
+	scn.Use(scenario.NewWizard[orderData]("order",
+		func(c *scenario.Context[orderData]) (bool, error) {
+			return true, c.Send("Что заказать?")
+		},
+		func(c *scenario.Context[orderData]) (bool, error) {
+			data := c.GetData()
+			data.Items = append(data.Items, c.Text())
+			c.SetData(data)
+			return true, nil
+		},
+	).WithDataPolicy(orderPolicy))
+
+	bot.Handle("/user", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[userData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("user")
+	})
+	bot.Handle("/order", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[orderData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("order")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	return bot, scn
+}
+
+func TestSceneNamespaces(t *testing.T) {
+	bot, scn := newNamespacesBot(t, scenario.DataKeep)
+	ctx := context.Background()
+
+	conv := bot.Conversation(scn).
+		Send("/user").ExpectReply("Имя?").
+		Send("Bob").ExpectScene("").
+		Send("/order").ExpectReply("Что заказать?").
+		Send("pizza").ExpectScene("").
+		Send("/user").ExpectReply("С возвращением, Bob! Новое имя?")
+	scenariotest.ExpectData(conv, userData{Name: "Bob"})
+
+	order, ok, err := scenario.GetSceneData[orderData](ctx, scn, conv.Chat().ID, conv.User().ID, "order")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, orderData{Items: []string{"pizza"}}, order)
+
+	// the order resumes with its own data
+	conv.Send("Alice").
+		Send("/order").ExpectReply("Что заказать?").
+		Send("sushi")
+	order, _, err = scenario.GetSceneData[orderData](ctx, scn, conv.Chat().ID, conv.User().ID, "order")
+	require.NoError(t, err)
+	assert.Equal(t, orderData{Items: []string{"pizza", "sushi"}}, order)
+
+	user, ok, err := scenario.GetSceneData[userData](ctx, scn, conv.Chat().ID, conv.User().ID, "user")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, userData{Name: "Alice"}, user)
+}
+
+func TestSceneNamespacesClearOnLeave(t *testing.T) {
+	bot, scn := newNamespacesBot(t, scenario.DataClear)
+	ctx := context.Background()
+
+	conv := bot.Conversation(scn).
+		Send("/order").ExpectReply("Что заказать?").
+		Send("pizza").ExpectScene("")
+
+	_, ok, err := scenario.GetSceneData[orderData](ctx, scn, conv.Chat().ID, conv.User().ID, "order")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	conv.Send("/order").ExpectReply("Что заказать?").
+		Send("sushi")
+	assert.Nil(t, scenariotest.Session[orderData](conv).SceneData)
+}
+
+func TestSceneNamespacesEnterFromStep(t *testing.T) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot).WithSceneNamespaces(true)
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[userData]("user",
+		func(c *scenario.Context[userData]) (bool, error) {
+			if name := c.GetData().Name; name != "" {
+				return true, c.Send("С возвращением, " + name + "!")
+			}
+			return true, c.Send("Имя?")
+		},
+		func(c *scenario.Context[userData]) (bool, error) {
+			c.SetData(userData{Name: c.Text()})
+			return false, c.Enter("order")
+		},
+	))
+	scn.Use(scenario.NewWizard[orderData]("order",
+		func(c *scenario.Context[orderData]) (bool, error) {
+			return true, c.Send("Что заказать?")
+		},
+		func(c *scenario.Context[orderData]) (bool, error) {
+			c.SetData(orderData{Items: []string{c.Text()}})
+			return false, c.Enter("user")
+		},
+	))
+	bot.Handle("/user", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[userData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("user")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+
+	conv := bot.Conversation(scn).
+		Send("/user").ExpectReply("Имя?").
+		Send("Bob").ExpectReply("Что заказать?").
+		ExpectScene("order").
+		Send("pizza").ExpectReply("С возвращением, Bob!").
+		ExpectScene("user")
+	assert.Empty(t, bot.Errors())
+	scenariotest.ExpectData(conv, userData{Name: "Bob"})
+
+	order, ok, err := scenario.GetSceneData[orderData](context.Background(), scn, conv.Chat().ID, conv.User().ID, "order")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, orderData{Items: []string{"pizza"}}, order)
+}
@@ -0,0 +1,125 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ProfileChatID is the chat ID under which user profiles are kept in Store.
+// Profiles belong to users, not to chats or scenes; the ID lies outside
+// of the range of Telegram chat IDs.
+const ProfileChatID int64 = math.MinInt64
+
+// DataPolicy defines what happens to scene data when the user leaves the scene.
+type DataPolicy int
+
+const (
+	// DataDefault uses the policy set by Scenario.WithDataPolicy.
+	DataDefault DataPolicy = iota
+	// DataKeep leaves the data in the session, the next scene starts with it.
+	DataKeep
+	// DataClear drops the data on leave.
+	DataClear
+)
+
+// DataPolicyScene is implemented by scenes that choose what happens to their data on leave.
+type DataPolicyScene interface {
+	Scene
+	DataPolicy() DataPolicy
+}
+
+// WithDataPolicy sets the data policy of scenes that don't set their own, DataKeep by default.
+// Keep long-lived user data in the profile, which doesn't depend on scenes.
+func (s *Scenario) WithDataPolicy(policy DataPolicy) *Scenario {
+	s.dataPolicy = policy
+	return s
+}
+
+// clearsData reports whether data of sc is dropped on leave.
+func (s *Scenario) clearsData(sc Scene) bool {
+	policy := DataDefault
+	if ps, ok := sc.(DataPolicyScene); ok {
+		policy = ps.DataPolicy()
+	}
+	if policy == DataDefault {
+		policy = s.dataPolicy
+	}
+	return policy == DataClear
+}
+
+// Profile is long-lived data of a user persisted in Store independently of scenes,
+// e.g. preferred language or a verified phone.
+type Profile struct {
+	scenario *Scenario
+	userID   int64
+}
+
+// Profile returns the profile of the context user.
+func (c *Context[T]) Profile() *Profile {
+	return &Profile{scenario: c.Scenario, userID: c.userID}
+}
+
+// Get decodes the profile into v. v is left untouched if the user has no profile.
+func (p *Profile) Get(v any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return p.scenario.getProfile(ctx, p.userID, v)
+}
+
+// Set saves v as the profile.
+func (p *Profile) Set(v any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return p.scenario.setProfile(ctx, p.userID, v)
+}
+
+// GetProfile loads the profile of userID; a user without one gets the zero P.
+func GetProfile[P any](ctx context.Context, scenario *Scenario, userID int64) (P, error) {
+	var profile P
+	err := scenario.getProfile(ctx, userID, &profile)
+	return profile, err
+}
+
+// SetProfile saves the profile of userID.
+func SetProfile[P any](ctx context.Context, scenario *Scenario, userID int64, profile P) error {
+	return scenario.setProfile(ctx, userID, profile)
+}
+
+func (s *Scenario) getProfile(ctx context.Context, userID int64, v any) error {
+	base, err := s.store.GetSession(ctx, ProfileChatID, userID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("store.GetSession: %w", err)
+	}
+	if len(base.Data) == 0 {
+		return nil
+	}
+	if err = s.codecs.decode(base.Codec, base.Data, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrDataDecode, err)
+	}
+	return nil
+}
+
+func (s *Scenario) setProfile(ctx context.Context, userID int64, v any) error {
+	codec, data, err := s.codecs.encode(v)
+	if err != nil {
+		return err
+	}
+	base := &SessionBase{
+		ChatID:    ProfileChatID,
+		UserID:    userID,
+		Step:      -1,
+		Data:      data,
+		Codec:     codec,
+		UpdatedAt: time.Now(),
+	}
+	if err = s.store.SetSession(ctx, base); err != nil {
+		return fmt.Errorf("store.SetSession: %w", err)
+	}
+	return nil
+}
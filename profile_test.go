@@ -0,0 +1,119 @@
+package scenario_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+type prefs struct {
+	Lang  string `json:"lang"`
+	Phone string `json:"phone,omitempty"`
+}
+
+type feedback struct {
+	Text string `json:"text"`
+}
+
+func newProfileBot(t *testing.T, policy scenario.DataPolicy) (*scenariotest.Bot, *scenario.Scenario) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[prefs]("settings",
+		func(c *scenario.Context[prefs]) (bool, error) {
+			return true, c.Send("Язык?")
+		},
+		func(c *scenario.Context[prefs]) (bool, error) {
+			c.SetData(prefs{Lang: c.Text()})
+			return true, c.Profile().Set(c.GetData())
+		},
+	).WithDataPolicy(policy))
+
+	scn.Use(scenario.NewWizard[feedback]("feedback",
+		func(c *scenario.Context[feedback]) (bool, error) {
+			var p prefs
+			if err := c.Profile().Get(&p); err != nil {
+				return false, err
+			}
+			if p.Lang == "en" {
+				return true, c.Send("Your feedback?")
+			}
+			return true, c.Send("Ваш отзыв?")
+		},
+		func(c *scenario.Context[feedback]) (bool, error) {
+			c.SetData(feedback{Text: c.Text()})
+			return true, nil
+		},
+	))
+
+	bot.Handle("/settings", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[prefs](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("settings")
+	})
+	bot.Handle("/feedback", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[feedback](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("feedback")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	return bot, scn
+}
+
+func TestProfileSurvivesScenes(t *testing.T) {
+	bot, scn := newProfileBot(t, scenario.DataClear)
+
+	conv := bot.Conversation(scn).
+		Send("/feedback").ExpectReply("Ваш отзыв?").
+		Send("ok").ExpectScene("").
+		Send("/settings").ExpectReply("Язык?").
+		Send("en").ExpectNoReply().ExpectScene("")
+
+	// the scene data is cleared on leave, the profile stays
+	assert.Equal(t, prefs{}, scenariotest.Session[prefs](conv).Data)
+	profile, err := scenario.GetProfile[prefs](context.Background(), scn, conv.User().ID)
+	require.NoError(t, err)
+	assert.Equal(t, prefs{Lang: "en"}, profile)
+
+	conv.Send("/feedback").ExpectReply("Your feedback?").
+		Send("great").ExpectScene("")
+	scenariotest.ExpectData(conv, feedback{Text: "great"})
+
+	// profiles are per user and independent of chats
+	group := &tele.Chat{ID: -100, Type: tele.ChatGroup}
+	bot.ConversationWith(scn, group, conv.User()).Send("/feedback").ExpectReply("Your feedback?")
+}
+
+func TestDataPolicy(t *testing.T) {
+	bot, scn := newProfileBot(t, scenario.DataDefault)
+
+	conv := bot.Conversation(scn).
+		Send("/settings").ExpectReply("Язык?").
+		Send("ru").ExpectScene("")
+	assert.Equal(t, prefs{Lang: "ru"}, scenariotest.Session[prefs](conv).Data)
+
+	scn.WithDataPolicy(scenario.DataClear)
+	conv.Send("/settings").ExpectReply("Язык?").
+		Send("ru").ExpectScene("")
+	assert.Equal(t, prefs{}, scenariotest.Session[prefs](conv).Data)
+
+	require.NoError(t, scenario.SetProfile(context.Background(), scn, 7, prefs{Lang: "de", Phone: "+49"}))
+	profile, err := scenario.GetProfile[prefs](context.Background(), scn, 7)
+	require.NoError(t, err)
+	assert.Equal(t, prefs{Lang: "de", Phone: "+49"}, profile)
+
+	empty, err := scenario.GetProfile[prefs](context.Background(), scn, 8)
+	require.NoError(t, err)
+	assert.Zero(t, empty)
+}
@@ -0,0 +1,268 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// RateAction defines what Middleware does with an update over the rate limit.
+type RateAction int
+
+const (
+	// RateDrop ignores the update; a callback is answered silently.
+	RateDrop RateAction = iota
+	// RateDelay waits for a token up to RateLimit.MaxDelay, then drops the update.
+	RateDelay
+	// RateReply answers with RateLimit.Message, at most once per refill of the bucket.
+	RateReply
+)
+
+// DefaultRateMessage is sent by RateReply when RateLimit.Message is empty.
+const DefaultRateMessage = "Слишком быстро, подождите немного"
+
+// RateLimit is a token bucket of a session: Burst updates at once, then one per Every.
+// A zero Every disables limiting.
+type RateLimit struct {
+	Every  time.Duration
+	Burst  int
+	Action RateAction
+	// Message is the answer of RateReply.
+	Message string
+	// MaxDelay is how long RateDelay may hold an update, one second by default.
+	MaxDelay time.Duration
+}
+
+func (l RateLimit) enabled() bool { return l.Every > 0 }
+
+func (l RateLimit) message() string {
+	if l.Message != "" {
+		return l.Message
+	}
+	return DefaultRateMessage
+}
+
+func (l RateLimit) maxDelay() time.Duration {
+	if l.MaxDelay > 0 {
+		return l.MaxDelay
+	}
+	return time.Second
+}
+
+// RateLimiter keeps token buckets. Implement it over a shared store (e.g. Redis)
+// so replicas of the bot share limits.
+type RateLimiter interface {
+	// Take takes a token from the bucket of key. If there is none, it takes nothing
+	// and returns how long to wait for the next token.
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (time.Duration, error)
+}
+
+// RateLimitedScene is implemented by scenes with a rate limit of their own, checked
+// after the limit of Scenario.WithRateLimit. A nil or zero limit adds no check.
+type RateLimitedScene interface {
+	Scene
+	RateLimit() *RateLimit
+}
+
+// WithRateLimit limits updates of every session in Middleware, before the session is loaded.
+// Scenes may limit their updates further, see RateLimitedScene.
+func (s *Scenario) WithRateLimit(limit RateLimit) *Scenario {
+	s.rateLimit = limit
+	return s
+}
+
+// WithRateLimiter replaces the in-memory state of rate limits.
+func (s *Scenario) WithRateLimiter(limiter RateLimiter) *Scenario {
+	if limiter != nil {
+		s.limiter = limiter
+	}
+	return s
+}
+
+// sceneRateLimit returns the limit of the scene.
+func (s *Scenario) sceneRateLimit(scene SceneName) (RateLimit, bool) {
+	sc, _ := s.scene(scene)
+	if rs, ok := sc.(RateLimitedScene); ok {
+		if limit := rs.RateLimit(); limit != nil && limit.enabled() {
+			return *limit, true
+		}
+	}
+	return RateLimit{}, false
+}
+
+// throttle applies limit to the update and reports whether to handle it.
+// Limiter failures are logged and let the update through.
+func (s *Scenario) throttle(ctx context.Context, c tele.Context, bucket string, limit RateLimit) (bool, error) {
+	if !limit.enabled() {
+		return true, nil
+	}
+
+	wait, err := s.limiter.Take(ctx, bucket, limit, time.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to take rate limit token", "key", bucket, "error", err)
+		return true, nil
+	}
+	if wait == 0 {
+		return true, nil
+	}
+
+	if limit.Action == RateDelay {
+		deadline := time.Now().Add(limit.maxDelay())
+		for wait > 0 && time.Now().Add(wait).Before(deadline) {
+			select {
+			case <-ctx.Done():
+				return false, nil
+			case <-time.After(wait):
+			}
+			if wait, err = s.limiter.Take(ctx, bucket, limit, time.Now()); err != nil {
+				slog.ErrorContext(ctx, "failed to take rate limit token", "key", bucket, "error", err)
+				return true, nil
+			}
+		}
+		if wait == 0 {
+			return true, nil
+		}
+	}
+	return false, s.reject(ctx, c, bucket, limit)
+}
+
+// reject answers an update over limit.
+func (s *Scenario) reject(ctx context.Context, c tele.Context, bucket string, limit RateLimit) error {
+	if limit.Action == RateReply {
+		// one notice per refill of the whole bucket, not one per dropped update
+		notice := RateLimit{Every: limit.Every * time.Duration(max(limit.Burst, 1)), Burst: 1}
+		if wait, err := s.limiter.Take(ctx, bucket+":notice", notice, time.Now()); err == nil && wait == 0 {
+			if c.Callback() != nil {
+				return c.Respond(&tele.CallbackResponse{Text: limit.message()})
+			}
+			return c.Send(limit.message())
+		}
+	}
+
+	if c.Callback() != nil {
+		return c.Respond()
+	}
+	return nil
+}
+
+// lockSession locks the session of the update and reads it, once the update fits the
+// rate limit of the session's scene, before the update changes anything. A nil unlock
+// means the update is dropped. RateDelay waits with the session unlocked, then the
+// session is read anew, its scene may have changed meanwhile.
+func (s *Scenario) lockSession(c tele.Context, chatID, userID int64) (func(), *SessionBase, error) {
+	deadline := time.Time{}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		unlock, base, wait, limit, err := s.readSession(ctx, chatID, userID)
+		if err != nil || wait == 0 {
+			cancel()
+			return unlock, base, err
+		}
+
+		bucket := key(chatID, userID) + ":" + string(base.Scene)
+		if deadline.IsZero() {
+			deadline = time.Now().Add(limit.maxDelay())
+		}
+		if limit.Action != RateDelay || time.Now().Add(wait).After(deadline) {
+			err = s.reject(ctx, c, bucket, limit)
+			cancel()
+			return nil, nil, err
+		}
+		cancel()
+		time.Sleep(wait)
+	}
+}
+
+// readSession locks and reads the session and takes a token of its scene. Unless wait
+// is zero, the session is unlocked again and wait is how long to wait for the token.
+func (s *Scenario) readSession(ctx context.Context, chatID, userID int64) (func(), *SessionBase, time.Duration, RateLimit, error) {
+	unlock, err := s.sessions.lock(ctx, chatID, userID)
+	if err != nil {
+		return nil, nil, 0, RateLimit{}, err
+	}
+
+	base, err := s.store.GetSession(ctx, chatID, userID)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		unlock()
+		return nil, nil, 0, RateLimit{}, err
+	}
+	if base == nil {
+		base = &SessionBase{}
+	}
+
+	limit, ok := s.sceneRateLimit(base.Scene)
+	if !ok {
+		return unlock, base, 0, limit, nil
+	}
+	bucket := key(chatID, userID) + ":" + string(base.Scene)
+	wait, err := s.limiter.Take(ctx, bucket, limit, time.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to take rate limit token", "key", bucket, "error", err)
+		return unlock, base, 0, limit, nil
+	}
+	if wait > 0 {
+		unlock()
+	}
+	return unlock, base, wait, limit, nil
+}
+
+// MemoryLimiter keeps token buckets in memory, limits aren't shared between replicas.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Duration // time to refill the empty bucket
+}
+
+// maxIdleBuckets is the number of buckets after which full ones are evicted.
+const maxIdleBuckets = 10000
+
+// NewMemoryLimiter .
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// Take .
+func (m *MemoryLimiter) Take(_ context.Context, key string, limit RateLimit, now time.Time) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	burst := float64(max(limit.Burst, 1))
+	b, ok := m.buckets[key]
+	if !ok {
+		if len(m.buckets) >= maxIdleBuckets {
+			m.evict(now)
+		}
+		b = &tokenBucket{tokens: burst, last: now}
+		m.buckets[key] = b
+	}
+	b.full = limit.Every * time.Duration(burst)
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+float64(elapsed)/float64(limit.Every))
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, nil
+	}
+	return time.Duration(math.Ceil((1 - b.tokens) * float64(limit.Every))), nil
+}
+
+// evict removes buckets that would be full by now.
+func (m *MemoryLimiter) evict(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.last) >= b.full {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package scenario_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+func newFloodBot(t *testing.T, limit scenario.RateLimit) (*scenariotest.Bot, *scenario.Scenario, *int) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot).WithRateLimit(limit)
+	bot.Use(scn.Middleware)
+
+	handled := new(int)
+	bot.Handle(tele.OnText, func(tele.Context) error {
+		*handled++
+		return nil
+	})
+	return bot, scn, handled
+}
+
+func TestRateLimitDrop(t *testing.T) {
+	bot, scn, handled := newFloodBot(t, scenario.RateLimit{Every: time.Hour, Burst: 2})
+
+	bot.Conversation(scn).
+		Send("1").Send("2").Send("3").ExpectNoReply()
+	assert.Equal(t, 2, *handled)
+
+	// sessions have their own buckets
+	bot.ConversationWith(scn, &tele.Chat{ID: 2}, &tele.User{ID: 2}).Send("1")
+	assert.Equal(t, 3, *handled)
+}
+
+func TestRateLimitReply(t *testing.T) {
+	bot, scn, handled := newFloodBot(t, scenario.RateLimit{Every: time.Hour, Burst: 1, Action: scenario.RateReply})
+
+	bot.Conversation(scn).
+		Send("1").ExpectNoReply().
+		Send("2").ExpectReply(scenario.DefaultRateMessage).
+		Send("3").ExpectNoReply()
+	assert.Equal(t, 1, *handled)
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	bot, scn, handled := newFloodBot(t, scenario.RateLimit{
+		Every:    20 * time.Millisecond,
+		Burst:    1,
+		Action:   scenario.RateDelay,
+		MaxDelay: time.Second,
+	})
+
+	start := time.Now()
+	bot.Conversation(scn).Send("1").Send("2")
+	assert.Equal(t, 2, *handled)
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+}
+
+func TestRateLimitScene(t *testing.T) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot).WithRateLimit(scenario.RateLimit{Every: time.Hour, Burst: 5})
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[userData]("quiz",
+		func(c *scenario.Context[userData]) (bool, error) { return true, c.Send("Вопрос 1") },
+		func(c *scenario.Context[userData]) (bool, error) { return true, c.Send("Вопрос 2") },
+		func(c *scenario.Context[userData]) (bool, error) { return true, c.Send("Вопрос 3") },
+		func(c *scenario.Context[userData]) (bool, error) { return true, c.Send("Конец") },
+	).WithRateLimit(scenario.RateLimit{Every: time.Hour, Burst: 2}))
+
+	bot.Handle("/quiz", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[userData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("quiz")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+
+	// the quiz is limited further, the limit of the scenario still applies
+	bot.Conversation(scn).
+		Send("/quiz").ExpectReply("Вопрос 1").
+		Send("a").ExpectReply("Вопрос 2").
+		Send("b").ExpectReply("Вопрос 3").
+		Send("c").ExpectNoReply().
+		ExpectStep(3).
+		Send("d").
+		Send("e").ExpectNoReply().
+		ExpectStep(3)
+}
+
+func TestRateLimitSceneDropsBeforeSideEffects(t *testing.T) {
+	bot := scenariotest.NewBot(t)
+	jobs := scenario.NewMemoryJobs()
+	scn := scenario.New(bot.Bot).WithScheduler(jobs)
+	bot.Use(scn.Middleware)
+
+	ask := func(text string) scenario.WizardStep[userData] {
+		return func(c *scenario.Context[userData]) (bool, error) {
+			if err := c.Remind(time.Hour, "Ответьте"); err != nil {
+				return false, err
+			}
+			return true, c.Send(text)
+		}
+	}
+	scn.Use(scenario.NewWizard[userData]("quiz", ask("Вопрос 1"), ask("Вопрос 2"), ask("Вопрос 3")).
+		WithRateLimit(scenario.RateLimit{Every: time.Hour, Burst: 1}))
+
+	bot.Handle("/quiz", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[userData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("quiz")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+
+	// the dropped update doesn't cancel the reminder of the last question
+	bot.Conversation(scn).
+		Send("/quiz").ExpectReply("Вопрос 1").
+		Send("a").ExpectReply("Вопрос 2").
+		Send("b").ExpectNoReply().
+		ExpectStep(2)
+	due, err := jobs.DueJobs(context.Background(), time.Now().Add(2*time.Hour), 0)
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+}
+
+func TestRateLimitSceneDelay(t *testing.T) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[userData]("quiz",
+		func(c *scenario.Context[userData]) (bool, error) { return true, c.Send("Вопрос 1") },
+		func(c *scenario.Context[userData]) (bool, error) { return true, c.Send("Вопрос 2") },
+		func(c *scenario.Context[userData]) (bool, error) { return true, c.Send("Вопрос 3") },
+	).WithRateLimit(scenario.RateLimit{Every: 20 * time.Millisecond, Burst: 1, Action: scenario.RateDelay}))
+	bot.Handle("/quiz", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[userData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("quiz")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+
+	start := time.Now()
+	bot.Conversation(scn).
+		Send("/quiz").ExpectReply("Вопрос 1").
+		Send("a").ExpectReply("Вопрос 2").
+		Send("b").ExpectReply("Вопрос 3")
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	limiter := scenario.NewMemoryLimiter()
+	limit := scenario.RateLimit{Every: time.Second, Burst: 2}
+	now := time.Now()
+
+	for range 2 {
+		wait, err := limiter.Take(ctx, "k", limit, now)
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+	wait, err := limiter.Take(ctx, "k", limit, now.Add(250*time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, 750*time.Millisecond, wait)
+
+	wait, err = limiter.Take(ctx, "k", limit, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestMemoryLimiterEvictsByOwnLimit(t *testing.T) {
+	ctx := context.Background()
+	limiter := scenario.NewMemoryLimiter()
+	now := time.Now()
+
+	// a slow bucket, still refilling after a minute
+	_, err := limiter.Take(ctx, "slow", scenario.RateLimit{Every: time.Hour, Burst: 1}, now)
+	require.NoError(t, err)
+
+	// fill the limiter with fast buckets to trigger eviction
+	fast := scenario.RateLimit{Every: time.Millisecond, Burst: 1}
+	for i := range 10000 {
+		_, err = limiter.Take(ctx, strconv.Itoa(i), fast, now.Add(time.Minute))
+		require.NoError(t, err)
+	}
+
+	wait, err := limiter.Take(ctx, "slow", scenario.RateLimit{Every: time.Hour, Burst: 1}, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 59*time.Minute, wait)
+}
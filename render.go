@@ -0,0 +1,71 @@
+package scenario
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// DefaultAnchorTTL is how long Context.Render edits the anchor message before sending
+// a new one. Telegram doesn't let bots delete messages older than 48 hours,
+// so an older anchor couldn't be cleaned up.
+const DefaultAnchorTTL = 48 * time.Hour
+
+// WithAnchorTTL sets how long Context.Render keeps editing the same anchor message.
+func (s *Scenario) WithAnchorTTL(ttl time.Duration) *Scenario {
+	if ttl > 0 {
+		s.anchorTTL = ttl
+	}
+	return s
+}
+
+// Render shows what in the anchor message of the session, editing it in place,
+// so a menu-heavy scene keeps a single message instead of a new one per step.
+// A new anchor is sent when there is none yet, it's older than the anchor TTL
+// or it can't be edited anymore. The anchor is kept in the session until the user leaves the scene.
+func (c *Context[T]) Render(what any, opts ...any) error {
+	meta := c.meta()
+	if meta.Anchor != 0 && time.Since(time.Unix(meta.AnchorAt, 0)) < c.Scenario.anchorTTL {
+		anchor := tele.StoredMessage{MessageID: strconv.Itoa(meta.Anchor), ChatID: c.chatID}
+		_, err := c.Bot().Edit(anchor, what, opts...)
+		switch {
+		case err == nil, isNotModified(err):
+			return nil
+		case !isAnchorGone(err):
+			return err
+		}
+	}
+
+	m, err := c.Bot().Send(c.Recipient(), what, opts...)
+	if err != nil {
+		return err
+	}
+	if c.tracking() {
+		c.trackSent(opts, m)
+	}
+	meta = c.meta()
+	meta.Anchor, meta.AnchorAt = m.ID, m.Unixtime
+	if meta.AnchorAt == 0 {
+		meta.AnchorAt = time.Now().Unix()
+	}
+	c.setMeta(meta)
+	return nil
+}
+
+// isNotModified reports whether the anchor already shows the content.
+func isNotModified(err error) bool {
+	return errors.Is(err, tele.ErrMessageNotModified) || errors.Is(err, tele.ErrSameMessageContent) ||
+		strings.Contains(err.Error(), "message is not modified")
+}
+
+// isAnchorGone reports whether the anchor was deleted or can't be edited anymore.
+func isAnchorGone(err error) bool {
+	if errors.Is(err, tele.ErrCantEditMessage) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "message to edit not found") || strings.Contains(msg, "message can't be edited")
+}
@@ -0,0 +1,92 @@
+package scenario_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+func newMenuBot(t *testing.T) (*scenariotest.Bot, *scenario.Scenario) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	render := func(text string) scenario.WizardStep[userData] {
+		return func(c *scenario.Context[userData]) (bool, error) {
+			markup := &tele.ReplyMarkup{}
+			markup.Inline(markup.Row(markup.Data("Дальше", "next")))
+			return true, c.Render(text, markup)
+		}
+	}
+	scn.Use(scenario.NewWizard[userData]("menu",
+		render("Главное меню"), render("Настройки"), render("Настройки"), render("Профиль"),
+		func(c *scenario.Context[userData]) (bool, error) { return false, nil },
+	))
+
+	bot.Handle("/menu", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[userData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("menu")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	return bot, scn
+}
+
+func TestRenderEditsAnchor(t *testing.T) {
+	bot, scn := newMenuBot(t)
+
+	conv := bot.Conversation(scn).Send("/menu").ExpectReply("Главное меню")
+	anchor := conv.Replies()[0].MessageID
+
+	conv.Send("next").ExpectReplyFunc(func(call scenariotest.Call) error {
+		assert.Equal(t, "editMessageText", call.Method)
+		assert.Equal(t, strconv.Itoa(anchor), call.Params["message_id"])
+		assert.Equal(t, "Настройки", call.Text())
+		return nil
+	})
+
+	// the same content is not an error
+	bot.Respond("editMessageText", func(scenariotest.Call) (any, string) {
+		return nil, "Bad Request: message is not modified: specified new message content and reply markup are exactly the same as a current content and reply markup of the message"
+	})
+	conv.Send("next").ExpectStep(3)
+	assert.Empty(t, bot.Errors())
+}
+
+func TestRenderAnchorGone(t *testing.T) {
+	bot, scn := newMenuBot(t)
+
+	conv := bot.Conversation(scn).Send("/menu").ExpectReply("Главное меню")
+	anchor := conv.Replies()[0].MessageID
+
+	bot.Respond("editMessageText", func(scenariotest.Call) (any, string) {
+		return nil, "Bad Request: message to edit not found"
+	})
+	conv.Send("next").ExpectReplyFunc(func(call scenariotest.Call) error {
+		assert.Equal(t, "editMessageText", call.Method, "the failed edit")
+		return nil
+	}).ExpectReplyFunc(func(call scenariotest.Call) error {
+		assert.Equal(t, "sendMessage", call.Method)
+		assert.NotEqual(t, anchor, call.MessageID)
+		return nil
+	})
+	anchor = bot.Calls()[len(bot.Calls())-1].MessageID
+	require.Empty(t, bot.Errors())
+
+	// the new anchor is persisted and edited further
+	bot.Respond("editMessageText", nil)
+	conv.Send("next").
+		Send("next").ExpectReplyFunc(func(call scenariotest.Call) error {
+		assert.Equal(t, "editMessageText", call.Method)
+		assert.Equal(t, strconv.Itoa(anchor), call.Params["message_id"])
+		return nil
+	})
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"sync"
 	"time"
 
 	tele "gopkg.in/telebot.v3"
@@ -12,6 +15,8 @@ import (
 var (
 	ErrSessionNotFound = errors.New("session not found")
 	ErrSceneNotFound   = errors.New("scene not found")
+	ErrContextDetached = errors.New("context detached from session")
+	ErrNoBot           = errors.New("scenario has no bot")
 )
 
 // SceneName .
@@ -37,19 +42,64 @@ type TypedScene interface {
 	CreateContext(scenario *Scenario, c tele.Context, base *SessionBase) (ContextBase, error)
 }
 
+// passiveEnterScene is implemented by scenes that don't handle the update that entered them.
+type passiveEnterScene interface {
+	passiveEnter()
+}
+
 // Scenario routes updates to scenes, stores session and current scene.
 type Scenario struct {
 	bot    *tele.Bot
 	store  Store
+	codecs *codecSet
+
+	mu     sync.RWMutex // guards scenes and edges, which may change at runtime by LoadScenes
 	scenes map[SceneName]Scene
+
+	history          HistoryStore
+	historySnapshots bool
+
+	jobs    JobStore
+	actions map[string]JobAction // guarded by mu
+
+	shared      SharedStore
+	sharedLocks sync.Map // chat ID -> *sync.Mutex of the default SharedStore
+
+	edges      []Edge // transitions declared outside of scenes
+	duplicates []SceneName
+
+	strict       bool
+	orphanPolicy OrphanPolicy
+	dataPolicy   DataPolicy
+	namespaces   bool
+
+	cleanupPolicy CleanupPolicy
+	anchorTTL     time.Duration
+
+	rateLimit RateLimit
+	limiter   RateLimiter
+
+	links        []*deepLink // guarded by mu
+	linkErrs     []error     // invalid patterns, reported by Validate
+	linkPolicy   DeepLinkPolicy
+	linkFallback tele.HandlerFunc
+
+	sessions sessionLocks // serializes updates of a session with jobs, album flushes and events
+
+	loadMu   sync.Mutex           // serializes LoadScenes
+	loaded   map[SceneName]bool   // scenes registered by LoadScenes
+	commands map[string]SceneName // commands entering loaded scenes
 }
 
 // New .
 func New(bot *tele.Bot) *Scenario {
 	return &Scenario{
-		bot:    bot,
-		store:  newMemoryStore(),
-		scenes: make(map[SceneName]Scene),
+		bot:       bot,
+		store:     newMemoryStore(),
+		scenes:    make(map[SceneName]Scene),
+		codecs:    newCodecSet(),
+		anchorTTL: DefaultAnchorTTL,
+		limiter:   NewMemoryLimiter(),
 	}
 }
 
@@ -61,11 +111,72 @@ func (s *Scenario) WithStore(store Store) *Scenario {
 	return s
 }
 
+// WithCodec sets the codec used to encode session data (JSON by default).
+// Sessions written with other known codecs are still decoded by their own codec.
+func (s *Scenario) WithCodec(codec Codec) *Scenario {
+	if codec != nil {
+		s.codecs.register(codec)
+		s.codecs.current = codec
+	}
+	return s
+}
+
+// RegisterCodec makes a custom codec available for decoding without using it for writes.
+func (s *Scenario) RegisterCodec(codec Codec) *Scenario {
+	if codec != nil {
+		s.codecs.register(codec)
+	}
+	return s
+}
+
+// Use registers a scene. A scene registered under a taken name replaces it,
+// Validate reports such duplicates.
 func (s *Scenario) Use(sc Scene) *Scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.scenes[sc.Name()]; ok {
+		s.duplicates = append(s.duplicates, sc.Name())
+	}
 	s.scenes[sc.Name()] = sc
 	return s
 }
 
+// scene returns a registered scene by name.
+func (s *Scenario) scene(name SceneName) (Scene, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sc, ok := s.scenes[name]
+	return sc, ok
+}
+
+// sceneNames returns names of registered scenes in order.
+func (s *Scenario) sceneNames() []SceneName {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]SceneName, 0, len(s.scenes))
+	for name := range s.scenes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// swapScenes unregisters and registers scenes at once, so concurrent updates
+// see either the old or the new set.
+func (s *Scenario) swapScenes(remove []SceneName, add []Scene) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range remove {
+		delete(s.scenes, name)
+	}
+	for _, sc := range add {
+		s.scenes[sc.Name()] = sc
+	}
+}
+
 // createTypedContext creates a typed Context[T] based on the scene type.
 // If the scene implements TypedScene, it uses CreateContext method.
 // Otherwise, falls back to Context[any].
@@ -76,7 +187,7 @@ func createTypedContext(scene Scene, scenario *Scenario, c tele.Context, base *S
 	}
 
 	// Fallback to Context[any] for non-typed scenes
-	sess, err := fromBase[any](base)
+	sess, err := fromBase[any](base, scenario.codecs)
 	if err != nil {
 		return nil, fmt.Errorf("fromBase[any]: %w", err)
 	}
@@ -87,61 +198,118 @@ func createTypedContext(scene Scene, scenario *Scenario, c tele.Context, base *S
 // This middleware creates a typed Context[T] based on the scene's type parameter.
 func (s *Scenario) Middleware(next tele.HandlerFunc) tele.HandlerFunc {
 	return func(c tele.Context) error {
+		cid, uid := getChatUserIDs(c)
+		if ok, err := s.throttle(context.Background(), c, key(cid, uid), s.rateLimit); !ok {
+			return err
+		}
+
+		unlock, base, err := s.lockSession(c, cid, uid)
+		if unlock == nil {
+			return err
+		}
+		defer unlock()
+		c = &updateContext{Context: c, ctx: s.sessions.hold(UpdateContext(c), cid, uid)}
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		cid, uid := getChatUserIDs(c)
-		base, err := s.store.GetSession(ctx, cid, uid)
-		if err != nil && !errors.Is(err, ErrSessionNotFound) {
-			return err
+		if s.cancelJobs(ctx, base) {
+			if err = s.store.SetSession(ctx, base); err != nil {
+				return fmt.Errorf("store.SetSession: %w", err)
+			}
 		}
-		if base == nil {
-			base = &SessionBase{}
+
+		if s.hasDeepLinks() {
+			if handled, err := s.routeDeepLink(c, base); handled {
+				return err
+			}
 		}
 
-		sc, ok := s.scenes[base.Scene]
+		sc, ok := s.scene(base.Scene)
+		if base.Scene != "" && (!ok || sc == nil) {
+			return s.handleOrphan(ctx, c, base, next)
+		}
 		if !ok || sc == nil || base.Scene == "" {
+			if scene, ok := s.commandScene(c); ok {
+				return s.enterCommand(c, scene)
+			}
 			// Fallback to next handlers if no active scene
 			return next(c)
 		}
 
 		// Create typed context based on scene type
 		sceneCtx, err := createTypedContext(sc, s, c, base)
+		if errors.Is(err, ErrDataDecode) {
+			sceneCtx, err = s.handleDecodeError(ctx, sc, c, base, err)
+			if err == nil && sceneCtx == nil {
+				return nil
+			}
+		}
 		if err != nil {
 			return fmt.Errorf("createTypedContext: %w", err)
 		}
 
 		// Dispatch to current scene
+		scene, step := base.Scene, base.Step
+		sceneCtx.trackUpdate()
 		if err = sc.OnUpdate(sceneCtx); err != nil {
 			return err
 		}
-
-		// persist session changes only if dirty
-		if sceneCtx.isDirty() {
-			base, err = sceneCtx.getSessionBase()
-			if err != nil {
-				return fmt.Errorf("getSessionBase: %w", err)
-			}
-			err = s.store.SetSession(ctx, base)
-			if err != nil {
-				return fmt.Errorf("store.SetSession: %w", err)
-			}
-			sceneCtx.clearDirty()
+		if err = s.persist(ctx, sceneCtx, scene, step); err != nil {
+			return err
 		}
+
+		s.scheduleIdle(ctx, sceneCtx)
+		return nil
+	}
+}
+
+// persist saves session changes made while handling an update, only if dirty.
+// scene and step are the session position before the update.
+func (s *Scenario) persist(ctx context.Context, sceneCtx ContextBase, scene SceneName, step int) error {
+	if !sceneCtx.isDirty() {
 		return nil
 	}
+
+	base, err := sceneCtx.getSessionBase()
+	if err != nil {
+		return fmt.Errorf("getSessionBase: %w", err)
+	}
+	err = s.store.SetSession(ctx, base)
+	if err != nil {
+		return fmt.Errorf("store.SetSession: %w", err)
+	}
+	sceneCtx.clearDirty()
+
+	// enter and leave record their own transitions
+	if base.Scene == scene && base.Step != step {
+		s.record(ctx, base, scene, step, base.Step, ReasonStep)
+	}
+	return nil
 }
 
-// enter sets current scene and calls Enter.
-func (s *Scenario) enter(c ContextBase, scene SceneName) error {
+// enter sets current scene and calls Enter. Typed scenes get a context of their
+// own data type, the caller is synced with it or detached if the types differ.
+func (s *Scenario) enter(caller ContextBase, scene SceneName) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	sc, ok := s.scenes[scene]
+	sc, ok := s.scene(scene)
 	if !ok {
+		if s.strict {
+			return fmt.Errorf("%w: %q", ErrSceneNotFound, scene)
+		}
 		return nil
 	}
 
+	c, err := s.sceneContext(caller, sc)
+	if err != nil {
+		return err
+	}
+	if c != caller {
+		defer s.syncCaller(caller, c)
+	}
+
 	if err := sc.Enter(c); err != nil {
 		return err
 	}
@@ -152,7 +320,14 @@ func (s *Scenario) enter(c ContextBase, scene SceneName) error {
 	if err != nil {
 		return fmt.Errorf("getSessionBase: %w", err)
 	}
+	from := base.Step
+	if base.Scene != scene {
+		from = -1
+	}
 	base.Scene = scene
+	if vs, ok := sc.(VersionedScene); ok {
+		base.DataVersion = vs.DataSchema().Version()
+	}
 	c.markDirty()
 
 	// Save scene change
@@ -163,30 +338,77 @@ func (s *Scenario) enter(c ContextBase, scene SceneName) error {
 	if err := c.setSessionBase(base); err != nil {
 		return fmt.Errorf("setSessionBase: %w", err)
 	}
+	s.record(ctx, base, scene, from, base.Step, ReasonEnter)
 
-	// Immediately trigger the first step to send initial message
-	if err = sc.OnUpdate(c); err != nil {
-		return err
+	if _, ok := sc.(passiveEnterScene); !ok {
+		// Immediately trigger the first step to send initial message
+		step := base.Step
+		if err = sc.OnUpdate(c); err != nil {
+			return err
+		}
+
+		// Save if dirty after OnUpdate (only one conversion needed)
+		if err = s.persist(ctx, c, scene, step); err != nil {
+			return err
+		}
 	}
 
-	// Save if dirty after OnUpdate (only one conversion needed)
-	if c.isDirty() {
-		base, err = c.getSessionBase()
-		if err != nil {
-			return fmt.Errorf("getSessionBase: %w", err)
+	s.scheduleIdle(ctx, c)
+	return nil
+}
+
+// sceneContext returns a context of the data type of sc for the session of caller,
+// with the data of the entered scene restored when namespaces are enabled.
+func (s *Scenario) sceneContext(caller ContextBase, sc Scene) (ContextBase, error) {
+	base, err := caller.getSessionBase()
+	if err != nil {
+		return nil, fmt.Errorf("getSessionBase: %w", err)
+	}
+	switched := base
+	if s.namespaces {
+		if switched, err = s.switchData(base, sc.Name()); err != nil {
+			return nil, err
 		}
-		err = s.store.SetSession(ctx, base)
-		if err != nil {
-			return fmt.Errorf("store.SetSession: %w", err)
+	}
+
+	if _, ok := sc.(TypedScene); !ok {
+		if switched != base {
+			if err := caller.setSessionBase(switched); err != nil {
+				return nil, fmt.Errorf("setSessionBase: %w", err)
+			}
+			caller.markDirty()
 		}
-		c.clearDirty()
+		return caller, nil
 	}
 
-	return nil
+	c, err := createTypedContext(sc, s, caller.teleContext(), switched)
+	if err != nil {
+		return nil, fmt.Errorf("createTypedContext: %w", err)
+	}
+	if switched != base || caller.isDirty() {
+		c.markDirty()
+	}
+	return c, nil
+}
+
+// syncCaller updates the caller with the session saved by the context of the entered scene.
+// A caller of another data type is detached, so it doesn't overwrite the session.
+func (s *Scenario) syncCaller(caller, c ContextBase) {
+	base, err := c.getSessionBase()
+	if err == nil && reflect.TypeOf(caller) == reflect.TypeOf(c) {
+		if err = caller.setSessionBase(base); err == nil {
+			if c.isDirty() {
+				caller.markDirty()
+			}
+			return
+		}
+	}
+	caller.detach()
 }
 
 // leave clears current scene and calls Leave if any.
-func (s *Scenario) leave(c ContextBase) error {
+// reason is recorded to the history store.
+func (s *Scenario) leave(c ContextBase, reason string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -195,10 +417,11 @@ func (s *Scenario) leave(c ContextBase) error {
 		return fmt.Errorf("getSessionBase: %w", err)
 	}
 
-	sc, ok := s.scenes[base.Scene]
+	sc, ok := s.scene(base.Scene)
 	if !ok {
 		return ErrSceneNotFound
 	}
+	scene, step := base.Scene, base.Step
 
 	err = sc.Leave(c)
 	if err != nil {
@@ -211,8 +434,20 @@ func (s *Scenario) leave(c ContextBase) error {
 		return fmt.Errorf("getSessionBase after Leave: %w", err)
 	}
 
+	s.cleanupMessages(ctx, scene, base)
+
 	// Clear scene and save (reuse base to avoid double conversion)
+	switch {
+	case s.namespaces:
+		if err = s.stashData(base); err != nil {
+			return fmt.Errorf("stashData: %w", err)
+		}
+	case s.clearsData(sc):
+		base.Data, base.Codec, base.DataVersion = nil, "", 0
+	}
 	base.Scene = ""
+	s.cancelJobs(ctx, base)
+	s.cancelIdle(ctx, sc, base)
 	c.markDirty()
 	err = s.store.SetSession(ctx, base)
 	if err != nil {
@@ -222,6 +457,87 @@ func (s *Scenario) leave(c ContextBase) error {
 		return fmt.Errorf("setSessionBase: %w", err)
 	}
 	c.clearDirty()
+	s.record(ctx, base, scene, step, base.Step, reason)
 
 	return nil
 }
+
+// sessionLocks are mutexes of sessions, dropped once nobody holds or waits for them.
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	ch   chan struct{} // holds a value while the session is locked
+	refs int
+}
+
+// heldSession marks a context of code running under the lock of a session.
+type heldSession struct {
+	locks *sessionLocks
+	key   string
+}
+
+// lock locks the session of userID in chatID and returns the unlock function.
+// It waits until ctx is done; a session already held by ctx is not locked again.
+func (l *sessionLocks) lock(ctx context.Context, chatID, userID int64) (func(), error) {
+	k := key(chatID, userID)
+	if ctx.Value(heldSession{l, k}) != nil {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sessionLock)
+	}
+	sl, ok := l.locks[k]
+	if !ok {
+		sl = &sessionLock{ch: make(chan struct{}, 1)}
+		l.locks[k] = sl
+	}
+	sl.refs++
+	l.mu.Unlock()
+
+	release := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if sl.refs--; sl.refs == 0 {
+			delete(l.locks, k)
+		}
+	}
+
+	select {
+	case sl.ch <- struct{}{}:
+	case <-ctx.Done():
+		release()
+		return nil, fmt.Errorf("lock session %s: %w", k, ctx.Err())
+	}
+	return func() {
+		<-sl.ch
+		release()
+	}, nil
+}
+
+// hold returns ctx marked as holding the lock of the session.
+func (l *sessionLocks) hold(ctx context.Context, chatID, userID int64) context.Context {
+	return context.WithValue(ctx, heldSession{l, key(chatID, userID)}, true)
+}
+
+// updateContext is a tele.Context of an update handled under the session lock.
+type updateContext struct {
+	tele.Context
+	ctx context.Context
+}
+
+// UpdateContext returns the context of the update handled by c. Pass it to Broadcast
+// or FSMScene.Fire called from a handler, so they don't wait for the session locked by the update.
+func UpdateContext(c tele.Context) context.Context {
+	if cb, ok := c.(ContextBase); ok {
+		c = cb.teleContext()
+	}
+	if uc, ok := c.(*updateContext); ok {
+		return uc.ctx
+	}
+	return context.Background()
+}
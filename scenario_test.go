@@ -127,7 +127,7 @@ func TestScenarioLeave(t *testing.T) {
 	}
 	context := newCtx(scenario, mockCtx, sess)
 
-	err := scenario.leave(context)
+	err := scenario.leave(context, ReasonLeave)
 	require.NoError(t, err)
 	assert.True(t, scene.left)
 	assert.Equal(t, SceneName(""), context.Session.Scene) // scene should be cleared
@@ -148,7 +148,7 @@ func TestScenarioLeaveNonExistentScene(t *testing.T) {
 	sess := &Session[TestData]{Scene: "non_existent"}
 	context := newCtx(scenario, mockCtx, sess)
 
-	err := scenario.leave(context)
+	err := scenario.leave(context, ReasonLeave)
 	assert.Error(t, err)
 	assert.Equal(t, ErrSceneNotFound, err)
 }
@@ -0,0 +1,343 @@
+// Package scenariotest runs scenes against a fake Telegram Bot API,
+// so conversations can be tested without gomock expectations or network.
+//
+//	bot := scenariotest.NewBot(t)
+//	scn := scenario.New(bot.Bot)
+//	bot.Use(scn.Middleware)
+//	bot.Handle("/start", startHandler)
+//	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+//
+//	bot.Conversation(scn).
+//		Send("/start").ExpectReply("Введите ваше имя").
+//		Send("Bob").ExpectReply("введите ваше ДР")
+package scenariotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+)
+
+// Call is a recorded Bot API request.
+type Call struct {
+	Method string            `json:"method"`
+	Params map[string]string `json:"params"`
+	// MessageID is the id of the message returned to the bot, 0 for non-message results.
+	MessageID int `json:"message_id,omitempty"`
+}
+
+// ChatID returns the chat the call was addressed to.
+func (c Call) ChatID() int64 {
+	id, _ := strconv.ParseInt(c.Params["chat_id"], 10, 64)
+	return id
+}
+
+// Text returns the message text or media caption.
+func (c Call) Text() string {
+	if text, ok := c.Params["text"]; ok {
+		return text
+	}
+	return c.Params["caption"]
+}
+
+// ReplyMarkup returns the decoded reply markup, nil if the call has none.
+func (c Call) ReplyMarkup() *tele.ReplyMarkup {
+	raw, ok := c.Params["reply_markup"]
+	if !ok || raw == "" {
+		return nil
+	}
+	var markup tele.ReplyMarkup
+	if err := json.Unmarshal([]byte(raw), &markup); err != nil {
+		return nil
+	}
+	return &markup
+}
+
+// IsMessage reports whether the call sends or edits a message.
+func (c Call) IsMessage() bool {
+	return strings.HasPrefix(c.Method, "send") || strings.HasPrefix(c.Method, "edit") ||
+		c.Method == "copyMessage" || c.Method == "forwardMessage"
+}
+
+// Responder overrides the fake API answer to a method.
+// It returns the result object, or a non-empty description to answer with an API error.
+type Responder func(call Call) (result any, errDescription string)
+
+// Bot is a tele.Bot connected to an in-process fake Bot API server.
+// Updates are processed synchronously, all requests are recorded.
+type Bot struct {
+	*tele.Bot
+
+	t      testing.TB
+	server *httptest.Server
+
+	mu         sync.Mutex
+	calls      []Call
+	errs       []error
+	nextID     int
+	updateID   int
+	responders map[string]Responder
+}
+
+// NewBot starts a fake Bot API server stopped on test cleanup.
+func NewBot(t testing.TB) *Bot {
+	t.Helper()
+
+	b, err := Open()
+	if err != nil {
+		t.Fatalf("scenariotest: %v", err)
+	}
+	b.t = t
+	t.Cleanup(b.Close)
+
+	return b
+}
+
+// Open starts a fake Bot API server outside of tests, e.g. for the REPL.
+// Conversations need a bot created by NewBot.
+func Open() (*Bot, error) {
+	b := &Bot{
+		nextID:     1000,
+		responders: make(map[string]Responder),
+	}
+	b.server = httptest.NewServer(http.HandlerFunc(b.serveHTTP))
+
+	bot, err := tele.NewBot(tele.Settings{
+		URL:         b.server.URL,
+		Token:       "test",
+		Offline:     true,
+		Synchronous: true,
+		OnError: func(err error, _ tele.Context) {
+			b.mu.Lock()
+			b.errs = append(b.errs, err)
+			b.mu.Unlock()
+		},
+	})
+	if err != nil {
+		b.server.Close()
+		return nil, fmt.Errorf("tele.NewBot: %w", err)
+	}
+	bot.Me = &tele.User{ID: 1, IsBot: true, FirstName: "Test", Username: "test_bot"}
+	b.Bot = bot
+
+	return b, nil
+}
+
+// Close stops the fake Bot API server.
+func (b *Bot) Close() {
+	b.server.Close()
+}
+
+// Respond overrides the answer of the fake API to method.
+func (b *Bot) Respond(method string, fn Responder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.responders[method] = fn
+}
+
+// Calls returns all recorded requests.
+func (b *Bot) Calls() []Call {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Call(nil), b.calls...)
+}
+
+// Errors returns errors returned by handlers.
+func (b *Bot) Errors() []error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]error(nil), b.errs...)
+}
+
+// Conversation starts a private chat of a default user with the bot.
+func (b *Bot) Conversation(scn *scenario.Scenario) *Conversation {
+	chat, user := defaultChat()
+	return b.ConversationWith(scn, chat, user)
+}
+
+// ConversationWith starts a conversation of user in chat, e.g. in a group.
+func (b *Bot) ConversationWith(scn *scenario.Scenario, chat *tele.Chat, user *tele.User) *Conversation {
+	return &Conversation{bot: b, scn: scn, chat: chat, user: user}
+}
+
+func defaultChat() (*tele.Chat, *tele.User) {
+	user := &tele.User{ID: 42, FirstName: "Test", Username: "test_user", LanguageCode: "ru"}
+	return &tele.Chat{ID: user.ID, Type: tele.ChatPrivate}, user
+}
+
+// messageUpdate fills in m as sent by user in chat.
+func (b *Bot) messageUpdate(chat *tele.Chat, user *tele.User, m *tele.Message) tele.Update {
+	m.ID = b.newMessageID()
+	m.Chat = chat
+	m.Sender = user
+	m.Unixtime = time.Now().Unix()
+	return tele.Update{ID: b.newUpdateID(), Message: m}
+}
+
+// callbackUpdate presses a button with data on the last bot message with an inline keyboard in chat.
+func (b *Bot) callbackUpdate(chat *tele.Chat, user *tele.User, data string) tele.Update {
+	msg := &tele.Message{Chat: chat, Sender: b.Me}
+	if last, ok := b.lastMarkupCall(chat.ID); ok {
+		msg.ID = last.MessageID
+		msg.Text = last.Text()
+		msg.ReplyMarkup = last.ReplyMarkup()
+	}
+
+	id := b.newUpdateID()
+	return tele.Update{ID: id, Callback: &tele.Callback{
+		ID:      "cb" + strconv.Itoa(id),
+		Sender:  user,
+		Message: msg,
+		Data:    data,
+	}}
+}
+
+// lastMarkupCall returns the last bot message to chatID with an inline keyboard.
+func (b *Bot) lastMarkupCall(chatID int64) (Call, bool) {
+	calls := b.Calls()
+	for i := len(calls) - 1; i >= 0; i-- {
+		call := calls[i]
+		if !call.IsMessage() || call.ChatID() != chatID {
+			continue
+		}
+		if markup := call.ReplyMarkup(); markup != nil && len(markup.InlineKeyboard) > 0 {
+			return call, true
+		}
+	}
+	return Call{}, false
+}
+
+// findButton returns callback data of the inline button on the last keyboard in chatID
+// matching text or data, with or without the telebot "\f<unique>|" prefix.
+func (b *Bot) findButton(chatID int64, s string) (string, bool) {
+	last, ok := b.lastMarkupCall(chatID)
+	if !ok {
+		return "", false
+	}
+	for _, row := range last.ReplyMarkup().InlineKeyboard {
+		for _, btn := range row {
+			if btn.Text == s || btn.Data == s || strings.TrimPrefix(btn.Data, "\f") == s {
+				return btn.Data, true
+			}
+			if _, data, found := strings.Cut(btn.Data, "|"); found && data == s {
+				return btn.Data, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (b *Bot) newUpdateID() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updateID++
+	return b.updateID
+}
+
+func (b *Bot) newMessageID() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	return b.nextID
+}
+
+func (b *Bot) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	call := Call{Method: method, Params: readParams(r)}
+
+	b.mu.Lock()
+	responder := b.responders[method]
+	b.mu.Unlock()
+
+	var result any = true
+	if responder != nil {
+		var description string
+		if result, description = responder(call); description != "" {
+			b.record(call)
+			writeJSON(w, map[string]any{"ok": false, "error_code": http.StatusBadRequest, "description": description})
+			return
+		}
+	} else if call.IsMessage() {
+		call.MessageID = b.newMessageID()
+		result = fakeMessage(call)
+	}
+	if m, ok := result.(map[string]any); ok {
+		if id, ok := m["message_id"].(int); ok {
+			call.MessageID = id
+		}
+	}
+
+	b.record(call)
+	writeJSON(w, map[string]any{"ok": true, "result": result})
+}
+
+func (b *Bot) record(call Call) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, call)
+}
+
+func fakeMessage(call Call) map[string]any {
+	msg := map[string]any{
+		"message_id": call.MessageID,
+		"date":       time.Now().Unix(),
+		"chat":       map[string]any{"id": call.ChatID(), "type": "private"},
+		"from":       map[string]any{"id": 1, "is_bot": true, "first_name": "Test"},
+	}
+	if text := call.Params["text"]; text != "" {
+		msg["text"] = text
+	}
+	if caption := call.Params["caption"]; caption != "" {
+		msg["caption"] = caption
+	}
+	if markup := call.Params["reply_markup"]; markup != "" {
+		msg["reply_markup"] = json.RawMessage(markup)
+	}
+	return msg
+}
+
+// readParams reads JSON or multipart parameters as strings, the way telebot sends them.
+func readParams(r *http.Request) map[string]string {
+	params := make(map[string]string)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if err := r.ParseMultipartForm(32 << 20); err == nil {
+			for k, v := range r.MultipartForm.Value {
+				params[k] = v[0]
+			}
+			for k, v := range r.MultipartForm.File {
+				params[k] = "attach://" + v[0].Filename
+			}
+		}
+		return params
+	}
+
+	var raw map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return params
+	}
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			params[k] = s
+			continue
+		}
+		data, _ := json.Marshal(v)
+		params[k] = string(data)
+	}
+	return params
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,220 @@
+package scenariotest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+)
+
+// Conversation feeds updates of one user in one chat and asserts bot replies.
+// Every Send* and Press* call processes one update; Expect* methods check
+// messages the bot sent to the chat while handling it, in order.
+type Conversation struct {
+	bot  *Bot
+	scn  *scenario.Scenario
+	chat *tele.Chat
+	user *tele.User
+
+	replies  []Call // bot messages sent to the chat during the last update
+	consumed int    // replies already matched by Expect*
+}
+
+// Chat returns the conversation chat.
+func (c *Conversation) Chat() *tele.Chat { return c.chat }
+
+// User returns the conversation user.
+func (c *Conversation) User() *tele.User { return c.user }
+
+// Send sends a text message. Text starting with "/" is handled as a command.
+func (c *Conversation) Send(text string) *Conversation {
+	c.bot.t.Helper()
+	return c.SendMessage(&tele.Message{Text: text})
+}
+
+// SendContact shares the user's own contact.
+func (c *Conversation) SendContact(phone string) *Conversation {
+	c.bot.t.Helper()
+	return c.SendMessage(&tele.Message{Contact: &tele.Contact{
+		PhoneNumber: phone,
+		FirstName:   c.user.FirstName,
+		UserID:      c.user.ID,
+	}})
+}
+
+// SendPhoto sends a photo with the given file id and caption.
+func (c *Conversation) SendPhoto(fileID, caption string) *Conversation {
+	c.bot.t.Helper()
+	return c.SendMessage(&tele.Message{
+		Photo:   &tele.Photo{File: tele.File{FileID: fileID, UniqueID: fileID}, Width: 800, Height: 600},
+		Caption: caption,
+	})
+}
+
+// SendDocument sends a document with the given file id.
+func (c *Conversation) SendDocument(fileID, fileName, mime string) *Conversation {
+	c.bot.t.Helper()
+	return c.SendMessage(&tele.Message{Document: &tele.Document{
+		File:     tele.File{FileID: fileID, UniqueID: fileID},
+		FileName: fileName,
+		MIME:     mime,
+	}})
+}
+
+// SendMessage sends m from the conversation user; ID, chat, sender and date are filled in.
+func (c *Conversation) SendMessage(m *tele.Message) *Conversation {
+	c.bot.t.Helper()
+	return c.process(c.bot.messageUpdate(c.chat, c.user, m))
+}
+
+// Press presses an inline button with raw callback data on the last bot message.
+func (c *Conversation) Press(data string) *Conversation {
+	c.bot.t.Helper()
+	return c.process(c.bot.callbackUpdate(c.chat, c.user, data))
+}
+
+// PressButton presses the inline button with text on the last bot message with an inline keyboard.
+func (c *Conversation) PressButton(text string) *Conversation {
+	c.bot.t.Helper()
+	for _, row := range c.lastKeyboard() {
+		for _, btn := range row {
+			if btn.Text == text {
+				return c.Press(btn.Data)
+			}
+		}
+	}
+
+	c.bot.t.Errorf("scenariotest: no inline button %q on the last keyboard", text)
+	return c
+}
+
+// Replies returns bot messages sent to the chat while handling the last update.
+func (c *Conversation) Replies() []Call {
+	return append([]Call(nil), c.replies...)
+}
+
+// ExpectReply checks that the next bot message has exactly text.
+func (c *Conversation) ExpectReply(text string) *Conversation {
+	c.bot.t.Helper()
+	if call, ok := c.next(); ok && call.Text() != text {
+		c.bot.t.Errorf("scenariotest: expected reply %q, got %q", text, call.Text())
+	}
+	return c
+}
+
+// ExpectReplyContains checks that the next bot message contains substr.
+func (c *Conversation) ExpectReplyContains(substr string) *Conversation {
+	c.bot.t.Helper()
+	if call, ok := c.next(); ok && !strings.Contains(call.Text(), substr) {
+		c.bot.t.Errorf("scenariotest: expected reply containing %q, got %q", substr, call.Text())
+	}
+	return c
+}
+
+// ExpectReplyFunc checks the next bot message with fn.
+func (c *Conversation) ExpectReplyFunc(fn func(Call) error) *Conversation {
+	c.bot.t.Helper()
+	if call, ok := c.next(); ok {
+		if err := fn(call); err != nil {
+			c.bot.t.Errorf("scenariotest: reply %q: %v", call.Text(), err)
+		}
+	}
+	return c
+}
+
+// ExpectNoReply checks that the bot sent nothing else while handling the last update.
+func (c *Conversation) ExpectNoReply() *Conversation {
+	c.bot.t.Helper()
+	if rest := c.replies[c.consumed:]; len(rest) > 0 {
+		c.bot.t.Errorf("scenariotest: expected no reply, got %q", rest[0].Text())
+	}
+	return c
+}
+
+// ExpectScene checks the active scene of the conversation; empty name means no active scene.
+func (c *Conversation) ExpectScene(name scenario.SceneName) *Conversation {
+	c.bot.t.Helper()
+	if sess := c.session(); sess != nil && sess.Scene != name {
+		c.bot.t.Errorf("scenariotest: expected scene %q, got %q", name, sess.Scene)
+	}
+	return c
+}
+
+// ExpectStep checks the step of the active scene.
+func (c *Conversation) ExpectStep(step int) *Conversation {
+	c.bot.t.Helper()
+	if sess := c.session(); sess != nil && sess.Step != step {
+		c.bot.t.Errorf("scenariotest: expected step %d, got %d", step, sess.Step)
+	}
+	return c
+}
+
+// Session returns the stored session decoded into T.
+func Session[T any](c *Conversation) *scenario.Session[T] {
+	c.bot.t.Helper()
+	sess, err := scenario.GetSession[T](context.Background(), c.scn, c.chat.ID, c.user.ID)
+	if errors.Is(err, scenario.ErrSessionNotFound) {
+		return &scenario.Session[T]{ChatID: c.chat.ID, UserID: c.user.ID}
+	}
+	if err != nil {
+		c.bot.t.Fatalf("scenariotest: GetSession: %v", err)
+	}
+	return sess
+}
+
+// ExpectData checks that the stored session data equals want.
+func ExpectData[T any](c *Conversation, want T) *Conversation {
+	c.bot.t.Helper()
+	if got := Session[T](c).Data; !reflect.DeepEqual(got, want) {
+		c.bot.t.Errorf("scenariotest: expected session data %+v, got %+v", want, got)
+	}
+	return c
+}
+
+func (c *Conversation) session() *scenario.Session[any] {
+	c.bot.t.Helper()
+	return Session[any](c)
+}
+
+func (c *Conversation) next() (Call, bool) {
+	c.bot.t.Helper()
+	if c.consumed >= len(c.replies) {
+		c.bot.t.Errorf("scenariotest: expected a reply, bot sent %d message(s)", len(c.replies))
+		return Call{}, false
+	}
+	call := c.replies[c.consumed]
+	c.consumed++
+	return call, true
+}
+
+func (c *Conversation) process(u tele.Update) *Conversation {
+	c.bot.t.Helper()
+
+	calls, errs := len(c.bot.Calls()), len(c.bot.Errors())
+
+	c.bot.ProcessUpdate(u)
+
+	c.replies = c.replies[:0]
+	c.consumed = 0
+	for _, call := range c.bot.Calls()[calls:] {
+		if call.IsMessage() && call.ChatID() == c.chat.ID {
+			c.replies = append(c.replies, call)
+		}
+	}
+	for _, err := range c.bot.Errors()[errs:] {
+		c.bot.t.Errorf("scenariotest: handler error: %v", err)
+	}
+
+	return c
+}
+
+func (c *Conversation) lastKeyboard() [][]tele.InlineButton {
+	if last, ok := c.bot.lastMarkupCall(c.chat.ID); ok {
+		return last.ReplyMarkup().InlineKeyboard
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package scenariotest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "regenerate scenariotest golden transcripts")
+
+// TranscriptEntry is the outcome of one replayed update:
+// everything the bot sent while handling it and the session left behind.
+type TranscriptEntry struct {
+	UpdateID int           `json:"update_id"`
+	Calls    []Call        `json:"calls,omitempty"`
+	Session  *SessionState `json:"session,omitempty"`
+	Errors   []string      `json:"errors,omitempty"`
+}
+
+// SessionState is the stored session of the update sender after the update.
+type SessionState struct {
+	Scene scenario.SceneName `json:"scene,omitempty"`
+	Step  int                `json:"step"`
+	Data  any                `json:"data,omitempty"`
+}
+
+// Transcript processes updates through bot and describes the outcome of each.
+// Sessions are read back from the scenario store, so any Store implementation is covered.
+func Transcript(bot *Bot, scn *scenario.Scenario, updates []tele.Update) ([]TranscriptEntry, error) {
+	entries := make([]TranscriptEntry, 0, len(updates))
+
+	for _, u := range updates {
+		calls, errs := len(bot.Calls()), len(bot.Errors())
+		bot.ProcessUpdate(u)
+
+		entry := TranscriptEntry{UpdateID: u.ID, Calls: bot.Calls()[calls:]}
+		for _, err := range bot.Errors()[errs:] {
+			entry.Errors = append(entry.Errors, err.Error())
+		}
+
+		if chatID, userID, ok := updateSender(u); ok {
+			sess, err := scenario.GetSession[any](context.Background(), scn, chatID, userID)
+			switch {
+			case errors.Is(err, scenario.ErrSessionNotFound):
+			case err != nil:
+				return nil, err
+			default:
+				entry.Session = &SessionState{Scene: sess.Scene, Step: sess.Step, Data: sess.Data}
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Replay feeds updates recorded by Recorder at updatesPath through bot and compares
+// the transcript with the golden file. Run tests with -update-golden to regenerate it.
+//
+//	func TestRegisterGolden(t *testing.T) {
+//		bot, scn := newBot(t)
+//		scenariotest.Replay(t, bot, scn, "testdata/register.jsonl", "testdata/register.golden.jsonl")
+//	}
+func Replay(t testing.TB, bot *Bot, scn *scenario.Scenario, updatesPath, goldenPath string) {
+	t.Helper()
+
+	f, err := os.Open(updatesPath)
+	if err != nil {
+		t.Fatalf("scenariotest: %v", err)
+	}
+	defer f.Close()
+
+	updates, err := ReadUpdates(f)
+	if err != nil {
+		t.Fatalf("scenariotest: %s: %v", updatesPath, err)
+	}
+
+	entries, err := Transcript(bot, scn, updates)
+	if err != nil {
+		t.Fatalf("scenariotest: replay %s: %v", updatesPath, err)
+	}
+
+	var got bytes.Buffer
+	enc := json.NewEncoder(&got)
+	enc.SetEscapeHTML(false)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			t.Fatalf("scenariotest: encode transcript: %v", err)
+		}
+	}
+
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0o755); err != nil {
+			t.Fatalf("scenariotest: %v", err)
+		}
+		if err := os.WriteFile(goldenPath, got.Bytes(), 0o644); err != nil {
+			t.Fatalf("scenariotest: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("scenariotest: %v (run with -update-golden to create it)", err)
+	}
+
+	compareTranscripts(t, goldenPath, string(want), got.String())
+}
+
+func compareTranscripts(t testing.TB, goldenPath, want, got string) {
+	t.Helper()
+
+	wantLines := strings.Split(strings.TrimRight(want, "\n"), "\n")
+	gotLines := strings.Split(strings.TrimRight(got, "\n"), "\n")
+
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			t.Errorf("scenariotest: transcript differs from %s at update #%d:\nwant: %s\n got: %s\n(run with -update-golden to accept)",
+				goldenPath, i+1, w, g)
+			return
+		}
+	}
+}
+
+// updateSender returns chat and user whose session the update affects.
+func updateSender(u tele.Update) (chatID, userID int64, ok bool) {
+	switch {
+	case u.Message != nil && u.Message.Chat != nil && u.Message.Sender != nil:
+		return u.Message.Chat.ID, u.Message.Sender.ID, true
+	case u.Callback != nil && u.Callback.Message != nil && u.Callback.Message.Chat != nil && u.Callback.Sender != nil:
+		return u.Callback.Message.Chat.ID, u.Callback.Sender.ID, true
+	default:
+		return 0, 0, false
+	}
+}
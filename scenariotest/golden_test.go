@@ -0,0 +1,135 @@
+package scenariotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+)
+
+func TestReplayGolden(t *testing.T) {
+	bot, scn := newRegisterBot(t)
+	Replay(t, bot, scn, "testdata/register.jsonl", "testdata/register.golden.jsonl")
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+
+	bot := NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(rec.Middleware)
+	bot.Handle("/start", func(tele.Context) error { return nil })
+	bot.Handle(tele.OnContact, func(tele.Context) error { return nil })
+
+	user := &tele.User{ID: 987654321, FirstName: "Иван", LastName: "Петров", Username: "ivan"}
+	conv := bot.ConversationWith(scn, &tele.Chat{ID: user.ID, Type: tele.ChatPrivate, Username: "ivan"}, user)
+	conv.Send("/start").SendContact("+79991234567")
+
+	updates, err := ReadUpdates(&buf)
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+
+	for _, u := range updates {
+		assert.Equal(t, int64(1), u.Message.Sender.ID)
+		assert.Equal(t, int64(1), u.Message.Chat.ID)
+		assert.Equal(t, "User1", u.Message.Sender.FirstName)
+		assert.Empty(t, u.Message.Sender.LastName)
+		assert.Empty(t, u.Message.Sender.Username)
+		assert.Empty(t, u.Message.Chat.Username)
+	}
+	assert.Equal(t, "/start", updates[0].Message.Text)
+	assert.Equal(t, int64(1), updates[1].Message.Contact.UserID)
+	assert.NotContains(t, buf.String(), "9991234567")
+
+	// the live update is not modified
+	assert.Equal(t, int64(987654321), conv.User().ID)
+}
+
+func TestAnonymizerRedactor(t *testing.T) {
+	anon := NewAnonymizer().WithRedactor(func(s string) string { return strings.Repeat("*", len([]rune(s))) })
+
+	u, err := anon.Anonymize(tele.Update{Message: &tele.Message{
+		Text:   "secret",
+		Sender: &tele.User{ID: 10},
+		Chat:   &tele.Chat{ID: -10010, Title: "Team"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "******", u.Message.Text)
+	assert.Equal(t, int64(1), u.Message.Sender.ID)
+	assert.Equal(t, int64(-2), u.Message.Chat.ID)
+	assert.Equal(t, "Chat-2", u.Message.Chat.Title)
+}
+
+func TestAnonymizerPersonalData(t *testing.T) {
+	anon := NewAnonymizer()
+
+	// a contact as sent by Telegram, with a vCard
+	var contact tele.Contact
+	require.NoError(t, json.Unmarshal([]byte(`{"phone_number":"+79991234567","first_name":"Иван","user_id":10,"vcard":"BEGIN:VCARD\nTEL:+79991234567\nEND:VCARD"}`), &contact))
+
+	u, err := anon.Anonymize(tele.Update{Message: &tele.Message{
+		Sender:             &tele.User{ID: 10},
+		Chat:               &tele.Chat{ID: 10},
+		Contact:            &contact,
+		Location:           &tele.Location{Lat: 55.7558, Lng: 37.6173},
+		Venue:              &tele.Venue{Location: tele.Location{Lat: 55.7558, Lng: 37.6173}, Title: "Дом Ивана", Address: "Тверская, 1", GooglePlaceID: "place"},
+		OriginalSender:     &tele.User{ID: 20, FirstName: "Пётр", Username: "petr"},
+		OriginalChat:       &tele.Chat{ID: -30, Title: "Секретный канал", Username: "secret"},
+		OriginalSenderName: "Пётр",
+		OriginalSignature:  "Пётр П.",
+		Origin: &tele.MessageOrigin{
+			Sender:         &tele.User{ID: 20, FirstName: "Пётр"},
+			SenderUsername: "Пётр",
+			Chat:           &tele.Chat{ID: -30, Title: "Секретный канал"},
+			Signature:      "Пётр П.",
+		},
+	}})
+	require.NoError(t, err)
+
+	data, err := json.Marshal(u)
+	require.NoError(t, err)
+	for _, leak := range []string{"9991234567", "VCARD", "55.75", "37.61", "Ивана", "Тверская", "place", "Пётр", "petr", "Секретный", "secret"} {
+		assert.NotContains(t, string(data), leak)
+	}
+	m := u.Message
+	assert.Equal(t, int64(2), m.OriginalSender.ID)
+	assert.Equal(t, int64(-3), m.OriginalChat.ID)
+	assert.Equal(t, int64(2), m.Origin.Sender.ID)
+	assert.Equal(t, int64(-3), m.Origin.Chat.ID)
+}
+
+func TestReplayDetectsRegression(t *testing.T) {
+	dir := t.TempDir()
+	golden := filepath.Join(dir, "register.golden.jsonl")
+
+	data, err := os.ReadFile("testdata/register.golden.jsonl")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(golden, bytes.Replace(data, []byte("Спасибо!"), []byte("Готово"), 1), 0o644))
+
+	bot, scn := newRegisterBot(t)
+	ft := &fakeT{TB: t}
+	Replay(ft, bot, scn, "testdata/register.jsonl", golden)
+	require.Len(t, ft.errors, 1)
+	assert.Contains(t, ft.errors[0], "update #4")
+}
+
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,209 @@
+package scenariotest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Recorder is a bot middleware writing incoming updates as JSONL,
+// one anonymized update per line, for later Replay.
+//
+//	f, _ := os.OpenFile("updates.jsonl", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+//	bot.Use(scenariotest.NewRecorder(f).Middleware)
+type Recorder struct {
+	mu   sync.Mutex
+	enc  *json.Encoder
+	anon *Anonymizer
+}
+
+// NewRecorder writes updates to w anonymized with a fresh Anonymizer.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w), anon: NewAnonymizer()}
+}
+
+// WithAnonymizer replaces the anonymizer, e.g. to redact message texts.
+func (r *Recorder) WithAnonymizer(anon *Anonymizer) *Recorder {
+	r.anon = anon
+	return r
+}
+
+// Record writes a single update.
+func (r *Recorder) Record(u tele.Update) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	anonymized, err := r.anon.Anonymize(u)
+	if err != nil {
+		return err
+	}
+	if err := r.enc.Encode(anonymized); err != nil {
+		return fmt.Errorf("write update: %w", err)
+	}
+	return nil
+}
+
+// Middleware records every update before passing it on.
+// Recording failures are logged and don't interrupt the update.
+func (r *Recorder) Middleware(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		if err := r.Record(c.Update()); err != nil {
+			slog.Error("failed to record update", "error", err)
+		}
+		return next(c)
+	}
+}
+
+// ReadUpdates reads updates written by Recorder.
+func ReadUpdates(r io.Reader) ([]tele.Update, error) {
+	var updates []tele.Update
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var u tele.Update
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		updates = append(updates, u)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read updates: %w", err)
+	}
+
+	return updates, nil
+}
+
+// Anonymizer replaces user and chat identities in updates with stable pseudonyms:
+// the same real ID always maps to the same fake ID within one Anonymizer.
+// Names, usernames and phone numbers are replaced, including origins of forwarded messages,
+// locations and venues are blanked, texts are kept unless a redactor is set.
+type Anonymizer struct {
+	mu     sync.Mutex
+	ids    map[int64]int64
+	redact func(string) string
+}
+
+// NewAnonymizer .
+func NewAnonymizer() *Anonymizer {
+	return &Anonymizer{ids: make(map[int64]int64)}
+}
+
+// WithRedactor sets a function applied to message texts and captions.
+func (a *Anonymizer) WithRedactor(redact func(string) string) *Anonymizer {
+	a.redact = redact
+	return a
+}
+
+// Anonymize returns an anonymized copy of u.
+func (a *Anonymizer) Anonymize(u tele.Update) (tele.Update, error) {
+	// A JSON round trip gives a deep copy, so the live update is never modified.
+	data, err := json.Marshal(u)
+	if err != nil {
+		return u, fmt.Errorf("copy update: %w", err)
+	}
+	var cp tele.Update
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return u, fmt.Errorf("copy update: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.message(cp.Message)
+	a.message(cp.EditedMessage)
+	if cp.Callback != nil {
+		a.user(cp.Callback.Sender)
+		a.message(cp.Callback.Message)
+	}
+
+	return cp, nil
+}
+
+func (a *Anonymizer) id(real int64) int64 {
+	if real == 0 {
+		return 0
+	}
+
+	abs := real
+	if abs < 0 {
+		abs = -abs
+	}
+	fake, ok := a.ids[abs]
+	if !ok {
+		fake = int64(len(a.ids) + 1)
+		a.ids[abs] = fake
+	}
+
+	if real < 0 {
+		return -fake
+	}
+	return fake
+}
+
+func (a *Anonymizer) user(u *tele.User) {
+	if u == nil || u.IsBot {
+		return
+	}
+	u.ID = a.id(u.ID)
+	u.FirstName = "User" + strconv.FormatInt(u.ID, 10)
+	u.LastName = ""
+	u.Username = ""
+}
+
+func (a *Anonymizer) chat(c *tele.Chat) {
+	if c == nil {
+		return
+	}
+	c.ID = a.id(c.ID)
+	c.FirstName, c.LastName, c.Username = "", "", ""
+	if c.Title != "" {
+		c.Title = "Chat" + strconv.FormatInt(c.ID, 10)
+	}
+}
+
+func (a *Anonymizer) message(m *tele.Message) {
+	if m == nil {
+		return
+	}
+
+	a.user(m.Sender)
+	a.chat(m.Chat)
+	a.chat(m.SenderChat)
+	a.user(m.OriginalSender)
+	a.chat(m.OriginalChat)
+	m.OriginalSenderName, m.OriginalSignature = "", ""
+	if o := m.Origin; o != nil {
+		a.user(o.Sender)
+		a.chat(o.SenderChat)
+		a.chat(o.Chat)
+		o.SenderUsername, o.Signature = "", ""
+	}
+	if m.Contact != nil {
+		// tele.Contact has no vCard field, vCards of updates never reach recordings
+		m.Contact.UserID = a.id(m.Contact.UserID)
+		m.Contact.PhoneNumber = "+" + strconv.FormatInt(79000000000+m.Contact.UserID, 10)
+		m.Contact.FirstName = "User" + strconv.FormatInt(m.Contact.UserID, 10)
+		m.Contact.LastName = ""
+	}
+	if m.Location != nil {
+		*m.Location = tele.Location{}
+	}
+	if m.Venue != nil {
+		*m.Venue = tele.Venue{Title: "Venue", Address: "Address"}
+	}
+	if a.redact != nil {
+		m.Text = a.redact(m.Text)
+		m.Caption = a.redact(m.Caption)
+	}
+	a.message(m.ReplyTo)
+}
@@ -0,0 +1,226 @@
+package scenariotest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+)
+
+const replHelp = `Type a message and press Enter to send it.
+  /btn <data|text>   press an inline button of the last keyboard
+  /contact <phone>   share a contact
+  /photo <file_id>   send a photo
+  /session           show the stored session
+  /help              show this help
+  /quit              exit
+Other lines starting with "/" are sent as commands.`
+
+// REPL runs a scenario against a simulated private chat in a terminal:
+// typed lines become messages and bot requests are printed as text.
+//
+//	bot, _ := scenariotest.Open()
+//	defer bot.Close()
+//	scn := scenario.New(bot.Bot)
+//	bot.Use(scn.Middleware)
+//	// register scenes and handlers as in production
+//	_ = scenariotest.NewREPL(bot, scn).Run(ctx, os.Stdin, os.Stdout)
+type REPL struct {
+	bot  *Bot
+	scn  *scenario.Scenario
+	chat *tele.Chat
+	user *tele.User
+}
+
+// NewREPL .
+func NewREPL(bot *Bot, scn *scenario.Scenario) *REPL {
+	chat, user := defaultChat()
+	return &REPL{bot: bot, scn: scn, chat: chat, user: user}
+}
+
+// Run reads lines from in until EOF, /quit or ctx cancellation. It is the entry point
+// for a terminal runner of your scenes, see examples/repl.
+func (r *REPL) Run(ctx context.Context, in io.Reader, out io.Writer) error {
+	fmt.Fprintln(out, replHelp)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lines, errc := readLines(ctx, in)
+	for {
+		fmt.Fprint(out, "> ")
+		var text string
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			return ctx.Err()
+		case err := <-errc:
+			fmt.Fprintln(out)
+			return err
+		case text = <-lines:
+		}
+
+		line := strings.TrimSpace(text)
+		if line == "" {
+			continue
+		}
+
+		cmd, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch cmd {
+		case "/quit", "/exit":
+			return nil
+		case "/help":
+			fmt.Fprintln(out, replHelp)
+		case "/session":
+			r.printSession(ctx, out)
+		case "/btn":
+			data, ok := r.bot.findButton(r.chat.ID, arg)
+			if !ok {
+				fmt.Fprintf(out, "no button %q on the last keyboard\n", arg)
+				continue
+			}
+			r.process(out, r.bot.callbackUpdate(r.chat, r.user, data))
+		case "/contact":
+			r.process(out, r.bot.messageUpdate(r.chat, r.user, &tele.Message{Contact: &tele.Contact{
+				PhoneNumber: arg,
+				FirstName:   r.user.FirstName,
+				UserID:      r.user.ID,
+			}}))
+		case "/photo":
+			r.process(out, r.bot.messageUpdate(r.chat, r.user, &tele.Message{
+				Photo: &tele.Photo{File: tele.File{FileID: arg, UniqueID: arg}},
+			}))
+		default:
+			r.process(out, r.bot.messageUpdate(r.chat, r.user, &tele.Message{Text: line}))
+		}
+	}
+}
+
+// readLines scans in in a goroutine, so that Run returns on ctx cancellation without
+// waiting for the next line. The goroutine ends at EOF; a blocked read of in outlives Run.
+func readLines(ctx context.Context, in io.Reader) (<-chan string, <-chan error) {
+	lines, errc := make(chan string), make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		errc <- scanner.Err()
+	}()
+	return lines, errc
+}
+
+func (r *REPL) process(out io.Writer, u tele.Update) {
+	calls, errs := len(r.bot.Calls()), len(r.bot.Errors())
+
+	r.bot.ProcessUpdate(u)
+
+	for _, call := range r.bot.Calls()[calls:] {
+		renderCall(out, call)
+	}
+	for _, err := range r.bot.Errors()[errs:] {
+		fmt.Fprintf(out, "error: %v\n", err)
+	}
+}
+
+func (r *REPL) printSession(ctx context.Context, out io.Writer) {
+	sess, err := scenario.GetSession[any](ctx, r.scn, r.chat.ID, r.user.ID)
+	if errors.Is(err, scenario.ErrSessionNotFound) {
+		fmt.Fprintln(out, "no session")
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(out, "error: %v\n", err)
+		return
+	}
+
+	data, _ := json.Marshal(sess.Data)
+	fmt.Fprintf(out, "scene=%q step=%d data=%s\n", sess.Scene, sess.Step, data)
+}
+
+// renderCall prints a bot request the way it would look in the chat.
+func renderCall(out io.Writer, call Call) {
+	switch {
+	case strings.HasPrefix(call.Method, "send"):
+		fmt.Fprintf(out, "bot: %s\n", callText(call))
+	case strings.HasPrefix(call.Method, "edit"):
+		fmt.Fprintf(out, "bot (edited #%s): %s\n", call.Params["message_id"], callText(call))
+	case call.Method == "answerCallbackQuery":
+		if text := call.Params["text"]; text != "" {
+			fmt.Fprintf(out, "bot (popup): %s\n", text)
+		}
+		return
+	case call.Method == "deleteMessage":
+		fmt.Fprintf(out, "bot deleted #%s\n", call.Params["message_id"])
+		return
+	default:
+		fmt.Fprintf(out, "bot called %s\n", call.Method)
+		return
+	}
+
+	renderMarkup(out, call.ReplyMarkup())
+}
+
+func callText(call Call) string {
+	if text := call.Text(); text != "" {
+		return text
+	}
+	media := strings.TrimPrefix(call.Method, "send")
+	if file := call.Params[strings.ToLower(media)]; file != "" {
+		return "[" + media + " " + file + "]"
+	}
+	return "[" + media + "]"
+}
+
+func renderMarkup(out io.Writer, markup *tele.ReplyMarkup) {
+	if markup == nil {
+		return
+	}
+
+	for _, row := range markup.InlineKeyboard {
+		buttons := make([]string, 0, len(row))
+		for _, btn := range row {
+			switch {
+			case btn.URL != "":
+				buttons = append(buttons, fmt.Sprintf("[%s](%s)", btn.Text, btn.URL))
+			default:
+				buttons = append(buttons, fmt.Sprintf("[%s](/btn %s)", btn.Text, displayData(btn.Data)))
+			}
+		}
+		fmt.Fprintf(out, "  %s\n", strings.Join(buttons, " "))
+	}
+
+	for _, row := range markup.ReplyKeyboard {
+		buttons := make([]string, 0, len(row))
+		for _, btn := range row {
+			buttons = append(buttons, "<"+btn.Text+">")
+		}
+		fmt.Fprintf(out, "  keyboard: %s\n", strings.Join(buttons, " "))
+	}
+
+	if markup.RemoveKeyboard {
+		fmt.Fprintln(out, "  keyboard removed")
+	}
+}
+
+// displayData strips the telebot "\f<unique>|" prefix from callback data.
+func displayData(data string) string {
+	data = strings.TrimPrefix(data, "\f")
+	if _, rest, ok := strings.Cut(data, "|"); ok && rest != "" {
+		return rest
+	}
+	return data
+}
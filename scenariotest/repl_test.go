@@ -0,0 +1,64 @@
+package scenariotest
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+)
+
+func TestREPL(t *testing.T) {
+	bot, scn := newRegisterBot(t)
+
+	in := strings.NewReader("/start\nBob\n/session\n/btn nope\n/quit\nignored\n")
+	var out strings.Builder
+	require.NoError(t, NewREPL(bot, scn).Run(context.Background(), in, &out))
+
+	assert.Contains(t, out.String(), "bot: Введите ваше имя\n")
+	assert.Contains(t, out.String(), "bot: введите ваше ДР\n")
+	assert.Contains(t, out.String(), `scene="register" step=1 data={"bd":"","name":"Bob"}`)
+	assert.Contains(t, out.String(), `no button "nope" on the last keyboard`)
+	assert.NotContains(t, out.String(), "ignored")
+}
+
+func TestREPLPressesButtons(t *testing.T) {
+	bot := NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	menu := &tele.ReplyMarkup{}
+	answer := menu.Data("", "answer")
+	menu.Inline(menu.Row(menu.Data("Да", "answer", "yes"), menu.Data("Нет", "answer", "no")))
+
+	bot.Handle("/ask", func(c tele.Context) error { return c.Send("Продолжить?", menu) })
+	bot.Handle(&answer, func(c tele.Context) error {
+		return c.Edit("Ответ: " + c.Data())
+	})
+
+	in := strings.NewReader("/ask\n/btn no\n/btn Да\n")
+	var out strings.Builder
+	require.NoError(t, NewREPL(bot, scn).Run(context.Background(), in, &out))
+
+	assert.Contains(t, out.String(), "  [Да](/btn yes) [Нет](/btn no)\n")
+	assert.Contains(t, out.String(), "bot (edited #1002): Ответ: no\n")
+	assert.Contains(t, out.String(), "bot (edited #1002): Ответ: yes\n")
+}
+
+func TestREPLCancelWithoutInput(t *testing.T) {
+	bot, scn := newRegisterBot(t)
+
+	in, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// returns at once, though no line was entered
+	var out strings.Builder
+	assert.ErrorIs(t, NewREPL(bot, scn).Run(ctx, in, &out), context.Canceled)
+}
@@ -0,0 +1,118 @@
+package scenariotest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+)
+
+type userData struct {
+	Name string `json:"name"`
+	BD   string `json:"bd"`
+}
+
+func newRegisterBot(t *testing.T) (*Bot, *scenario.Scenario) {
+	bot := NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[userData]("register",
+		func(c *scenario.Context[userData]) (bool, error) {
+			m := c.Message()
+			if strings.HasPrefix(m.Text, "/") || strings.TrimSpace(m.Text) == "" {
+				return false, c.Reply("Введите ваше имя")
+			}
+			c.SetData(userData{Name: m.Text})
+			return true, c.Reply("введите ваше ДР")
+		},
+		func(c *scenario.Context[userData]) (bool, error) {
+			data := c.GetData()
+			data.BD = c.Message().Text
+			c.SetData(data)
+			return true, c.Reply("Спасибо!")
+		},
+	))
+
+	bot.Handle("/start", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[userData](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("register")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+
+	return bot, scn
+}
+
+func TestConversationWizard(t *testing.T) {
+	bot, scn := newRegisterBot(t)
+
+	conv := bot.Conversation(scn).
+		Send("/start").ExpectReply("Введите ваше имя").ExpectNoReply().
+		ExpectScene("register").ExpectStep(0).
+		Send("Bob").ExpectReply("введите ваше ДР").
+		ExpectStep(1)
+	ExpectData(conv, userData{Name: "Bob"})
+
+	conv.Send("01.01.2000").ExpectReply("Спасибо!").ExpectScene("")
+}
+
+func TestConversationCallsAreRecorded(t *testing.T) {
+	bot, scn := newRegisterBot(t)
+
+	bot.Conversation(scn).Send("/start")
+	other := bot.ConversationWith(scn, &tele.Chat{ID: -100, Type: tele.ChatGroup}, &tele.User{ID: 7})
+	other.Send("hello").ExpectNoReply().ExpectScene("")
+
+	calls := bot.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "sendMessage", calls[0].Method)
+	assert.Equal(t, int64(42), calls[0].ChatID())
+	assert.NotZero(t, calls[0].MessageID)
+}
+
+func TestConversationPressButton(t *testing.T) {
+	bot := NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	var pressed []string
+	menu := &tele.ReplyMarkup{}
+	yes := menu.Data("Да", "answer", "yes")
+	menu.Inline(menu.Row(yes, menu.Data("Нет", "answer", "no")))
+
+	bot.Handle("/ask", func(c tele.Context) error { return c.Send("Продолжить?", menu) })
+	bot.Handle(&yes, func(c tele.Context) error {
+		pressed = append(pressed, c.Data())
+		return c.Edit("Принято")
+	})
+
+	conv := bot.Conversation(scn).
+		Send("/ask").ExpectReplyFunc(func(call Call) error {
+		assert.Len(t, call.ReplyMarkup().InlineKeyboard[0], 2)
+		return nil
+	})
+	conv.PressButton("Да").ExpectReply("Принято")
+	assert.Equal(t, []string{"yes"}, pressed)
+
+	replies := conv.Replies()
+	require.Len(t, replies, 1)
+	assert.Equal(t, "editMessageText", replies[0].Method)
+}
+
+func TestBotRespond(t *testing.T) {
+	bot := NewBot(t)
+	bot.Respond("sendMessage", func(Call) (any, string) {
+		return nil, "Bad Request: chat not found"
+	})
+	bot.Handle("/start", func(c tele.Context) error { return c.Send("hi") })
+
+	_, err := bot.Send(&tele.Chat{ID: 1}, "hi")
+	assert.ErrorContains(t, err, "chat not found")
+}
@@ -0,0 +1,430 @@
+package scenario
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+var (
+	ErrNoScheduler   = errors.New("scheduler is not configured")
+	ErrUnknownAction = errors.New("unknown job action")
+)
+
+// ActionRemind is the built-in job action that sends its payload as a message.
+const ActionRemind = "scenario.remind"
+
+// Job is a delayed action for a user in a chat. Actions are referenced by name,
+// so jobs can be persisted and run after a restart. A job with Scene runs only
+// while the user is still in that scene.
+type Job struct {
+	ID      string    `json:"id" db:"id"`
+	ChatID  int64     `json:"chat_id" db:"chat_id"`
+	UserID  int64     `json:"user_id" db:"user_id"`
+	Scene   SceneName `json:"scene,omitempty" db:"scene"`
+	Action  string    `json:"action" db:"action"`
+	Payload string    `json:"payload,omitempty" db:"payload"`
+	RunAt   time.Time `json:"run_at" db:"run_at"`
+}
+
+// JobStore persists scheduled jobs.
+type JobStore interface {
+	// AddJob saves a job, replacing a job with the same ID.
+	AddJob(ctx context.Context, job Job) error
+	// DueJobs returns up to limit jobs with RunAt not after now, earliest first.
+	DueJobs(ctx context.Context, now time.Time, limit int) ([]Job, error)
+	// ClaimJob deletes a job and reports whether it was still there, so of runners
+	// sharing the store only one gets the job.
+	ClaimJob(ctx context.Context, id string) (bool, error)
+	DeleteJob(ctx context.Context, id string) error
+	// DeleteUserJobs deletes all jobs of userID in chatID.
+	DeleteUserJobs(ctx context.Context, chatID, userID int64) error
+}
+
+// JobAction runs a due job. c is bound to the job chat and user; while the user
+// is in a scene it is the typed context of that scene, e.g. *Context[T].
+// Session changes are saved after the action returns.
+type JobAction func(c ContextBase, payload string) error
+
+// IdleScene is implemented by scenes that remind inactive users.
+// text may contain {step} (1-based wizard step) and {state} (FSM state) placeholders.
+type IdleScene interface {
+	Scene
+	IdleReminder() (after time.Duration, text string)
+}
+
+// WithScheduler enables delayed jobs and idle reminders stored in jobs.
+// Due jobs are run by RunScheduler or RunJobs. Any update of a user and leaving
+// a scene cancel jobs scheduled by Context.After and Remind; jobs saved with
+// Schedule are kept until they run.
+func (s *Scenario) WithScheduler(jobs JobStore) *Scenario {
+	s.jobs = jobs
+	return s
+}
+
+// OnJob registers a job action by name.
+func (s *Scenario) OnJob(action string, fn JobAction) *Scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.actions == nil {
+		s.actions = make(map[string]JobAction)
+	}
+	s.actions[action] = fn
+	return s
+}
+
+// Schedule saves a job; a random ID is assigned if it has none.
+func (s *Scenario) Schedule(ctx context.Context, job Job) (Job, error) {
+	if s.jobs == nil {
+		return job, ErrNoScheduler
+	}
+	if job.ID == "" {
+		job.ID = newJobID()
+	}
+	if err := s.jobs.AddJob(ctx, job); err != nil {
+		return job, fmt.Errorf("jobs.AddJob: %w", err)
+	}
+	return job, nil
+}
+
+// RunScheduler runs due jobs every interval until ctx is done.
+func (s *Scenario) RunScheduler(ctx context.Context, interval time.Duration) error {
+	if s.jobs == nil {
+		return ErrNoScheduler
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunJobs(ctx, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "failed to run scheduled jobs", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// jobsBatch is how many due jobs RunJobs takes from the store at once.
+const jobsBatch = 100
+
+// RunJobs runs jobs due at now and returns how many were delivered.
+// A job is claimed before it runs, so it is delivered at most once even by several
+// runners; failed jobs are logged and skipped, as are jobs of a scene the user has left.
+func (s *Scenario) RunJobs(ctx context.Context, now time.Time) (int, error) {
+	if s.jobs == nil {
+		return 0, ErrNoScheduler
+	}
+
+	ran := 0
+	for {
+		jobs, err := s.jobs.DueJobs(ctx, now, jobsBatch)
+		if err != nil {
+			return ran, fmt.Errorf("jobs.DueJobs: %w", err)
+		}
+
+		for _, job := range jobs {
+			claimed, err := s.jobs.ClaimJob(ctx, job.ID)
+			if err != nil {
+				return ran, fmt.Errorf("jobs.ClaimJob: %w", err)
+			}
+			if !claimed {
+				continue // run by another runner
+			}
+
+			ok, err := s.runJob(ctx, job)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to run scheduled job", "job", job.ID, "action", job.Action, "error", err)
+				continue
+			}
+			if ok {
+				ran++
+			}
+		}
+
+		if len(jobs) < jobsBatch {
+			return ran, nil
+		}
+	}
+}
+
+// runJob delivers a job unless the user is no longer in its scene.
+func (s *Scenario) runJob(ctx context.Context, job Job) (bool, error) {
+	action, ok := s.action(job.Action)
+	if !ok {
+		return false, fmt.Errorf("%w: %q", ErrUnknownAction, job.Action)
+	}
+	return s.runAs(ctx, job.ChatID, job.UserID, job.Scene, func(c ContextBase) error {
+		return action(c, job.Payload)
+	})
+}
+
+// runAs runs fn outside of an update with the context of userID in chatID, typed
+// by the user's current scene, and saves session changes. fn runs under the session
+// lock, so updates of the user wait for it. Unless scene is empty,
+// fn is not run and false is returned if the user is not in scene.
+func (s *Scenario) runAs(ctx context.Context, chatID, userID int64, scene SceneName, fn Handler) (bool, error) {
+	return s.runMessage(ctx, &tele.Message{Chat: &tele.Chat{ID: chatID}, Sender: &tele.User{ID: userID}}, scene, fn)
+}
+
+// runMessage is runAs with the context of a synthetic message from its sender in its chat.
+func (s *Scenario) runMessage(ctx context.Context, m *tele.Message, scene SceneName, fn Handler) (bool, error) {
+	if s.bot == nil {
+		return false, ErrNoBot
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	chatID, userID := m.Chat.ID, m.Sender.ID
+	unlock, err := s.sessions.lock(ctx, chatID, userID)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	base, err := s.store.GetSession(ctx, chatID, userID)
+	if errors.Is(err, ErrSessionNotFound) {
+		base, err = &SessionBase{ChatID: chatID, UserID: userID, Step: -1}, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("store.GetSession: %w", err)
+	}
+	if scene != "" && base.Scene != scene {
+		return false, nil
+	}
+
+	sc, _ := s.scene(base.Scene)
+	c := &updateContext{Context: s.bot.NewContext(tele.Update{Message: m}), ctx: s.sessions.hold(ctx, chatID, userID)}
+	sceneCtx, err := createTypedContext(sc, s, c, base)
+	if err != nil {
+		return false, fmt.Errorf("createTypedContext: %w", err)
+	}
+
+	if err := fn(sceneCtx); err != nil {
+		return false, err
+	}
+	return true, s.persist(ctx, sceneCtx, base.Scene, base.Step)
+}
+
+func (s *Scenario) action(name string) (JobAction, bool) {
+	if name == ActionRemind {
+		return remind, true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fn, ok := s.actions[name]
+	return fn, ok
+}
+
+func remind(c ContextBase, text string) error {
+	return c.Send(text)
+}
+
+// cancelJobs deletes jobs scheduled by Context.After in the session, clears them
+// in base and reports whether base changed. Jobs saved with Schedule are kept.
+// Failures are logged and don't interrupt the update, failed jobs stay in base.
+func (s *Scenario) cancelJobs(ctx context.Context, base *SessionBase) bool {
+	meta := decodeMeta(base.Meta)
+	if s.jobs == nil || len(meta.Jobs) == 0 {
+		return false
+	}
+
+	var failed []string
+	for _, id := range meta.Jobs {
+		if err := s.jobs.DeleteJob(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "failed to cancel scheduled job", "job", id, "error", err)
+			failed = append(failed, id)
+		}
+	}
+	if len(failed) == len(meta.Jobs) {
+		return false
+	}
+	meta.Jobs = failed
+	base.Meta = encodeMeta(meta)
+	return true
+}
+
+// cancelIdle deletes the idle reminder of scene.
+func (s *Scenario) cancelIdle(ctx context.Context, scene Scene, base *SessionBase) {
+	is, ok := scene.(IdleScene)
+	if s.jobs == nil || !ok {
+		return
+	}
+	if after, _ := is.IdleReminder(); after <= 0 {
+		return
+	}
+	if err := s.jobs.DeleteJob(ctx, idleJobID(base)); err != nil {
+		slog.ErrorContext(ctx, "failed to cancel idle reminder", "error", err)
+	}
+}
+
+func idleJobID(base *SessionBase) string {
+	return "idle:" + key(base.ChatID, base.UserID)
+}
+
+// scheduleIdle schedules the idle reminder of the current scene, replacing a pending one,
+// so updates don't need to cancel it.
+func (s *Scenario) scheduleIdle(ctx context.Context, c ContextBase) {
+	if s.jobs == nil {
+		return
+	}
+	base, err := c.getSessionBase()
+	if err != nil || base.Scene == "" {
+		return
+	}
+	sc, _ := s.scene(base.Scene)
+	is, ok := sc.(IdleScene)
+	if !ok {
+		return
+	}
+	after, text := is.IdleReminder()
+	if after <= 0 {
+		return
+	}
+
+	text = strings.NewReplacer("{step}", strconv.Itoa(base.Step+1), "{state}", base.State).Replace(text)
+	job := Job{
+		ID:      idleJobID(base),
+		ChatID:  base.ChatID,
+		UserID:  base.UserID,
+		Scene:   base.Scene,
+		Action:  ActionRemind,
+		Payload: text,
+		RunAt:   time.Now().Add(after),
+	}
+	if err := s.jobs.AddJob(ctx, job); err != nil {
+		slog.ErrorContext(ctx, "failed to schedule idle reminder", "error", err)
+	}
+}
+
+// After schedules action to run after d in the current scene.
+// The job is cancelled if the user sends anything or leaves the scene before.
+func (c *Context[T]) After(d time.Duration, action string) error {
+	return c.AfterWith(d, action, "")
+}
+
+// AfterWith is After with a payload passed to the action.
+func (c *Context[T]) AfterWith(d time.Duration, action, payload string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := c.Scenario.Schedule(ctx, Job{
+		ChatID:  c.chatID,
+		UserID:  c.userID,
+		Scene:   c.Session.Scene,
+		Action:  action,
+		Payload: payload,
+		RunAt:   time.Now().Add(d),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the next update cancels jobs kept in the session, not those of Schedule
+	meta := c.meta()
+	meta.Jobs = append(meta.Jobs, job.ID)
+	c.setMeta(meta)
+	return nil
+}
+
+// Remind sends text after d unless the user replies or leaves the scene before.
+func (c *Context[T]) Remind(d time.Duration, text string) error {
+	return c.AfterWith(d, ActionRemind, text)
+}
+
+func newJobID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MemoryJobs is an in-memory JobStore. Jobs don't survive a restart,
+// use a persistent store such as store/bolt Jobs in production.
+type MemoryJobs struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemoryJobs .
+func NewMemoryJobs() *MemoryJobs {
+	return &MemoryJobs{jobs: make(map[string]Job)}
+}
+
+// AddJob .
+func (m *MemoryJobs) AddJob(_ context.Context, job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.ID] = job
+	return nil
+}
+
+// DueJobs .
+func (m *MemoryJobs) DueJobs(_ context.Context, now time.Time, limit int) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []Job
+	for _, job := range m.jobs {
+		if !job.RunAt.After(now) {
+			due = append(due, job)
+		}
+	}
+	SortJobs(due)
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// ClaimJob .
+func (m *MemoryJobs) ClaimJob(_ context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.jobs[id]
+	delete(m.jobs, id)
+	return ok, nil
+}
+
+// DeleteJob .
+func (m *MemoryJobs) DeleteJob(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, id)
+	return nil
+}
+
+// DeleteUserJobs .
+func (m *MemoryJobs) DeleteUserJobs(_ context.Context, chatID, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, job := range m.jobs {
+		if job.ChatID == chatID && job.UserID == userID {
+			delete(m.jobs, id)
+		}
+	}
+	return nil
+}
+
+// SortJobs orders jobs by RunAt, then by ID.
+func SortJobs(jobs []Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].RunAt.Equal(jobs[j].RunAt) {
+			return jobs[i].RunAt.Before(jobs[j].RunAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+}
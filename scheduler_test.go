@@ -0,0 +1,186 @@
+package scenario_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+type signup struct {
+	Name    string `json:"name"`
+	Nudged  bool   `json:"nudged"`
+	Payload string `json:"payload"`
+}
+
+func newSignupBot(t *testing.T, jobs scenario.JobStore) (*scenariotest.Bot, *scenario.Scenario) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot).WithScheduler(jobs)
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[signup]("signup",
+		func(c *scenario.Context[signup]) (bool, error) {
+			if err := c.AfterWith(time.Hour, "nudge", "first"); err != nil {
+				return false, err
+			}
+			return true, c.Send("Как вас зовут?")
+		},
+		func(c *scenario.Context[signup]) (bool, error) {
+			c.SetData(signup{Name: c.Text()})
+			return true, c.Send("Откуда вы?")
+		},
+		func(c *scenario.Context[signup]) (bool, error) {
+			return true, c.Send("Готово")
+		},
+	).WithIdleReminder(time.Minute, "Вы ещё здесь? Шаг {step}"))
+
+	scn.OnJob("nudge", func(c scenario.ContextBase, payload string) error {
+		ctx := c.(*scenario.Context[signup])
+		data := ctx.GetData()
+		data.Nudged, data.Payload = true, payload
+		ctx.SetData(data)
+		return ctx.Send("Напоминание")
+	})
+
+	bot.Handle("/start", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[signup](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("signup")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+	return bot, scn
+}
+
+func lastText(bot *scenariotest.Bot) string {
+	calls := bot.Calls()
+	return calls[len(calls)-1].Text()
+}
+
+func TestIdleReminder(t *testing.T) {
+	bot, scn := newSignupBot(t, scenario.NewMemoryJobs())
+	ctx := context.Background()
+
+	conv := bot.Conversation(scn).Send("/start").ExpectReply("Как вас зовут?")
+
+	ran, err := scn.RunJobs(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+
+	ran, err = scn.RunJobs(ctx, time.Now().Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	assert.Equal(t, "Вы ещё здесь? Шаг 2", lastText(bot))
+
+	// delivered once
+	ran, err = scn.RunJobs(ctx, time.Now().Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+
+	// a reply cancels pending jobs and reschedules the reminder
+	conv.Send("Bob").ExpectReply("Откуда вы?")
+	ran, err = scn.RunJobs(ctx, time.Now().Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	assert.Equal(t, "Вы ещё здесь? Шаг 3", lastText(bot))
+
+	// leaving cancels the reminder
+	conv.Send("Москва").ExpectReply("Готово").ExpectScene("")
+	ran, err = scn.RunJobs(ctx, time.Now().Add(48*time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+}
+
+func TestScheduledAction(t *testing.T) {
+	jobs := scenario.NewMemoryJobs()
+	bot, scn := newSignupBot(t, jobs)
+	ctx := context.Background()
+
+	conv := bot.Conversation(scn).Send("/start").ExpectReply("Как вас зовут?")
+	require.NoError(t, jobs.DeleteJob(ctx, "idle:42:42"))
+
+	ran, err := scn.RunJobs(ctx, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	assert.Equal(t, "Напоминание", lastText(bot))
+	scenariotest.ExpectData(conv, signup{Nudged: true, Payload: "first"})
+	conv.ExpectScene("signup").ExpectStep(1)
+
+	// jobs of a scene the user is no longer in are dropped
+	_, err = scn.Schedule(ctx, scenario.Job{ChatID: 42, UserID: 42, Scene: "other", Action: "nudge"})
+	require.NoError(t, err)
+	ran, err = scn.RunJobs(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, ran)
+	due, err := jobs.DueJobs(ctx, time.Now().Add(48*time.Hour), 0)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
+
+// countingJobs counts cancellations of jobs other than idle reminders.
+type countingJobs struct {
+	*scenario.MemoryJobs
+	cancels int
+}
+
+func (j *countingJobs) DeleteJob(ctx context.Context, id string) error {
+	if !strings.HasPrefix(id, "idle:") {
+		j.cancels++
+	}
+	return j.MemoryJobs.DeleteJob(ctx, id)
+}
+
+func TestJobsCancelledOnlyWhenPending(t *testing.T) {
+	jobs := &countingJobs{MemoryJobs: scenario.NewMemoryJobs()}
+	bot, scn := newSignupBot(t, jobs)
+
+	// updates without a scene have nothing to cancel
+	conv := bot.Conversation(scn).Send("hi").Send("hi")
+	assert.Zero(t, jobs.cancels)
+
+	// the step scheduled a job, the reply cancels it once
+	conv.Send("/start").ExpectReply("Как вас зовут?").
+		Send("Bob").ExpectReply("Откуда вы?").
+		Send("Москва").ExpectReply("Готово")
+	assert.Equal(t, 1, jobs.cancels)
+}
+
+func TestScheduledJobsSurviveUpdates(t *testing.T) {
+	jobs := scenario.NewMemoryJobs()
+	bot, scn := newSignupBot(t, jobs)
+	ctx := context.Background()
+
+	conv := bot.Conversation(scn).Send("/start").ExpectReply("Как вас зовут?")
+	_, err := scn.Schedule(ctx, scenario.Job{ID: "digest", ChatID: 42, UserID: 42, Action: scenario.ActionRemind, Payload: "Дайджест", RunAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	// a reply cancels the job of After, a leave the idle reminder, Schedule keeps its job
+	conv.Send("Bob").ExpectReply("Откуда вы?").
+		Send("Москва").ExpectReply("Готово").ExpectScene("")
+	due, err := jobs.DueJobs(ctx, time.Now().Add(48*time.Hour), 0)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, "digest", due[0].ID)
+
+	ran, err := scn.RunJobs(ctx, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	assert.Equal(t, "Дайджест", lastText(bot))
+}
+
+func TestSchedulerNotConfigured(t *testing.T) {
+	scn := scenario.New(nil)
+
+	_, err := scn.RunJobs(context.Background(), time.Now())
+	assert.ErrorIs(t, err, scenario.ErrNoScheduler)
+	_, err = scn.Schedule(context.Background(), scenario.Job{Action: scenario.ActionRemind})
+	assert.ErrorIs(t, err, scenario.ErrNoScheduler)
+}
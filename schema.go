@@ -0,0 +1,192 @@
+package scenario
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// ErrDataDecode is returned when stored session data can't be decoded into the scene data type.
+var ErrDataDecode = errors.New("session data decode failed")
+
+// UpgradeFunc converts session data of one schema version to the next one.
+// Data is decoded into a generic map with the codec it was written with; JSON numbers
+// are json.Number to keep int64 precision. GobCodec data can't be upgraded, gob doesn't
+// decode a struct into a map.
+type UpgradeFunc func(data map[string]any) (map[string]any, error)
+
+// DecodePolicy defines what happens when session data can't be decoded.
+type DecodePolicy int
+
+const (
+	// DecodeFail returns the decode error from the middleware.
+	DecodeFail DecodePolicy = iota
+	// DecodeReset drops the data and starts the scene over.
+	DecodeReset
+	// DecodeNotify drops the data, leaves the scene and replies with a message.
+	DecodeNotify
+)
+
+// DataSchema describes the version of scene data and how to upgrade older data.
+type DataSchema struct {
+	version  int
+	upgrades map[int]UpgradeFunc
+	policy   DecodePolicy
+	message  string
+}
+
+// VersionedScene is implemented by scenes that declare a data schema.
+type VersionedScene interface {
+	Scene
+	DataSchema() *DataSchema
+}
+
+func (d *DataSchema) setVersion(version int) {
+	d.version = version
+}
+
+func (d *DataSchema) addUpgrade(from int, fn UpgradeFunc) {
+	if d.upgrades == nil {
+		d.upgrades = make(map[int]UpgradeFunc)
+	}
+	d.upgrades[from] = fn
+}
+
+func (d *DataSchema) setPolicy(policy DecodePolicy, message string) {
+	d.policy = policy
+	d.message = message
+}
+
+// Version returns the current data schema version.
+func (d *DataSchema) Version() int {
+	if d == nil {
+		return 0
+	}
+	return d.version
+}
+
+// upgrade applies upgrade functions to data older than the schema version.
+// Versions without an upgrade function are considered compatible.
+func (d *DataSchema) upgrade(codecs *codecSet, base *SessionBase) (*SessionBase, error) {
+	if d == nil || base.DataVersion >= d.version {
+		return base, nil
+	}
+
+	upgraded := *base
+	upgraded.DataVersion = d.version
+	if len(base.Data) == 0 || bytes.Equal(base.Data, nullBytes) {
+		return &upgraded, nil
+	}
+
+	if !d.hasUpgrades(base.DataVersion) {
+		return &upgraded, nil
+	}
+	data, err := codecs.decodeMap(base.Codec, base.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	for version := base.DataVersion; version < d.version; version++ {
+		fn, ok := d.upgrades[version]
+		if !ok {
+			continue
+		}
+		if data, err = fn(data); err != nil {
+			return nil, fmt.Errorf("upgrade from version %d: %w", version, err)
+		}
+	}
+
+	codec, encoded, err := codecs.encodeWith(base.Codec, data)
+	if err != nil {
+		return nil, err
+	}
+	upgraded.Data = encoded
+	upgraded.Codec = codec
+
+	return &upgraded, nil
+}
+
+// hasUpgrades reports whether data of version needs upgrade functions.
+func (d *DataSchema) hasUpgrades(version int) bool {
+	for v := range d.upgrades {
+		if v >= version && v < d.version {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSession upgrades base to the schema version and decodes it into Session[T].
+func decodeSession[T any](codecs *codecSet, base *SessionBase, schema *DataSchema) (*Session[T], error) {
+	if base == nil {
+		base = &SessionBase{}
+	}
+
+	upgraded, err := schema.upgrade(codecs, base)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDataDecode, err)
+	}
+
+	sess, err := fromBase[T](upgraded, codecs)
+	if err != nil {
+		return nil, err
+	}
+	if schema != nil {
+		sess.DataVersion = schema.version
+	}
+
+	return sess, nil
+}
+
+// handleDecodeError applies the scene decode policy.
+// It returns a nil context when the update is fully handled.
+func (s *Scenario) handleDecodeError(
+	ctx context.Context,
+	sc Scene,
+	c tele.Context,
+	base *SessionBase,
+	decodeErr error,
+) (ContextBase, error) {
+	var schema *DataSchema
+	if vs, ok := sc.(VersionedScene); ok {
+		schema = vs.DataSchema()
+	}
+	if schema == nil || schema.policy == DecodeFail {
+		return nil, decodeErr
+	}
+
+	reset := *base
+	reset.Data = nil
+	reset.Codec = ""
+	reset.DataVersion = schema.version
+	reset.UpdatedAt = time.Now()
+
+	switch schema.policy {
+	case DecodeReset:
+		sceneCtx, err := createTypedContext(sc, s, c, &reset)
+		if err != nil {
+			return nil, fmt.Errorf("createTypedContext: %w", err)
+		}
+		if err = sc.Enter(sceneCtx); err != nil {
+			return nil, err
+		}
+		sceneCtx.markDirty()
+		return sceneCtx, nil
+	case DecodeNotify:
+		reset.Scene = ""
+		reset.Step = -1
+		if err := s.store.SetSession(ctx, &reset); err != nil {
+			return nil, fmt.Errorf("store.SetSession: %w", err)
+		}
+		if schema.message != "" {
+			return nil, c.Reply(schema.message)
+		}
+		return nil, nil
+	default:
+		return nil, decodeErr
+	}
+}
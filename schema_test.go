@@ -0,0 +1,207 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario/mocks"
+)
+
+type profileV2 struct {
+	FullName string `json:"full_name"`
+	Lang     string `json:"lang"`
+}
+
+func newProfileWizard(steps ...WizardStep[profileV2]) *WizardScene[profileV2] {
+	return NewWizard[profileV2]("profile", steps...).
+		WithDataVersion(2).
+		WithUpgrade(0, func(data map[string]any) (map[string]any, error) {
+			data["full_name"] = data["name"]
+			delete(data, "name")
+			return data, nil
+		}).
+		WithUpgrade(1, func(data map[string]any) (map[string]any, error) {
+			if _, ok := data["lang"]; !ok {
+				data["lang"] = "ru"
+			}
+			return data, nil
+		})
+}
+
+func newSchemaMockCtx(t *testing.T) *mocks.MockContext {
+	ctrl := gomock.NewController(t)
+	mockCtx := mocks.NewMockContext(ctrl)
+	mockCtx.EXPECT().Sender().Return(&tele.User{ID: 1}).AnyTimes()
+	mockCtx.EXPECT().Message().Return(&tele.Message{
+		Text: "hello",
+		Chat: &tele.Chat{ID: 2},
+	}).AnyTimes()
+	return mockCtx
+}
+
+func TestWizardSceneUpgradesData(t *testing.T) {
+	scenario := New(nil)
+	wizard := newProfileWizard()
+
+	for _, codec := range []Codec{JSONCodec, MsgpackCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			name, data, err := scenario.codecs.encodeWith(codec.Name(), map[string]any{"name": "Bob"})
+			require.NoError(t, err)
+
+			base := &SessionBase{ChatID: 2, UserID: 1, Scene: "profile", Data: data, Codec: name}
+			ctx, err := wizard.CreateContext(scenario, newSchemaMockCtx(t), base)
+			require.NoError(t, err)
+
+			typedCtx := ctx.(*Context[profileV2])
+			assert.Equal(t, profileV2{FullName: "Bob", Lang: "ru"}, typedCtx.GetData())
+			assert.Equal(t, 2, typedCtx.Session.DataVersion)
+
+			saved, err := typedCtx.getSessionBase()
+			require.NoError(t, err)
+			assert.Equal(t, 2, saved.DataVersion)
+		})
+	}
+}
+
+type account struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestWizardSceneUpgradeKeepsInt64(t *testing.T) {
+	wizard := NewWizard[account]("account").
+		WithDataVersion(1).
+		WithUpgrade(0, func(data map[string]any) (map[string]any, error) {
+			data["name"] = "Bob"
+			return data, nil
+		})
+
+	base := &SessionBase{Data: []byte(`{"id":9007199254740993}`)}
+	ctx, err := wizard.CreateContext(New(nil), newSchemaMockCtx(t), base)
+	require.NoError(t, err)
+	assert.Equal(t, account{ID: 9007199254740993, Name: "Bob"}, ctx.(*Context[account]).GetData())
+}
+
+func TestWizardSceneUpgradeGob(t *testing.T) {
+	scenario := New(nil).WithCodec(GobCodec)
+	wizard := newProfileWizard()
+	scenario.Use(wizard)
+	assert.ErrorIs(t, scenario.Validate(), ErrInvalidScene)
+
+	name, data, err := scenario.codecs.encodeWith(GobCodec.Name(), profileV2{FullName: "Bob"})
+	require.NoError(t, err)
+	base := &SessionBase{Data: data, Codec: name}
+	_, err = wizard.CreateContext(scenario, newSchemaMockCtx(t), base)
+	assert.ErrorIs(t, err, ErrDataDecode)
+	assert.Contains(t, err.Error(), "gob data can't be decoded into a map")
+
+	// without upgrades to apply gob data is decoded as is
+	base.DataVersion = 2
+	ctx, err := wizard.CreateContext(scenario, newSchemaMockCtx(t), base)
+	require.NoError(t, err)
+	assert.Equal(t, profileV2{FullName: "Bob"}, ctx.(*Context[profileV2]).GetData())
+}
+
+func TestWizardSceneSkipsUpgradeForCurrentVersion(t *testing.T) {
+	wizard := newProfileWizard()
+
+	base := &SessionBase{Data: []byte(`{"full_name":"Bob","lang":"en"}`), DataVersion: 2}
+	ctx, err := wizard.CreateContext(New(nil), newSchemaMockCtx(t), base)
+	require.NoError(t, err)
+	assert.Equal(t, profileV2{FullName: "Bob", Lang: "en"}, ctx.(*Context[profileV2]).GetData())
+}
+
+func TestWizardSceneUpgradeError(t *testing.T) {
+	wizard := NewWizard[profileV2]("profile").
+		WithDataVersion(1).
+		WithUpgrade(0, func(map[string]any) (map[string]any, error) {
+			return nil, errors.New("broken")
+		})
+
+	base := &SessionBase{Data: []byte(`{"name":"Bob"}`)}
+	_, err := wizard.CreateContext(New(nil), newSchemaMockCtx(t), base)
+	assert.ErrorIs(t, err, ErrDataDecode)
+	assert.Contains(t, err.Error(), "broken")
+}
+
+func TestScenarioEnterSetsDataVersion(t *testing.T) {
+	scenario := New(nil)
+	scenario.Use(newProfileWizard(func(c *Context[profileV2]) (bool, error) {
+		return false, nil
+	}))
+
+	sceneCtx, err := NewContext[profileV2](scenario, newSchemaMockCtx(t))
+	require.NoError(t, err)
+	require.NoError(t, sceneCtx.Enter("profile"))
+
+	base, err := scenario.store.GetSession(context.Background(), 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, base.DataVersion)
+}
+
+func TestScenarioMiddlewareDecodePolicies(t *testing.T) {
+	type Data struct {
+		Age int `json:"age"`
+	}
+
+	broken := &SessionBase{ChatID: 2, UserID: 1, Scene: "age", Step: 1, Data: []byte(`{"age":"abc"}`)}
+
+	t.Run("fail", func(t *testing.T) {
+		scenario := New(nil)
+		scenario.Use(NewWizard[Data]("age", func(c *Context[Data]) (bool, error) { return false, nil }))
+		require.NoError(t, scenario.store.SetSession(context.Background(), broken))
+
+		err := scenario.Middleware(func(tele.Context) error { return nil })(newSchemaMockCtx(t))
+		assert.ErrorIs(t, err, ErrDataDecode)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		var seen []Data
+		scenario := New(nil)
+		scenario.Use(NewWizard[Data]("age",
+			func(c *Context[Data]) (bool, error) {
+				seen = append(seen, c.GetData())
+				c.SetData(Data{Age: 10})
+				return true, nil
+			},
+			func(c *Context[Data]) (bool, error) { return false, nil },
+		).OnDecodeError(DecodeReset, ""))
+		require.NoError(t, scenario.store.SetSession(context.Background(), broken))
+
+		err := scenario.Middleware(func(tele.Context) error { return nil })(newSchemaMockCtx(t))
+		require.NoError(t, err)
+		assert.Equal(t, []Data{{}}, seen) // started over from the first step
+
+		base, err := scenario.store.GetSession(context.Background(), 2, 1)
+		require.NoError(t, err)
+		assert.Equal(t, SceneName("age"), base.Scene)
+		assert.Equal(t, 1, base.Step)
+		assert.JSONEq(t, `{"age":10}`, string(base.Data))
+	})
+
+	t.Run("notify", func(t *testing.T) {
+		scenario := New(nil)
+		scenario.Use(NewWizard[Data]("age", func(c *Context[Data]) (bool, error) {
+			t.Fatal("step must not be called")
+			return false, nil
+		}).OnDecodeError(DecodeNotify, "Форма изменилась, начните заново"))
+		require.NoError(t, scenario.store.SetSession(context.Background(), broken))
+
+		mockCtx := newSchemaMockCtx(t)
+		mockCtx.EXPECT().Reply("Форма изменилась, начните заново").Return(nil)
+
+		err := scenario.Middleware(func(tele.Context) error { return nil })(mockCtx)
+		require.NoError(t, err)
+
+		base, err := scenario.store.GetSession(context.Background(), 2, 1)
+		require.NoError(t, err)
+		assert.Equal(t, SceneName(""), base.Scene)
+		assert.Empty(t, base.Data)
+	})
+}
@@ -0,0 +1,188 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SharedUserID is the user ID under which the default SharedStore keeps
+// chat-wide records in Store.
+const SharedUserID int64 = 0
+
+// Shared is chat-wide data of a group scene, shared by all participants,
+// while each participant keeps personal progress in Session[T].
+// S is the type of the shared data.
+type Shared[S any] struct {
+	ChatID       int64     `json:"chat_id"`
+	Data         S         `json:"data"`
+	Participants []int64   `json:"participants,omitempty"`
+	Revision     int       `json:"revision"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// SharedStore keeps chat-wide records. Data of a record is the encoded Shared[S].
+type SharedStore interface {
+	// GetShared returns ErrSessionNotFound if the chat has no record.
+	GetShared(ctx context.Context, chatID int64) (*SessionBase, error)
+	// UpdateShared loads the record of chatID, an empty one if there is none,
+	// passes it to fn and saves it unless fn fails. Concurrent updates
+	// of one chat must not interleave.
+	UpdateShared(ctx context.Context, chatID int64, fn func(*SessionBase) error) error
+}
+
+// WithSharedStore replaces the default SharedStore, which keeps records in Store
+// under SharedUserID and serializes updates within the process only.
+// Use a store with atomic updates when several bot instances share a database.
+func (s *Scenario) WithSharedStore(shared SharedStore) *Scenario {
+	if shared != nil {
+		s.shared = shared
+	}
+	return s
+}
+
+func (s *Scenario) sharedStore() SharedStore {
+	if s.shared != nil {
+		return s.shared
+	}
+	return (*storeShared)(s)
+}
+
+// GetShared loads the shared record of chatID; a chat without one gets an empty record.
+func GetShared[S any](ctx context.Context, scenario *Scenario, chatID int64) (*Shared[S], error) {
+	base, err := scenario.sharedStore().GetShared(ctx, chatID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return &Shared[S]{ChatID: chatID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeShared[S](scenario.codecs, chatID, base)
+}
+
+// UpdateShared atomically modifies the shared record of the context chat and adds
+// the context user to its participants. The record is not saved if fn returns an error.
+func UpdateShared[S any](c ContextBase, fn func(*Shared[S]) error) (*Shared[S], error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	scenario := c.getScenario()
+	chatID, userID := getChatUserIDs(c)
+
+	var shared *Shared[S]
+	err := scenario.sharedStore().UpdateShared(ctx, chatID, func(base *SessionBase) error {
+		var err error
+		shared, err = decodeShared[S](scenario.codecs, chatID, base)
+		if err != nil {
+			return err
+		}
+
+		if err = fn(shared); err != nil {
+			return err
+		}
+		if !slices.Contains(shared.Participants, userID) {
+			shared.Participants = append(shared.Participants, userID)
+		}
+		shared.Revision++
+		shared.UpdatedAt = time.Now()
+
+		base.Codec, base.Data, err = scenario.codecs.encode(shared)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("UpdateShared: %w", err)
+	}
+	return shared, nil
+}
+
+// Broadcast runs fn for every participant of the shared record of chatID
+// with the participant's context, e.g. to refresh their view after an update.
+// Participants who are not in scene are skipped; an empty scene selects everyone.
+// Session changes made by fn are saved. fn runs under the participant's session lock;
+// from a handler pass UpdateContext, so the session of the update is not waited for.
+// It returns how many participants were handled.
+func (s *Scenario) Broadcast(ctx context.Context, chatID int64, scene SceneName, fn Handler) (int, error) {
+	base, err := s.sharedStore().GetShared(ctx, chatID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var record struct {
+		Participants []int64 `json:"participants"`
+	}
+	if err = s.codecs.decode(base.Codec, base.Data, &record); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDataDecode, err)
+	}
+
+	var (
+		sent int
+		errs []error
+	)
+	for _, userID := range record.Participants {
+		ok, err := s.runAs(ctx, chatID, userID, scene, fn)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %d: %w", userID, err))
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+func decodeShared[S any](codecs *codecSet, chatID int64, base *SessionBase) (*Shared[S], error) {
+	shared := &Shared[S]{}
+	if base != nil && len(base.Data) > 0 {
+		if err := codecs.decode(base.Codec, base.Data, shared); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDataDecode, err)
+		}
+	}
+	shared.ChatID = chatID
+	return shared, nil
+}
+
+// storeShared is the default SharedStore on top of Scenario.store.
+type storeShared Scenario
+
+// GetShared .
+func (s *storeShared) GetShared(ctx context.Context, chatID int64) (*SessionBase, error) {
+	base, err := s.store.GetSession(ctx, chatID, SharedUserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(base.Data) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	return base, nil
+}
+
+// UpdateShared .
+func (s *storeShared) UpdateShared(ctx context.Context, chatID int64, fn func(*SessionBase) error) error {
+	mu, _ := s.sharedLocks.LoadOrStore(chatID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	record := SessionBase{ChatID: chatID, UserID: SharedUserID, Step: -1}
+	base, err := s.store.GetSession(ctx, chatID, SharedUserID)
+	switch {
+	case err == nil:
+		record = *base
+	case !errors.Is(err, ErrSessionNotFound):
+		return fmt.Errorf("store.GetSession: %w", err)
+	}
+
+	if err = fn(&record); err != nil {
+		return err
+	}
+	if err = s.store.SetSession(ctx, &record); err != nil {
+		return fmt.Errorf("store.SetSession: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package scenario_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/scenariotest"
+)
+
+type tally struct {
+	Votes map[string]int `json:"votes"`
+}
+
+type voter struct {
+	Choice string `json:"choice"`
+}
+
+func TestSharedGroupScene(t *testing.T) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[voter]("vote",
+		func(c *scenario.Context[voter]) (bool, error) {
+			return true, c.Send("Ваш голос?")
+		},
+		func(c *scenario.Context[voter]) (bool, error) {
+			c.SetData(voter{Choice: c.Text()})
+			shared, err := scenario.UpdateShared(c, func(s *scenario.Shared[tally]) error {
+				if s.Data.Votes == nil {
+					s.Data.Votes = make(map[string]int)
+				}
+				s.Data.Votes[c.Text()]++
+				return nil
+			})
+			if err != nil {
+				return false, err
+			}
+
+			// notify every participant still voting in private
+			text := "Голосов за " + c.Text() + ": " + strconv.Itoa(shared.Data.Votes[c.Text()])
+			_, err = c.Scenario.Broadcast(scenario.UpdateContext(c), c.Chat().ID, "vote", func(p scenario.ContextBase) error {
+				_, err := p.Bot().Send(p.Sender(), text)
+				return err
+			})
+			return false, err
+		},
+	))
+	bot.Handle("/vote", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[voter](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("vote")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+
+	group := &tele.Chat{ID: -100, Type: tele.ChatGroup}
+	alice := bot.ConversationWith(scn, group, &tele.User{ID: 1, FirstName: "Alice"})
+	bob := bot.ConversationWith(scn, group, &tele.User{ID: 2, FirstName: "Bob"})
+
+	alice.Send("/vote").ExpectReply("Ваш голос?")
+	bob.Send("/vote").ExpectReply("Ваш голос?")
+	alice.Send("pizza")
+	bob.Send("pizza")
+
+	// personal progress stays per user
+	scenariotest.ExpectData(alice, voter{Choice: "pizza"})
+	scenariotest.ExpectData(bob, voter{Choice: "pizza"})
+
+	shared, err := scenario.GetShared[tally](context.Background(), scn, group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"pizza": 2}, shared.Data.Votes)
+	assert.Equal(t, []int64{1, 2}, shared.Participants)
+	assert.Equal(t, 2, shared.Revision)
+
+	var private []string
+	for _, call := range bot.Calls() {
+		if call.ChatID() > 0 {
+			private = append(private, call.Params["chat_id"]+": "+call.Text())
+		}
+	}
+	assert.Equal(t, []string{"1: Голосов за pizza: 1", "1: Голосов за pizza: 2", "2: Голосов за pizza: 2"}, private)
+}
+
+type counter struct {
+	Count int `json:"count"`
+}
+
+func TestBroadcastMidWizard(t *testing.T) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+	bot.Use(scn.Middleware)
+
+	scn.Use(scenario.NewWizard[counter]("count",
+		func(c *scenario.Context[counter]) (bool, error) {
+			_, err := scenario.UpdateShared(c, func(*scenario.Shared[int]) error { return nil })
+			return true, err
+		},
+		func(c *scenario.Context[counter]) (bool, error) {
+			c.SetData(counter{Count: c.GetData().Count + 1})
+			return false, nil
+		},
+	))
+	bot.Handle("/count", func(c tele.Context) error {
+		sceneCtx, err := scenario.NewContext[counter](scn, c)
+		if err != nil {
+			return err
+		}
+		return sceneCtx.Enter("count")
+	})
+	bot.Handle(tele.OnText, func(tele.Context) error { return nil })
+
+	group := &tele.Chat{ID: -100, Type: tele.ChatGroup}
+	alice := bot.ConversationWith(scn, group, &tele.User{ID: 1}).Send("/count")
+	bob := bot.ConversationWith(scn, group, &tele.User{ID: 2}).Send("/count")
+
+	// broadcasts and updates of a member mid-wizard don't overwrite each other
+	const n = 20
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			sent, err := scn.Broadcast(context.Background(), group.ID, "count", func(p scenario.ContextBase) error {
+				c := p.(*scenario.Context[counter])
+				count := c.GetData().Count
+				time.Sleep(time.Millisecond) // let updates of the member run meanwhile
+				c.SetData(counter{Count: count + 1})
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, sent)
+		}()
+		go func() {
+			defer wg.Done()
+			bot.ProcessUpdate(tele.Update{Message: &tele.Message{Chat: group, Sender: bob.User(), Text: "+1"}})
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, bot.Errors())
+	scenariotest.ExpectData(alice, counter{Count: n})
+	scenariotest.ExpectData(bob, counter{Count: 2 * n})
+	bob.ExpectScene("count").ExpectStep(1)
+}
+
+func TestUpdateSharedConcurrent(t *testing.T) {
+	bot := scenariotest.NewBot(t)
+	scn := scenario.New(bot.Bot)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			c, err := scenario.NewContext[any](scn, bot.NewContext(tele.Update{Message: &tele.Message{
+				Chat:   &tele.Chat{ID: -100},
+				Sender: &tele.User{ID: userID},
+			}}))
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, err = scenario.UpdateShared(c, func(s *scenario.Shared[int]) error {
+				s.Data++
+				return nil
+			})
+			assert.NoError(t, err)
+		}(int64(i))
+	}
+	wg.Wait()
+
+	shared, err := scenario.GetShared[int](context.Background(), scn, -100)
+	require.NoError(t, err)
+	assert.Equal(t, 50, shared.Data)
+	assert.Equal(t, 50, shared.Revision)
+	assert.Len(t, shared.Participants, 50)
+
+	empty, err := scenario.GetShared[int](context.Background(), scn, -200)
+	require.NoError(t, err)
+	assert.Equal(t, &scenario.Shared[int]{ChatID: -200}, empty)
+}
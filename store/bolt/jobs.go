@@ -0,0 +1,143 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/themgmd/scenario"
+)
+
+const defaultJobsBucket = "jobs"
+
+// Jobs is a scenario.JobStore backed by bbolt, so scheduled jobs survive restarts.
+type Jobs struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+// JobsOption configures Jobs.
+type JobsOption func(*Jobs)
+
+// WithJobsBucket overrides the jobs bucket name.
+func WithJobsBucket(name string) JobsOption {
+	return func(j *Jobs) {
+		if name != "" {
+			j.bucket = []byte(name)
+		}
+	}
+}
+
+// NewJobs .
+func NewJobs(db *bbolt.DB, opts ...JobsOption) (*Jobs, error) {
+	jobs := &Jobs{
+		db:     db,
+		bucket: []byte(defaultJobsBucket),
+	}
+	for _, opt := range opts {
+		opt(jobs)
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobs.bucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create bucket: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// Jobs returns a job store in the same file, in the bucket named after the sessions bucket.
+func (s *Storage) Jobs() (*Jobs, error) {
+	return NewJobs(s.db, WithJobsBucket(string(s.bucket)+":jobs"))
+}
+
+// AddJob .
+func (j *Jobs) AddJob(_ context.Context, job scenario.Job) error {
+	value, err := json.Marshal(&job)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	return j.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(j.bucket).Put([]byte(job.ID), value)
+	})
+}
+
+// DueJobs .
+func (j *Jobs) DueJobs(_ context.Context, now time.Time, limit int) ([]scenario.Job, error) {
+	var due []scenario.Job
+	err := j.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(j.bucket).ForEach(func(_, v []byte) error {
+			var job scenario.Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			if !job.RunAt.After(now) {
+				due = append(due, job)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scenario.SortJobs(due)
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// ClaimJob .
+func (j *Jobs) ClaimJob(_ context.Context, id string) (bool, error) {
+	var claimed bool
+	err := j.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(j.bucket)
+		if bucket.Get([]byte(id)) == nil {
+			return nil
+		}
+		claimed = true
+		return bucket.Delete([]byte(id))
+	})
+	return claimed, err
+}
+
+// DeleteJob .
+func (j *Jobs) DeleteJob(_ context.Context, id string) error {
+	return j.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(j.bucket).Delete([]byte(id))
+	})
+}
+
+// DeleteUserJobs .
+func (j *Jobs) DeleteUserJobs(_ context.Context, chatID, userID int64) error {
+	return j.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(j.bucket)
+
+		var ids [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var job scenario.Job
+			if err := json.Unmarshal(v, &job); err == nil && job.ChatID == chatID && job.UserID == userID {
+				ids = append(ids, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err = bucket.Delete(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
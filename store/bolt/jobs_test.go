@@ -0,0 +1,76 @@
+package bolt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/themgmd/scenario"
+)
+
+func TestJobsDueAndDelete(t *testing.T) {
+	storage := openTestStorage(t)
+	jobs, err := storage.Jobs()
+	require.NoError(t, err)
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, jobs.AddJob(ctx, scenario.Job{ID: "b", ChatID: 1, UserID: 2, Action: "a", RunAt: now.Add(-time.Minute)}))
+	require.NoError(t, jobs.AddJob(ctx, scenario.Job{ID: "a", ChatID: 1, UserID: 2, Action: "a", RunAt: now}))
+	require.NoError(t, jobs.AddJob(ctx, scenario.Job{ID: "c", ChatID: 1, UserID: 3, Action: "a", RunAt: now.Add(-2 * time.Minute)}))
+	require.NoError(t, jobs.AddJob(ctx, scenario.Job{ID: "later", ChatID: 1, UserID: 2, Action: "a", RunAt: now.Add(time.Hour)}))
+
+	due, err := jobs.DueJobs(ctx, now, 0)
+	require.NoError(t, err)
+	require.Len(t, due, 3)
+	assert.Equal(t, []string{"c", "b", "a"}, []string{due[0].ID, due[1].ID, due[2].ID})
+
+	due, err = jobs.DueJobs(ctx, now, 1)
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+
+	claimed, err := jobs.ClaimJob(ctx, "c")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = jobs.ClaimJob(ctx, "c")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	require.NoError(t, jobs.DeleteJob(ctx, "b"))
+	require.NoError(t, jobs.DeleteUserJobs(ctx, 1, 2))
+
+	due, err = jobs.DueJobs(ctx, now.Add(2*time.Hour), 0)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
+
+func TestJobsPersistAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	ctx := context.Background()
+	runAt := time.Now().Add(time.Hour).UTC()
+
+	storage, err := Open(path)
+	require.NoError(t, err)
+	jobs, err := storage.Jobs()
+	require.NoError(t, err)
+	job := scenario.Job{ID: "j", ChatID: 1, UserID: 2, Scene: "s", Action: scenario.ActionRemind, Payload: "hi", RunAt: runAt}
+	require.NoError(t, jobs.AddJob(ctx, job))
+	require.NoError(t, storage.Close())
+
+	storage, err = Open(path)
+	require.NoError(t, err)
+	defer storage.Close()
+	jobs, err = storage.Jobs()
+	require.NoError(t, err)
+
+	due, err := jobs.DueJobs(ctx, runAt, 0)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.True(t, due[0].RunAt.Equal(runAt))
+	due[0].RunAt = runAt
+	assert.Equal(t, job, due[0])
+}
@@ -0,0 +1,233 @@
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/themgmd/scenario"
+)
+
+const defaultBucket = "sessions"
+
+// Storage is a scenario.Store backed by an embedded bbolt file.
+// Sessions of every bot live in a separate top-level bucket.
+type Storage struct {
+	db            *bbolt.DB
+	ownDB         bool
+	bucket        []byte
+	ttl           time.Duration
+	sweepInterval time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Option configures Storage.
+type Option func(*Storage)
+
+// WithBotID stores sessions in the bucket of the given bot,
+// so several bots can share one file.
+func WithBotID(botID int64) Option {
+	return func(s *Storage) {
+		s.bucket = []byte("bot:" + strconv.FormatInt(botID, 10))
+	}
+}
+
+// WithBucket overrides the bucket name.
+func WithBucket(name string) Option {
+	return func(s *Storage) {
+		if name != "" {
+			s.bucket = []byte(name)
+		}
+	}
+}
+
+// WithTTL expires sessions not updated for ttl. Zero disables expiry.
+// User profiles (scenario.ProfileChatID) and shared records of chats (scenario.SharedUserID)
+// never expire.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Storage) {
+		s.ttl = ttl
+	}
+}
+
+// WithSweepInterval sets how often expired sessions are removed from the file.
+// Defaults to ttl; zero disables background sweeping.
+func WithSweepInterval(interval time.Duration) Option {
+	return func(s *Storage) {
+		s.sweepInterval = interval
+	}
+}
+
+// Open opens (or creates) the bbolt file at path.
+// The file is closed by Close.
+func Open(path string, opts ...Option) (*Storage, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("bbolt.Open: %w", err)
+	}
+
+	storage, err := NewStorage(db, opts...)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	storage.ownDB = true
+
+	return storage, nil
+}
+
+// NewStorage .
+func NewStorage(db *bbolt.DB, opts ...Option) (*Storage, error) {
+	storage := &Storage{
+		db:            db,
+		bucket:        []byte(defaultBucket),
+		sweepInterval: -1,
+		stop:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(storage)
+	}
+	if storage.sweepInterval < 0 {
+		storage.sweepInterval = storage.ttl
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(storage.bucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create bucket: %w", err)
+	}
+
+	if storage.ttl > 0 && storage.sweepInterval > 0 {
+		storage.wg.Add(1)
+		go storage.sweepLoop()
+	}
+
+	return storage, nil
+}
+
+// Close stops sweeping and closes the file if it was opened by Open.
+func (s *Storage) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.wg.Wait()
+
+	if s.ownDB {
+		return s.db.Close()
+	}
+	return nil
+}
+
+// GetSession .
+func (s *Storage) GetSession(_ context.Context, chatID, userID int64) (*scenario.SessionBase, error) {
+	var session scenario.SessionBase
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(s.bucket).Get(key(chatID, userID))
+		if value == nil {
+			return scenario.ErrSessionNotFound
+		}
+		return json.Unmarshal(value, &session)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.expired(&session, time.Now()) {
+		return nil, scenario.ErrSessionNotFound
+	}
+
+	return &session, nil
+}
+
+// SetSession .
+func (s *Storage) SetSession(_ context.Context, sess *scenario.SessionBase) error {
+	stored := *sess
+	if stored.Data == nil {
+		stored.Data = []byte("{}")
+	}
+	stored.UpdatedAt = time.Now()
+
+	value, err := json.Marshal(&stored)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(s.bucket).Put(key(sess.ChatID, sess.UserID), value)
+	})
+}
+
+// Sweep removes expired sessions and returns how many were removed.
+func (s *Storage) Sweep() (int, error) {
+	if s.ttl <= 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	removed := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(s.bucket)
+
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var session scenario.SessionBase
+			if err := json.Unmarshal(v, &session); err == nil && s.expired(&session, now) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err = bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+		return nil
+	})
+
+	return removed, err
+}
+
+func (s *Storage) sweepLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			_, _ = s.Sweep()
+		}
+	}
+}
+
+func (s *Storage) expired(sess *scenario.SessionBase, now time.Time) bool {
+	if sess.ChatID == scenario.ProfileChatID || sess.UserID == scenario.SharedUserID {
+		return false
+	}
+	return s.ttl > 0 && now.Sub(sess.UpdatedAt) > s.ttl
+}
+
+// key encodes chatID and userID big-endian, so sessions of a chat are adjacent.
+func key(chatID, userID int64) []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[:8], uint64(chatID))
+	binary.BigEndian.PutUint64(buf[8:], uint64(userID))
+	return buf
+}
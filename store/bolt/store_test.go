@@ -0,0 +1,173 @@
+package bolt
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+
+	"github.com/themgmd/scenario"
+)
+
+func openTestStorage(t *testing.T, opts ...Option) *Storage {
+	t.Helper()
+
+	storage, err := Open(filepath.Join(t.TempDir(), "sessions.db"), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = storage.Close() })
+	return storage
+}
+
+func TestStorageGetSessionNotFound(t *testing.T) {
+	storage := openTestStorage(t)
+
+	sess, err := storage.GetSession(context.Background(), 1, 2)
+	assert.ErrorIs(t, err, scenario.ErrSessionNotFound)
+	assert.Nil(t, sess)
+}
+
+func TestStorageSetAndGetSession(t *testing.T) {
+	storage := openTestStorage(t)
+	ctx := context.Background()
+
+	err := storage.SetSession(ctx, &scenario.SessionBase{
+		ChatID: -100,
+		UserID: 200,
+		Scene:  "register",
+		Step:   2,
+		Data:   []byte(`{"name":"Bob"}`),
+	})
+	require.NoError(t, err)
+
+	sess, err := storage.GetSession(ctx, -100, 200)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-100), sess.ChatID)
+	assert.Equal(t, int64(200), sess.UserID)
+	assert.Equal(t, scenario.SceneName("register"), sess.Scene)
+	assert.Equal(t, 2, sess.Step)
+	assert.JSONEq(t, `{"name":"Bob"}`, string(sess.Data))
+	assert.False(t, sess.UpdatedAt.IsZero())
+}
+
+func TestStoragePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	ctx := context.Background()
+
+	storage, err := Open(path)
+	require.NoError(t, err)
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Scene: "s"}))
+	require.NoError(t, storage.Close())
+
+	storage, err = Open(path)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	sess, err := storage.GetSession(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, scenario.SceneName("s"), sess.Scene)
+}
+
+func TestStorageBucketPerBot(t *testing.T) {
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "sessions.db"), 0o600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	first, err := NewStorage(db, WithBotID(1))
+	require.NoError(t, err)
+	second, err := NewStorage(db, WithBotID(2))
+	require.NoError(t, err)
+
+	require.NoError(t, first.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Scene: "first"}))
+
+	_, err = second.GetSession(ctx, 1, 2)
+	assert.ErrorIs(t, err, scenario.ErrSessionNotFound)
+
+	sess, err := first.GetSession(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, scenario.SceneName("first"), sess.Scene)
+}
+
+func TestStorageExpiry(t *testing.T) {
+	storage := openTestStorage(t, WithTTL(20*time.Millisecond), WithSweepInterval(0))
+	ctx := context.Background()
+
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 1}))
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 2, UserID: 2}))
+
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 3, UserID: 3}))
+
+	_, err := storage.GetSession(ctx, 1, 1)
+	assert.ErrorIs(t, err, scenario.ErrSessionNotFound)
+
+	removed, err := storage.Sweep()
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	_, err = storage.GetSession(ctx, 3, 3)
+	assert.NoError(t, err)
+}
+
+func TestStorageExpiryKeepsProfilesAndShared(t *testing.T) {
+	storage := openTestStorage(t, WithTTL(10*time.Millisecond), WithSweepInterval(0))
+	ctx := context.Background()
+
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: scenario.ProfileChatID, UserID: 1}))
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: -100, UserID: scenario.SharedUserID}))
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: -100, UserID: 1}))
+	time.Sleep(20 * time.Millisecond)
+
+	removed, err := storage.Sweep()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	_, err = storage.GetSession(ctx, scenario.ProfileChatID, 1)
+	assert.NoError(t, err)
+	_, err = storage.GetSession(ctx, -100, scenario.SharedUserID)
+	assert.NoError(t, err)
+}
+
+func TestStorageBackgroundSweep(t *testing.T) {
+	storage := openTestStorage(t, WithTTL(10*time.Millisecond), WithSweepInterval(5*time.Millisecond))
+	ctx := context.Background()
+
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 1}))
+
+	assert.Eventually(t, func() bool {
+		count := 0
+		_ = storage.db.View(func(tx *bbolt.Tx) error {
+			count = tx.Bucket(storage.bucket).Stats().KeyN
+			return nil
+		})
+		return count == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestStorageConcurrentAccess(t *testing.T) {
+	storage := openTestStorage(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			assert.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: id, UserID: id, Step: int(id)}))
+			_, err := storage.GetSession(ctx, id, id)
+			assert.NoError(t, err)
+		}(int64(i))
+	}
+	wg.Wait()
+
+	for i := int64(0); i < 20; i++ {
+		sess, err := storage.GetSession(ctx, i, i)
+		require.NoError(t, err)
+		assert.Equal(t, int(i), sess.Step)
+	}
+}
@@ -0,0 +1,247 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/themgmd/scenario"
+)
+
+const defaultCapacity = 10000
+
+// Key identifies a cached session.
+type Key struct {
+	ChatID int64
+	UserID int64
+}
+
+type entry struct {
+	key      Key
+	sess     scenario.SessionBase
+	cachedAt time.Time
+}
+
+// Storage is a write-through scenario.Store decorator with a bounded LRU cache.
+// Reads are served from the cache when possible, writes go to the wrapped store first.
+type Storage struct {
+	store    scenario.Store
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	order *list.List // front is the most recently used entry
+	items map[Key]*list.Element
+	fills map[Key]*fill
+}
+
+// fill tracks reads of a key from the wrapped store. Writes and invalidations bump
+// the generation, so a read that started before them doesn't cache a stale session.
+type fill struct {
+	readers int
+	gen     uint64
+}
+
+// Option configures Storage.
+type Option func(*Storage)
+
+// WithCapacity limits the number of cached sessions (10000 by default).
+func WithCapacity(capacity int) Option {
+	return func(s *Storage) {
+		if capacity > 0 {
+			s.capacity = capacity
+		}
+	}
+}
+
+// WithTTL drops cached sessions older than ttl. Zero keeps them until evicted.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Storage) {
+		s.ttl = ttl
+	}
+}
+
+// NewStorage wraps store with a cache.
+func NewStorage(store scenario.Store, opts ...Option) *Storage {
+	storage := &Storage{
+		store:    store,
+		capacity: defaultCapacity,
+		now:      time.Now,
+		order:    list.New(),
+		items:    make(map[Key]*list.Element),
+		fills:    make(map[Key]*fill),
+	}
+	for _, opt := range opts {
+		opt(storage)
+	}
+	return storage
+}
+
+// GetSession .
+func (s *Storage) GetSession(ctx context.Context, chatID, userID int64) (*scenario.SessionBase, error) {
+	k := Key{ChatID: chatID, UserID: userID}
+	if sess, ok := s.get(k); ok {
+		return sess, nil
+	}
+
+	gen := s.beginFill(k)
+	sess, err := s.store.GetSession(ctx, chatID, userID)
+	s.endFill(k, gen, sess, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// SetSession writes the session through to the wrapped store and caches it on success.
+func (s *Storage) SetSession(ctx context.Context, sess *scenario.SessionBase) error {
+	k := Key{ChatID: sess.ChatID, UserID: sess.UserID}
+	if err := s.store.SetSession(ctx, sess); err != nil {
+		s.Invalidate(k)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bump(k)
+	s.put(k, sess)
+	return nil
+}
+
+// Invalidate drops cached sessions, e.g. after another replica changed them.
+func (s *Storage) Invalidate(keys ...Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		s.bump(k)
+		if el, ok := s.items[k]; ok {
+			s.removeElement(el)
+		}
+	}
+}
+
+// Purge drops all cached sessions.
+func (s *Storage) Purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.order.Init()
+	clear(s.items)
+	for _, f := range s.fills {
+		f.gen++
+	}
+}
+
+// Listen invalidates sessions received from keys until ctx is done or keys is closed.
+// It is meant to be connected to an external change feed (Redis pub/sub, LISTEN/NOTIFY, etc.).
+func (s *Storage) Listen(ctx context.Context, keys <-chan Key) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case k, ok := <-keys:
+			if !ok {
+				return
+			}
+			s.Invalidate(k)
+		}
+	}
+}
+
+// Len returns the number of cached sessions.
+func (s *Storage) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+func (s *Storage) get(k Key) (*scenario.SessionBase, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[k]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if s.ttl > 0 && s.now().Sub(e.cachedAt) > s.ttl {
+		s.removeElement(el)
+		return nil, false
+	}
+	s.order.MoveToFront(el)
+
+	return cloneSession(&e.sess), true
+}
+
+// beginFill registers a read of k from the wrapped store and returns the generation of k.
+func (s *Storage) beginFill(k Key) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.fills[k]
+	if !ok {
+		f = &fill{}
+		s.fills[k] = f
+	}
+	f.readers++
+	return f.gen
+}
+
+// endFill caches sess unless k was written or invalidated since beginFill.
+func (s *Storage) endFill(k Key, gen uint64, sess *scenario.SessionBase, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.fills[k]
+	if f.readers--; f.readers == 0 {
+		delete(s.fills, k)
+	}
+	// a nil session without an error isn't cached, the wrapped store is asked again
+	if err == nil && sess != nil && f.gen == gen {
+		s.put(k, sess)
+	}
+}
+
+// bump makes reads of k in flight stale. s.mu must be held.
+func (s *Storage) bump(k Key) {
+	if f, ok := s.fills[k]; ok {
+		f.gen++
+	}
+}
+
+// put caches sess. s.mu must be held.
+func (s *Storage) put(k Key, sess *scenario.SessionBase) {
+	if el, ok := s.items[k]; ok {
+		e := el.Value.(*entry)
+		e.sess = *cloneSession(sess)
+		e.cachedAt = s.now()
+		s.order.MoveToFront(el)
+		return
+	}
+
+	s.items[k] = s.order.PushFront(&entry{
+		key:      k,
+		sess:     *cloneSession(sess),
+		cachedAt: s.now(),
+	})
+	for s.order.Len() > s.capacity {
+		s.removeElement(s.order.Back())
+	}
+}
+
+func (s *Storage) removeElement(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.items, el.Value.(*entry).key)
+}
+
+// cloneSession copies sess, so callers can't modify cached data.
+func cloneSession(sess *scenario.SessionBase) *scenario.SessionBase {
+	clone := *sess
+	clone.Data = bytes.Clone(sess.Data)
+	clone.SceneData = bytes.Clone(sess.SceneData)
+	clone.Meta = bytes.Clone(sess.Meta)
+	return &clone
+}
@@ -0,0 +1,275 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/themgmd/scenario"
+)
+
+type countingStore struct {
+	mu       sync.Mutex
+	sessions map[Key]scenario.SessionBase
+	gets     int
+	setErr   error
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{sessions: make(map[Key]scenario.SessionBase)}
+}
+
+func (s *countingStore) GetSession(_ context.Context, chatID, userID int64) (*scenario.SessionBase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gets++
+	sess, ok := s.sessions[Key{ChatID: chatID, UserID: userID}]
+	if !ok {
+		return nil, scenario.ErrSessionNotFound
+	}
+	return &sess, nil
+}
+
+func (s *countingStore) SetSession(_ context.Context, sess *scenario.SessionBase) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.setErr != nil {
+		return s.setErr
+	}
+	s.sessions[Key{ChatID: sess.ChatID, UserID: sess.UserID}] = *sess
+	return nil
+}
+
+func TestStorageServesReadsFromCache(t *testing.T) {
+	backend := newCountingStore()
+	storage := NewStorage(backend)
+	ctx := context.Background()
+
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Scene: "s"}))
+
+	for i := 0; i < 3; i++ {
+		sess, err := storage.GetSession(ctx, 1, 2)
+		require.NoError(t, err)
+		assert.Equal(t, scenario.SceneName("s"), sess.Scene)
+	}
+	assert.Equal(t, 0, backend.gets)
+	assert.Equal(t, scenario.SceneName("s"), backend.sessions[Key{ChatID: 1, UserID: 2}].Scene)
+}
+
+func TestStorageCachesMisses(t *testing.T) {
+	backend := newCountingStore()
+	backend.sessions[Key{ChatID: 1, UserID: 2}] = scenario.SessionBase{ChatID: 1, UserID: 2, Step: 3}
+	storage := NewStorage(backend)
+	ctx := context.Background()
+
+	_, err := storage.GetSession(ctx, 1, 2)
+	require.NoError(t, err)
+	sess, err := storage.GetSession(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, sess.Step)
+	assert.Equal(t, 1, backend.gets)
+
+	_, err = storage.GetSession(ctx, 5, 5)
+	assert.ErrorIs(t, err, scenario.ErrSessionNotFound)
+}
+
+// nilStore finds no session but reports no error either.
+type nilStore struct {
+	countingStore
+}
+
+func (s *nilStore) GetSession(context.Context, int64, int64) (*scenario.SessionBase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gets++
+	return nil, nil
+}
+
+func TestStorageDoesNotCacheNil(t *testing.T) {
+	backend := &nilStore{}
+	storage := NewStorage(backend)
+	ctx := context.Background()
+
+	for range 2 {
+		sess, err := storage.GetSession(ctx, 1, 2)
+		require.NoError(t, err)
+		assert.Nil(t, sess)
+	}
+	assert.Equal(t, 2, backend.gets)
+}
+
+func TestStorageReturnsCopies(t *testing.T) {
+	storage := NewStorage(newCountingStore())
+	ctx := context.Background()
+
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Data: []byte(`{"a":1}`)}))
+
+	sess, err := storage.GetSession(ctx, 1, 2)
+	require.NoError(t, err)
+	sess.Data[1] = 'b'
+	sess.Step = 10
+
+	sess, err = storage.GetSession(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(sess.Data))
+	assert.Equal(t, 0, sess.Step)
+}
+
+func TestStorageEvictsLeastRecentlyUsed(t *testing.T) {
+	backend := newCountingStore()
+	storage := NewStorage(backend, WithCapacity(2))
+	ctx := context.Background()
+
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1}))
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 2}))
+	_, err := storage.GetSession(ctx, 1, 0) // 1 becomes most recently used
+	require.NoError(t, err)
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 3}))
+
+	assert.Equal(t, 2, storage.Len())
+	_, err = storage.GetSession(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, backend.gets)
+
+	_, err = storage.GetSession(ctx, 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, backend.gets)
+}
+
+func TestStorageTTL(t *testing.T) {
+	backend := newCountingStore()
+	storage := NewStorage(backend, WithTTL(time.Minute))
+	now := time.Now()
+	storage.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1}))
+	_, err := storage.GetSession(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, backend.gets)
+
+	now = now.Add(2 * time.Minute)
+	_, err = storage.GetSession(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, backend.gets)
+}
+
+func TestStorageSetErrorInvalidates(t *testing.T) {
+	backend := newCountingStore()
+	storage := NewStorage(backend)
+	ctx := context.Background()
+
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, Step: 1}))
+
+	backend.setErr = errors.New("db is down")
+	err := storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, Step: 2})
+	assert.Error(t, err)
+	assert.Equal(t, 0, storage.Len())
+
+	sess, err := storage.GetSession(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sess.Step)
+}
+
+func TestStorageListenInvalidates(t *testing.T) {
+	backend := newCountingStore()
+	storage := NewStorage(backend)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2}))
+
+	keys := make(chan Key)
+	done := make(chan struct{})
+	go func() {
+		storage.Listen(ctx, keys)
+		close(done)
+	}()
+
+	keys <- Key{ChatID: 1, UserID: 2}
+	close(keys)
+	<-done
+
+	assert.Equal(t, 0, storage.Len())
+}
+
+// blockingStore reads the session, then waits for release before returning it.
+type blockingStore struct {
+	*countingStore
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) GetSession(ctx context.Context, chatID, userID int64) (*scenario.SessionBase, error) {
+	sess, err := s.countingStore.GetSession(ctx, chatID, userID)
+	s.read <- struct{}{}
+	<-s.release
+	return sess, err
+}
+
+func TestStorageMissDoesNotOverwriteWrite(t *testing.T) {
+	ctx := context.Background()
+
+	for name, write := range map[string]func(*Storage) error{
+		"set": func(storage *Storage) error {
+			return storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Step: 2})
+		},
+		"invalidate": func(storage *Storage) error {
+			storage.Invalidate(Key{ChatID: 1, UserID: 2})
+			return nil
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			backend := &blockingStore{
+				countingStore: newCountingStore(),
+				read:          make(chan struct{}, 2),
+				release:       make(chan struct{}),
+			}
+			backend.sessions[Key{ChatID: 1, UserID: 2}] = scenario.SessionBase{ChatID: 1, UserID: 2, Step: 1}
+			storage := NewStorage(backend)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_, err := storage.GetSession(ctx, 1, 2)
+				assert.NoError(t, err)
+			}()
+
+			<-backend.read // the miss has read step 1
+			backend.mu.Lock()
+			backend.sessions[Key{ChatID: 1, UserID: 2}] = scenario.SessionBase{ChatID: 1, UserID: 2, Step: 2}
+			backend.mu.Unlock()
+			require.NoError(t, write(storage))
+			close(backend.release)
+			<-done
+
+			sess, err := storage.GetSession(ctx, 1, 2)
+			require.NoError(t, err)
+			assert.Equal(t, 2, sess.Step)
+		})
+	}
+}
+
+func TestStorageConcurrentAccess(t *testing.T) {
+	storage := NewStorage(newCountingStore(), WithCapacity(8))
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			assert.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: id % 10}))
+			_, _ = storage.GetSession(ctx, id%10, 0)
+			storage.Invalidate(Key{ChatID: id % 3})
+		}(int64(i))
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, storage.Len(), 8)
+}
@@ -0,0 +1,53 @@
+package encrypt
+
+import (
+	"context"
+
+	"github.com/themgmd/scenario"
+)
+
+// History is a scenario.HistoryStore decorator that seals Transition.Data,
+// so session snapshots don't leave the encryption of Storage.
+type History struct {
+	history scenario.HistoryStore
+	storage *Storage
+}
+
+// History wraps history with the keys of the storage.
+func (s *Storage) History(history scenario.HistoryStore) *History {
+	return &History{history: history, storage: s}
+}
+
+// AddTransition .
+func (h *History) AddTransition(ctx context.Context, t scenario.Transition) error {
+	if len(t.Data) > 0 {
+		data, err := h.storage.seal(t.Data, historyAdditionalData(t))
+		if err != nil {
+			return err
+		}
+		t.Data = data
+	}
+	return h.history.AddTransition(ctx, t)
+}
+
+// Timeline .
+func (h *History) Timeline(ctx context.Context, q scenario.HistoryQuery) ([]scenario.Transition, error) {
+	transitions, err := h.history.Timeline(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range transitions {
+		data, err := h.storage.open(transitions[i].Data, historyAdditionalData(transitions[i]))
+		if err != nil {
+			return nil, err
+		}
+		transitions[i].Data = data
+	}
+	return transitions, nil
+}
+
+// historyAdditionalData keeps snapshots from being swapped with session data.
+func historyAdditionalData(t scenario.Transition) []byte {
+	return append(additionalData(&scenario.SessionBase{ChatID: t.ChatID, UserID: t.UserID}), ":history"...)
+}
@@ -0,0 +1,183 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/themgmd/scenario"
+)
+
+const algorithm = "aes-gcm"
+
+var (
+	ErrInvalidKey = errors.New("invalid encryption key")
+	ErrUnknownKey = errors.New("unknown encryption key")
+)
+
+// Key is an AES key identified by ID.
+// Secret must be 16, 24 or 32 bytes long (AES-128, AES-192 or AES-256).
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// envelope is stored instead of plaintext session data.
+// It is valid JSON, so it fits JSON/JSONB columns.
+type envelope struct {
+	Alg        string `json:"alg"`
+	KeyID      string `json:"kid"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ct"`
+}
+
+// Storage is a scenario.Store decorator that seals SessionBase.Data with AES-GCM.
+// Data is always encrypted with the current key and decrypted with whichever
+// configured key it was sealed with, so keys can be rotated by adding a new current key
+// and keeping old ones until all sessions are rewritten.
+// Rows that are not encrypted yet are returned as is and get encrypted on the next write.
+type Storage struct {
+	store   scenario.Store
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewStorage wraps store. The first key is used for encryption,
+// the rest are only used to decrypt data sealed before rotation.
+func NewStorage(store scenario.Store, current Key, previous ...Key) (*Storage, error) {
+	storage := &Storage{
+		store:   store,
+		current: current.ID,
+		aeads:   make(map[string]cipher.AEAD, len(previous)+1),
+	}
+
+	for _, key := range append([]Key{current}, previous...) {
+		if key.ID == "" {
+			return nil, fmt.Errorf("%w: empty key id", ErrInvalidKey)
+		}
+		if _, ok := storage.aeads[key.ID]; ok {
+			return nil, fmt.Errorf("%w: duplicate key id %q", ErrInvalidKey, key.ID)
+		}
+
+		block, err := aes.NewCipher(key.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %w", ErrInvalidKey, key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: cipher.NewGCM: %w", key.ID, err)
+		}
+		storage.aeads[key.ID] = aead
+	}
+
+	return storage, nil
+}
+
+// GetSession .
+func (s *Storage) GetSession(ctx context.Context, chatID, userID int64) (*scenario.SessionBase, error) {
+	sess, err := s.store.GetSession(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.open(sess.Data, additionalData(sess))
+	if err != nil {
+		return nil, err
+	}
+	sceneData, err := s.open(sess.SceneData, sceneAdditionalData(sess))
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := *sess
+	decrypted.Data = data
+	decrypted.SceneData = sceneData
+	return &decrypted, nil
+}
+
+// SetSession .
+func (s *Storage) SetSession(ctx context.Context, sess *scenario.SessionBase) error {
+	data, err := s.seal(sess.Data, additionalData(sess))
+	if err != nil {
+		return err
+	}
+
+	encrypted := *sess
+	encrypted.Data = data
+	if len(sess.SceneData) > 0 {
+		if encrypted.SceneData, err = s.seal(sess.SceneData, sceneAdditionalData(sess)); err != nil {
+			return err
+		}
+	}
+	return s.store.SetSession(ctx, &encrypted)
+}
+
+func (s *Storage) seal(plaintext, ad []byte) ([]byte, error) {
+	aead := s.aeads[s.current]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("rand.Read: %w", err)
+	}
+
+	data, err := json.Marshal(envelope{
+		Alg:        algorithm,
+		KeyID:      s.current,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, ad),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+	return data, nil
+}
+
+func (s *Storage) open(data, ad []byte) ([]byte, error) {
+	env, ok := parseEnvelope(data)
+	if !ok {
+		// not encrypted yet
+		return data, nil
+	}
+
+	aead, ok := s.aeads[env.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, env.KeyID)
+	}
+
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, ad)
+	if err != nil {
+		return nil, fmt.Errorf("aead.Open: %w", err)
+	}
+	return plaintext, nil
+}
+
+func parseEnvelope(data []byte) (envelope, bool) {
+	var env envelope
+	if !bytes.Contains(data, []byte(`"`+algorithm+`"`)) {
+		return env, false
+	}
+	if err := json.Unmarshal(data, &env); err != nil || env.Alg != algorithm {
+		return env, false
+	}
+	return env, true
+}
+
+// additionalData binds ciphertext to its session, so rows can't be swapped.
+func additionalData(sess *scenario.SessionBase) []byte {
+	buf := make([]byte, 0, 40)
+	buf = strconv.AppendInt(buf, sess.ChatID, 10)
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, sess.UserID, 10)
+	return buf
+}
+
+// sceneAdditionalData keeps data of inactive scenes from being swapped with Data.
+func sceneAdditionalData(sess *scenario.SessionBase) []byte {
+	return append(additionalData(sess), ":scenes"...)
+}
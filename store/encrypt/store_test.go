@@ -0,0 +1,167 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/themgmd/scenario"
+)
+
+type mapStore struct {
+	sessions map[[2]int64]scenario.SessionBase
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{sessions: make(map[[2]int64]scenario.SessionBase)}
+}
+
+func (s *mapStore) GetSession(_ context.Context, chatID, userID int64) (*scenario.SessionBase, error) {
+	sess, ok := s.sessions[[2]int64{chatID, userID}]
+	if !ok {
+		return nil, scenario.ErrSessionNotFound
+	}
+	return &sess, nil
+}
+
+func (s *mapStore) SetSession(_ context.Context, sess *scenario.SessionBase) error {
+	s.sessions[[2]int64{sess.ChatID, sess.UserID}] = *sess
+	return nil
+}
+
+var (
+	key1 = Key{ID: "k1", Secret: bytes.Repeat([]byte{1}, 32)}
+	key2 = Key{ID: "k2", Secret: bytes.Repeat([]byte{2}, 16)}
+)
+
+func TestStorageEncryptsData(t *testing.T) {
+	backend := newMapStore()
+	storage, err := NewStorage(backend, key1)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	data := []byte(`{"phone":"+79990000000"}`)
+	sceneData := []byte(`{"profile":{"data":{"phone":"+79990000001"}}}`)
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Scene: "s", Data: data, SceneData: sceneData}))
+
+	stored := backend.sessions[[2]int64{1, 2}]
+	assert.NotContains(t, string(stored.Data), "7999")
+	assert.NotContains(t, string(stored.SceneData), "7999")
+	assert.True(t, json.Valid(stored.Data))
+	assert.Equal(t, scenario.SceneName("s"), stored.Scene)
+
+	sess, err := storage.GetSession(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(sess.Data))
+	assert.Equal(t, string(sceneData), string(sess.SceneData))
+}
+
+func TestStorageKeyRotation(t *testing.T) {
+	backend := newMapStore()
+	ctx := context.Background()
+
+	old, err := NewStorage(backend, key1)
+	require.NoError(t, err)
+	require.NoError(t, old.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Data: []byte(`{"a":1}`)}))
+
+	rotated, err := NewStorage(backend, key2, key1)
+	require.NoError(t, err)
+
+	sess, err := rotated.GetSession(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(sess.Data))
+
+	// write re-encrypts with the current key
+	require.NoError(t, rotated.SetSession(ctx, sess))
+	env, ok := parseEnvelope(backend.sessions[[2]int64{1, 2}].Data)
+	require.True(t, ok)
+	assert.Equal(t, "k2", env.KeyID)
+
+	// old key is no longer needed
+	onlyNew, err := NewStorage(backend, key2)
+	require.NoError(t, err)
+	_, err = onlyNew.GetSession(ctx, 1, 2)
+	assert.NoError(t, err)
+}
+
+func TestStorageUnknownKey(t *testing.T) {
+	backend := newMapStore()
+	ctx := context.Background()
+
+	storage, err := NewStorage(backend, key1)
+	require.NoError(t, err)
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Data: []byte(`{}`)}))
+
+	other, err := NewStorage(backend, key2)
+	require.NoError(t, err)
+	_, err = other.GetSession(ctx, 1, 2)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestStorageRejectsSwappedRows(t *testing.T) {
+	backend := newMapStore()
+	ctx := context.Background()
+
+	storage, err := NewStorage(backend, key1)
+	require.NoError(t, err)
+	require.NoError(t, storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Data: []byte(`{}`)}))
+
+	sess := backend.sessions[[2]int64{1, 2}]
+	sess.UserID = 3
+	backend.sessions[[2]int64{1, 3}] = sess
+
+	_, err = storage.GetSession(ctx, 1, 3)
+	assert.Error(t, err)
+}
+
+func TestStoragePlaintextPassthrough(t *testing.T) {
+	backend := newMapStore()
+	backend.sessions[[2]int64{1, 2}] = scenario.SessionBase{ChatID: 1, UserID: 2, Data: []byte(`{"name":"Bob"}`)}
+
+	storage, err := NewStorage(backend, key1)
+	require.NoError(t, err)
+
+	sess, err := storage.GetSession(context.Background(), 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"Bob"}`, string(sess.Data))
+}
+
+func TestNewStorageInvalidKeys(t *testing.T) {
+	_, err := NewStorage(newMapStore(), Key{ID: "k", Secret: []byte("short")})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = NewStorage(newMapStore(), Key{Secret: key1.Secret})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = NewStorage(newMapStore(), key1, key1)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestHistoryEncryptsSnapshots(t *testing.T) {
+	storage, err := NewStorage(newMapStore(), key1)
+	require.NoError(t, err)
+	backend := scenario.NewMemoryHistory()
+	history := storage.History(backend)
+	ctx := context.Background()
+
+	data := []byte(`{"phone":"+79990000000"}`)
+	require.NoError(t, history.AddTransition(ctx, scenario.Transition{ChatID: 1, UserID: 2, Scene: "s", Data: data}))
+	require.NoError(t, history.AddTransition(ctx, scenario.Transition{ChatID: 1, UserID: 2, Scene: "s"}))
+
+	stored, err := backend.Timeline(ctx, scenario.HistoryQuery{ChatID: 1, UserID: 2})
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	assert.NotContains(t, string(stored[0].Data), "7999")
+	assert.True(t, json.Valid(stored[0].Data))
+	assert.Empty(t, stored[1].Data)
+
+	timeline, err := history.Timeline(ctx, scenario.HistoryQuery{ChatID: 1, UserID: 2})
+	require.NoError(t, err)
+	require.Len(t, timeline, 2)
+	assert.Equal(t, string(data), string(timeline[0].Data))
+	assert.Empty(t, timeline[1].Data)
+}
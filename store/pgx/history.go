@@ -0,0 +1,111 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/store/pkg"
+)
+
+// History is a PostgreSQL scenario.HistoryStore.
+type History struct {
+	executor    Executor
+	table       pkg.Table
+	autoMigrate bool
+}
+
+// HistoryOption configures History.
+type HistoryOption func(*History)
+
+// WithHistoryTable overrides the transitions table name (pkg.SqlHistoryTableName by default).
+func WithHistoryTable(name string) HistoryOption {
+	return func(h *History) {
+		h.table.Name = name
+	}
+}
+
+// WithHistorySchema places the transitions table into the given schema.
+func WithHistorySchema(schema string) HistoryOption {
+	return func(h *History) {
+		h.table.Schema = schema
+	}
+}
+
+// WithoutHistoryMigrations disables running migrations in NewHistory.
+func WithoutHistoryMigrations() HistoryOption {
+	return func(h *History) {
+		h.autoMigrate = false
+	}
+}
+
+// NewHistory .
+func NewHistory(executor Executor, opts ...HistoryOption) (*History, error) {
+	history := &History{
+		executor:    executor,
+		table:       pkg.DefaultHistoryTable(),
+		autoMigrate: true,
+	}
+	for _, opt := range opts {
+		opt(history)
+	}
+
+	if err := history.table.Validate(); err != nil {
+		return nil, err
+	}
+
+	if history.autoMigrate {
+		err := history.Migrate(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return history, nil
+}
+
+// Migrate applies pending schema migrations.
+func (h *History) Migrate(ctx context.Context) error {
+	migrations := pkg.HistoryMigrations(h.table)
+	return pkg.ApplyMigrations(ctx, migrator{executor: h.executor}, pkg.Postgres, h.table, migrations)
+}
+
+// AddTransition .
+func (h *History) AddTransition(ctx context.Context, t scenario.Transition) error {
+	var data any
+	if len(t.Data) > 0 {
+		data = []byte(t.Data)
+	}
+
+	query := fmt.Sprintf(pkg.SqlInsertTransitionQuery, h.table)
+	_, err := h.executor.Exec(ctx, query, t.ChatID, t.UserID, t.Scene, t.FromStep, t.ToStep, t.FromState, t.ToState, t.Reason, data, t.Time)
+	if err != nil {
+		return fmt.Errorf("failed to insert transition: %v", err)
+	}
+
+	return nil
+}
+
+// Timeline .
+func (h *History) Timeline(ctx context.Context, q scenario.HistoryQuery) ([]scenario.Transition, error) {
+	until := q.Until
+	if until.IsZero() {
+		until = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	var limit any
+	if q.Limit > 0 {
+		limit = q.Limit
+	}
+
+	var transitions []scenario.Transition
+	query := fmt.Sprintf(pkg.SqlTimelineQuery, h.table)
+	err := pgxscan.Select(ctx, h.executor, &transitions, query, q.ChatID, q.UserID, q.Since, until, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select timeline: %v", err)
+	}
+
+	return transitions, nil
+}
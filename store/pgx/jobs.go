@@ -0,0 +1,140 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/store/pkg"
+)
+
+// Jobs is a PostgreSQL scenario.JobStore. Jobs are claimed with DELETE ... RETURNING,
+// so several bot replicas may run the scheduler against one table.
+type Jobs struct {
+	executor    Executor
+	table       pkg.Table
+	autoMigrate bool
+}
+
+// JobsOption configures Jobs.
+type JobsOption func(*Jobs)
+
+// WithJobsTable overrides the jobs table name (pkg.SqlJobsTableName by default).
+func WithJobsTable(name string) JobsOption {
+	return func(j *Jobs) {
+		j.table.Name = name
+	}
+}
+
+// WithJobsSchema places the jobs table into the given schema.
+func WithJobsSchema(schema string) JobsOption {
+	return func(j *Jobs) {
+		j.table.Schema = schema
+	}
+}
+
+// WithoutJobsMigrations disables running migrations in NewJobs.
+func WithoutJobsMigrations() JobsOption {
+	return func(j *Jobs) {
+		j.autoMigrate = false
+	}
+}
+
+// NewJobs .
+func NewJobs(executor Executor, opts ...JobsOption) (*Jobs, error) {
+	jobs := &Jobs{
+		executor:    executor,
+		table:       pkg.DefaultJobsTable(),
+		autoMigrate: true,
+	}
+	for _, opt := range opts {
+		opt(jobs)
+	}
+
+	if err := jobs.table.Validate(); err != nil {
+		return nil, err
+	}
+
+	if jobs.autoMigrate {
+		err := jobs.Migrate(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return jobs, nil
+}
+
+// Migrate applies pending schema migrations.
+func (j *Jobs) Migrate(ctx context.Context) error {
+	migrations := pkg.JobsMigrations(j.table)
+	return pkg.ApplyMigrations(ctx, migrator{executor: j.executor}, pkg.Postgres, j.table, migrations)
+}
+
+// AddJob .
+func (j *Jobs) AddJob(ctx context.Context, job scenario.Job) error {
+	query := fmt.Sprintf(pkg.SqlUpsertJobQuery, j.table)
+	_, err := j.executor.Exec(ctx, query, job.ID, job.ChatID, job.UserID, job.Scene, job.Action, job.Payload, job.RunAt)
+	if err != nil {
+		return fmt.Errorf("failed to upsert job: %v", err)
+	}
+
+	return nil
+}
+
+// DueJobs .
+func (j *Jobs) DueJobs(ctx context.Context, now time.Time, limit int) ([]scenario.Job, error) {
+	var rows any
+	if limit > 0 {
+		rows = limit
+	}
+
+	var jobs []scenario.Job
+	query := fmt.Sprintf(pkg.SqlDueJobsQuery, j.table)
+	err := pgxscan.Select(ctx, j.executor, &jobs, query, now, rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select due jobs: %v", err)
+	}
+
+	return jobs, nil
+}
+
+// ClaimJob .
+func (j *Jobs) ClaimJob(ctx context.Context, id string) (bool, error) {
+	var claimed string
+	query := fmt.Sprintf(pkg.SqlClaimJobQuery, j.table)
+	err := j.executor.QueryRow(ctx, query, id).Scan(&claimed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim job: %v", err)
+	}
+
+	return true, nil
+}
+
+// DeleteJob .
+func (j *Jobs) DeleteJob(ctx context.Context, id string) error {
+	query := fmt.Sprintf(pkg.SqlDeleteJobQuery, j.table)
+	if _, err := j.executor.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete job: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteUserJobs .
+func (j *Jobs) DeleteUserJobs(ctx context.Context, chatID, userID int64) error {
+	query := fmt.Sprintf(pkg.SqlDeleteUserJobsQuery, j.table)
+	if _, err := j.executor.Exec(ctx, query, chatID, userID); err != nil {
+		return fmt.Errorf("failed to delete user jobs: %v", err)
+	}
+
+	return nil
+}
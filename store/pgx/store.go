@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sync"
 
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/jackc/pgx/v5"
@@ -26,33 +25,70 @@ type Executor interface {
 
 // Storage .
 type Storage struct {
-	executor     Executor
-	tableEnsured sync.Once
+	executor    Executor
+	table       pkg.Table
+	autoMigrate bool
+}
+
+// Option configures Storage.
+type Option func(*Storage)
+
+// WithTable overrides the sessions table name (pkg.SqlTableName by default).
+func WithTable(name string) Option {
+	return func(s *Storage) {
+		s.table.Name = name
+	}
+}
+
+// WithSchema places the sessions table into the given schema.
+// The schema must already exist.
+func WithSchema(schema string) Option {
+	return func(s *Storage) {
+		s.table.Schema = schema
+	}
+}
+
+// WithoutMigrations disables running migrations in NewStorage.
+// Use it when the schema is managed externally; Migrate can still be called explicitly.
+func WithoutMigrations() Option {
+	return func(s *Storage) {
+		s.autoMigrate = false
+	}
 }
 
 // NewStorage .
-func NewStorage(executor Executor) (*Storage, error) {
-	storage := &Storage{executor: executor}
-	err := storage.ensureTable(context.Background())
-	if err != nil {
+func NewStorage(executor Executor, opts ...Option) (*Storage, error) {
+	storage := &Storage{
+		executor:    executor,
+		table:       pkg.DefaultTable(),
+		autoMigrate: true,
+	}
+	for _, opt := range opts {
+		opt(storage)
+	}
+
+	if err := storage.table.Validate(); err != nil {
 		return nil, err
 	}
 
+	if storage.autoMigrate {
+		err := storage.Migrate(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return storage, nil
 }
 
-func (s *Storage) ensureTable(ctx context.Context) error {
-	var err error
-	s.tableEnsured.Do(func() {
-		query := fmt.Sprintf(pkg.SqlEnsureTableQuery, pkg.SqlTableName)
-		_, err = s.executor.Exec(ctx, query)
-	})
-	return err
+// Migrate applies pending schema migrations.
+func (s *Storage) Migrate(ctx context.Context) error {
+	return pkg.Migrate(ctx, migrator{executor: s.executor}, pkg.Postgres, s.table)
 }
 
 // GetSession .
 func (s *Storage) GetSession(ctx context.Context, chatID, userID int64) (*scenario.SessionBase, error) {
-	query := fmt.Sprintf(pkg.SqlGetSessionQuery, pkg.SqlTableName)
+	query := fmt.Sprintf(pkg.Postgres.GetSessionQuery(), s.table)
 
 	var session scenario.SessionBase
 	err := pgxscan.Get(ctx, s.executor, &session, query, chatID, userID)
@@ -72,12 +108,56 @@ func (s *Storage) SetSession(ctx context.Context, sess *scenario.SessionBase) er
 	if payload == nil {
 		payload = []byte("{}")
 	}
+	codec := sess.Codec
+	if codec == "" {
+		codec = "json"
+	}
+	sceneData := sess.SceneData
+	if sceneData == nil {
+		sceneData = []byte("{}")
+	}
+	meta := sess.Meta
+	if meta == nil {
+		meta = []byte("{}")
+	}
 
-	query := fmt.Sprintf(pkg.SqlUpsertSessionQuery, pkg.SqlTableName)
-	_, err := s.executor.Exec(ctx, query, sess.ChatID, sess.UserID, payload, sess.Scene, sess.Step)
+	query := fmt.Sprintf(pkg.Postgres.UpsertSessionQuery(), s.table)
+	_, err := s.executor.Exec(ctx, query, sess.ChatID, sess.UserID, payload, sess.Scene, sess.Step, codec, sess.DataVersion, sess.State, sceneData, meta)
 	if err != nil {
 		return fmt.Errorf("failed to upsert session: %v", err)
 	}
 
 	return nil
 }
+
+// migrator adapts Executor to pkg.Migrator.
+type migrator struct {
+	executor interface {
+		Begin(ctx context.Context) (pgx.Tx, error)
+		Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+		Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	}
+}
+
+func (m migrator) Exec(ctx context.Context, query string, args ...any) error {
+	_, err := m.executor.Exec(ctx, query, args...)
+	return err
+}
+
+func (m migrator) Versions(ctx context.Context, query string) ([]int, error) {
+	var versions []int
+	err := pgxscan.Select(ctx, m.executor, &versions, query)
+	return versions, err
+}
+
+func (m migrator) Tx(ctx context.Context, fn func(ctx context.Context, m pkg.Migrator) error) error {
+	return pgx.BeginFunc(ctx, m.executor, func(tx pgx.Tx) error {
+		return fn(ctx, migrator{executor: tx})
+	})
+}
+
+// Conn runs fn in a transaction, which holds one connection of a pool.
+// Migrations inside run in savepoints.
+func (m migrator) Conn(ctx context.Context, fn func(ctx context.Context, m pkg.Migrator) error) error {
+	return m.Tx(ctx, fn)
+}
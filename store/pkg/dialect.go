@@ -0,0 +1,175 @@
+package pkg
+
+import "strings"
+
+// Dialect describes the SQL flavour used by a session store.
+// Queries returned by a Dialect contain a single %s verb for the table name.
+type Dialect interface {
+	// Name returns the dialect name, e.g. "postgres".
+	Name() string
+	// EnsureTableQuery returns the DDL that creates the sessions table.
+	EnsureTableQuery() string
+	// UpsertSessionQuery inserts or updates a session row.
+	// Arguments: chat_id, user_id, data, scene, step, codec, data_version, state, scene_data, meta.
+	UpsertSessionQuery() string
+	// GetSessionQuery selects a session row.
+	// Arguments: chat_id, user_id.
+	GetSessionQuery() string
+	// Migrations returns ordered schema migrations of the sessions table.
+	Migrations() []Migration
+	// EnsureMigrationsTableQuery returns the DDL that creates the migrations table.
+	EnsureMigrationsTableQuery() string
+	// AppliedMigrationsQuery selects applied migration versions.
+	AppliedMigrationsQuery() string
+	// InsertMigrationQuery records an applied migration.
+	// Arguments: version, name.
+	InsertMigrationQuery() string
+}
+
+var (
+	// Postgres is the PostgreSQL dialect (JSONB data, $N placeholders).
+	Postgres Dialect = postgresDialect{}
+	// SQLite is the SQLite dialect (TEXT data, ? placeholders).
+	SQLite Dialect = sqliteDialect{}
+	// MySQL is the MySQL dialect (JSON data, ? placeholders).
+	// The DSN must contain parseTime=true so updated_at scans into time.Time.
+	MySQL Dialect = mysqlDialect{}
+)
+
+// DialectByDriver returns dialect for the given database/sql driver name.
+// Unknown drivers fall back to Postgres.
+func DialectByDriver(driverName string) Dialect {
+	switch strings.ToLower(driverName) {
+	case "sqlite", "sqlite3":
+		return SQLite
+	case "mysql":
+		return MySQL
+	default:
+		return Postgres
+	}
+}
+
+const (
+	ensureMigrationsTableQuery = `CREATE TABLE IF NOT EXISTS %s (
+		version INTEGER NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+
+	appliedMigrationsQuery = `SELECT version FROM %s ORDER BY version`
+)
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) EnsureTableQuery() string { return SqlEnsureTableQuery }
+
+func (postgresDialect) UpsertSessionQuery() string { return SqlUpsertSessionQuery }
+
+func (postgresDialect) GetSessionQuery() string { return SqlGetSessionQuery }
+
+func (d postgresDialect) Migrations() []Migration {
+	return []Migration{
+		{Version: 1, Name: "create_sessions", Query: d.EnsureTableQuery()},
+		{Version: 2, Name: "add_codec", Query: SqlAddCodecQuery},
+		{Version: 3, Name: "add_data_version", Query: SqlAddDataVersionQuery},
+		{Version: 4, Name: "add_state", Query: SqlAddStateQuery},
+		{Version: 5, Name: "add_scene_data", Query: SqlAddSceneDataQuery},
+		{Version: 6, Name: "add_meta", Query: SqlAddMetaQuery},
+	}
+}
+
+func (postgresDialect) EnsureMigrationsTableQuery() string { return ensureMigrationsTableQuery }
+
+func (postgresDialect) AppliedMigrationsQuery() string { return appliedMigrationsQuery }
+
+func (postgresDialect) InsertMigrationQuery() string {
+	return `INSERT INTO %s (version, name) VALUES ($1, $2)`
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) EnsureTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS %s (
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		scene TEXT,
+		step INTEGER NOT NULL DEFAULT -1,
+		data TEXT NOT NULL DEFAULT '{}',
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (chat_id, user_id)
+	)`
+}
+
+func (sqliteDialect) UpsertSessionQuery() string {
+	return `INSERT INTO %s (chat_id, user_id, data, scene, step, codec, data_version, state, scene_data, meta, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP) ON CONFLICT (chat_id, user_id) DO UPDATE SET data = excluded.data, scene = excluded.scene, step = excluded.step, codec = excluded.codec, data_version = excluded.data_version, state = excluded.state, scene_data = excluded.scene_data, meta = excluded.meta, updated_at = CURRENT_TIMESTAMP`
+}
+
+func (sqliteDialect) GetSessionQuery() string {
+	return `SELECT * FROM %s WHERE chat_id=? AND user_id=?`
+}
+
+func (d sqliteDialect) Migrations() []Migration {
+	return []Migration{
+		{Version: 1, Name: "create_sessions", Query: d.EnsureTableQuery()},
+		{Version: 2, Name: "add_codec", Query: `ALTER TABLE %s ADD COLUMN codec TEXT NOT NULL DEFAULT 'json'`},
+		{Version: 3, Name: "add_data_version", Query: `ALTER TABLE %s ADD COLUMN data_version INTEGER NOT NULL DEFAULT 0`},
+		{Version: 4, Name: "add_state", Query: `ALTER TABLE %s ADD COLUMN state TEXT NOT NULL DEFAULT ''`},
+		{Version: 5, Name: "add_scene_data", Query: `ALTER TABLE %s ADD COLUMN scene_data TEXT NOT NULL DEFAULT '{}'`},
+		{Version: 6, Name: "add_meta", Query: `ALTER TABLE %s ADD COLUMN meta TEXT NOT NULL DEFAULT '{}'`},
+	}
+}
+
+func (sqliteDialect) EnsureMigrationsTableQuery() string { return ensureMigrationsTableQuery }
+
+func (sqliteDialect) AppliedMigrationsQuery() string { return appliedMigrationsQuery }
+
+func (sqliteDialect) InsertMigrationQuery() string {
+	return `INSERT INTO %s (version, name) VALUES (?, ?)`
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) EnsureTableQuery() string {
+	return `CREATE TABLE IF NOT EXISTS %s (
+		chat_id BIGINT NOT NULL,
+		user_id BIGINT NOT NULL,
+		scene TEXT,
+		step INTEGER NOT NULL DEFAULT -1,
+		data JSON NOT NULL,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (chat_id, user_id)
+	)`
+}
+
+func (mysqlDialect) UpsertSessionQuery() string {
+	return `INSERT INTO %s (chat_id, user_id, data, scene, step, codec, data_version, state, scene_data, meta, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP) ON DUPLICATE KEY UPDATE data = VALUES(data), scene = VALUES(scene), step = VALUES(step), codec = VALUES(codec), data_version = VALUES(data_version), state = VALUES(state), scene_data = VALUES(scene_data), meta = VALUES(meta), updated_at = CURRENT_TIMESTAMP`
+}
+
+func (mysqlDialect) GetSessionQuery() string {
+	return `SELECT * FROM %s WHERE chat_id=? AND user_id=?`
+}
+
+func (d mysqlDialect) Migrations() []Migration {
+	return []Migration{
+		{Version: 1, Name: "create_sessions", Query: d.EnsureTableQuery()},
+		{Version: 2, Name: "add_codec", Query: `ALTER TABLE %s ADD COLUMN codec VARCHAR(32) NOT NULL DEFAULT 'json'`},
+		{Version: 3, Name: "add_data_version", Query: `ALTER TABLE %s ADD COLUMN data_version INTEGER NOT NULL DEFAULT 0`},
+		{Version: 4, Name: "add_state", Query: `ALTER TABLE %s ADD COLUMN state VARCHAR(255) NOT NULL DEFAULT ''`},
+		{Version: 5, Name: "add_scene_data", Query: `ALTER TABLE %s ADD COLUMN scene_data JSON NOT NULL DEFAULT (JSON_OBJECT())`},
+		{Version: 6, Name: "add_meta", Query: `ALTER TABLE %s ADD COLUMN meta JSON NOT NULL DEFAULT (JSON_OBJECT())`},
+	}
+}
+
+func (mysqlDialect) EnsureMigrationsTableQuery() string { return ensureMigrationsTableQuery }
+
+func (mysqlDialect) AppliedMigrationsQuery() string { return appliedMigrationsQuery }
+
+func (mysqlDialect) InsertMigrationQuery() string {
+	return `INSERT INTO %s (version, name) VALUES (?, ?)`
+}
@@ -0,0 +1,27 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialectByDriver(t *testing.T) {
+	assert.Equal(t, Postgres, DialectByDriver("pgx"))
+	assert.Equal(t, Postgres, DialectByDriver("postgres"))
+	assert.Equal(t, Postgres, DialectByDriver("unknown"))
+	assert.Equal(t, SQLite, DialectByDriver("sqlite"))
+	assert.Equal(t, SQLite, DialectByDriver("sqlite3"))
+	assert.Equal(t, MySQL, DialectByDriver("mysql"))
+}
+
+func TestDialectPlaceholders(t *testing.T) {
+	assert.Contains(t, Postgres.UpsertSessionQuery(), "$10")
+	assert.Contains(t, Postgres.UpsertSessionQuery(), "ON CONFLICT")
+	assert.NotContains(t, SQLite.UpsertSessionQuery(), "$1")
+	assert.Contains(t, SQLite.UpsertSessionQuery(), "ON CONFLICT")
+	assert.NotContains(t, MySQL.UpsertSessionQuery(), "$1")
+	assert.Contains(t, MySQL.UpsertSessionQuery(), "ON DUPLICATE KEY UPDATE")
+	assert.NotContains(t, SQLite.EnsureTableQuery(), "JSONB")
+	assert.Contains(t, MySQL.EnsureTableQuery(), "JSON")
+}
@@ -0,0 +1,46 @@
+package pkg
+
+import "fmt"
+
+const (
+	SqlHistoryTableName = "telegram_scene_history"
+)
+
+const (
+	SqlEnsureHistoryTableQuery = `CREATE TABLE IF NOT EXISTS %s (
+		id BIGSERIAL PRIMARY KEY,
+		chat_id BIGINT NOT NULL,
+		user_id BIGINT NOT NULL,
+		scene TEXT NOT NULL,
+		from_step INTEGER NOT NULL,
+		to_step INTEGER NOT NULL,
+		reason TEXT NOT NULL,
+		data JSONB,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`
+
+	SqlAddStateColumnsQuery = `ALTER TABLE %s ADD COLUMN IF NOT EXISTS from_state TEXT NOT NULL DEFAULT '', ADD COLUMN IF NOT EXISTS to_state TEXT NOT NULL DEFAULT ''`
+
+	SqlInsertTransitionQuery = `INSERT INTO %s (chat_id, user_id, scene, from_step, to_step, from_state, to_state, reason, data, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	// SqlTimelineQuery arguments: chat_id, user_id, since, until, limit (NULL for all).
+	SqlTimelineQuery = `SELECT chat_id, user_id, scene, from_step, to_step, from_state, to_state, reason, data, created_at FROM %s WHERE chat_id=$1 AND user_id=$2 AND created_at >= $3 AND created_at < $4 ORDER BY created_at, id LIMIT $5`
+)
+
+// DefaultHistoryTable returns the default transitions table.
+func DefaultHistoryTable() Table {
+	return Table{Name: SqlHistoryTableName}
+}
+
+// HistoryMigrations returns PostgreSQL migrations of the transitions table.
+func HistoryMigrations(table Table) []Migration {
+	return []Migration{
+		{Version: 1, Name: "create_history", Query: SqlEnsureHistoryTableQuery},
+		{
+			Version: 2,
+			Name:    "create_history_timeline_index",
+			Query:   fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_timeline_idx ON %%s (chat_id, user_id, created_at)`, table.Name),
+		},
+		{Version: 3, Name: "add_history_states", Query: SqlAddStateColumnsQuery},
+	}
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import "fmt"
+
+const (
+	SqlJobsTableName = "telegram_scene_jobs"
+)
+
+const (
+	SqlEnsureJobsTableQuery = `CREATE TABLE IF NOT EXISTS %s (
+		id TEXT PRIMARY KEY,
+		chat_id BIGINT NOT NULL,
+		user_id BIGINT NOT NULL,
+		scene TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT '',
+		run_at TIMESTAMPTZ NOT NULL
+	)`
+
+	SqlUpsertJobQuery = `INSERT INTO %s (id, chat_id, user_id, scene, action, payload, run_at) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET chat_id = EXCLUDED.chat_id, user_id = EXCLUDED.user_id, scene = EXCLUDED.scene,
+		action = EXCLUDED.action, payload = EXCLUDED.payload, run_at = EXCLUDED.run_at`
+
+	// SqlDueJobsQuery arguments: now, limit (NULL for all).
+	SqlDueJobsQuery = `SELECT id, chat_id, user_id, scene, action, payload, run_at FROM %s WHERE run_at <= $1 ORDER BY run_at, id LIMIT $2`
+
+	// SqlClaimJobQuery returns a row only to the one transaction that deleted the job.
+	SqlClaimJobQuery = `DELETE FROM %s WHERE id=$1 RETURNING id`
+
+	SqlDeleteJobQuery = `DELETE FROM %s WHERE id=$1`
+
+	SqlDeleteUserJobsQuery = `DELETE FROM %s WHERE chat_id=$1 AND user_id=$2`
+)
+
+// DefaultJobsTable returns the default jobs table.
+func DefaultJobsTable() Table {
+	return Table{Name: SqlJobsTableName}
+}
+
+// JobsMigrations returns PostgreSQL migrations of the jobs table.
+func JobsMigrations(table Table) []Migration {
+	return []Migration{
+		{Version: 1, Name: "create_jobs", Query: SqlEnsureJobsTableQuery},
+		{
+			Version: 2,
+			Name:    "create_jobs_run_at_index",
+			Query:   fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_run_at_idx ON %%s (run_at, id)`, table.Name),
+		},
+		{
+			Version: 3,
+			Name:    "create_jobs_user_index",
+			Query:   fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_user_idx ON %%s (chat_id, user_id)`, table.Name),
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package pkg
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Migration is a single versioned schema change.
+// Query contains a single %s verb for the qualified table name.
+type Migration struct {
+	Version int
+	Name    string
+	Query   string
+}
+
+// Migrator executes migration statements for a concrete database driver.
+type Migrator interface {
+	// Exec executes a statement.
+	Exec(ctx context.Context, query string, args ...any) error
+	// Versions returns versions selected by query.
+	Versions(ctx context.Context, query string) ([]int, error)
+	// Tx runs fn inside a transaction.
+	Tx(ctx context.Context, fn func(ctx context.Context, m Migrator) error) error
+	// Conn runs fn with a Migrator bound to a single connection, so that
+	// session-level locks taken by fn hold until it returns.
+	Conn(ctx context.Context, fn func(ctx context.Context, m Migrator) error) error
+}
+
+// migrationLock serializes migrations of a table between processes.
+type migrationLock struct {
+	lock   string
+	unlock string
+	abort  string // unlock after a failure, unlock by default
+	tx     bool   // lock is a transaction around all migrations
+}
+
+// lockMigrations returns the lock of the migrations table name for the dialect:
+// an advisory lock on PostgreSQL, a named lock on MySQL, a write transaction on SQLite.
+// Other dialects are not locked.
+func lockMigrations(dialect Dialect, name string) migrationLock {
+	switch dialect.Name() {
+	case "postgres":
+		return migrationLock{
+			lock:   fmt.Sprintf(`SELECT pg_advisory_lock(hashtext('%s'))`, name),
+			unlock: fmt.Sprintf(`SELECT pg_advisory_unlock(hashtext('%s'))`, name),
+		}
+	case "mysql":
+		return migrationLock{
+			lock:   fmt.Sprintf(`SELECT GET_LOCK('%s', -1)`, name),
+			unlock: fmt.Sprintf(`SELECT RELEASE_LOCK('%s')`, name),
+		}
+	case "sqlite":
+		return migrationLock{lock: `BEGIN IMMEDIATE`, unlock: `COMMIT`, abort: `ROLLBACK`, tx: true}
+	}
+	return migrationLock{}
+}
+
+// Migrate applies the dialect migrations to table that are not recorded yet.
+// Every migration runs in its own transaction together with its version record
+// (on SQLite all of them in one), and concurrent Migrate calls are serialized by
+// a database lock, so Migrate is safe to call on every start of every replica.
+func Migrate(ctx context.Context, m Migrator, dialect Dialect, table Table) error {
+	return ApplyMigrations(ctx, m, dialect, table, dialect.Migrations())
+}
+
+// ApplyMigrations applies migrations of an arbitrary table,
+// recording them in the table.Migrations() table of the dialect.
+func ApplyMigrations(ctx context.Context, m Migrator, dialect Dialect, table Table, migrations []Migration) error {
+	if err := table.Validate(); err != nil {
+		return err
+	}
+
+	versionsTable := table.Migrations().String()
+	lock := lockMigrations(dialect, versionsTable)
+	if lock.lock == "" {
+		return applyMigrations(ctx, m, dialect, table, migrations, false)
+	}
+
+	return m.Conn(ctx, func(ctx context.Context, conn Migrator) error {
+		if err := conn.Exec(ctx, lock.lock); err != nil {
+			return fmt.Errorf("lock migrations: %w", err)
+		}
+
+		err := applyMigrations(ctx, conn, dialect, table, migrations, lock.tx)
+		unlock := lock.unlock
+		if err != nil && lock.abort != "" {
+			unlock = lock.abort
+		}
+		if uerr := conn.Exec(context.WithoutCancel(ctx), unlock); uerr != nil && err == nil {
+			err = fmt.Errorf("unlock migrations: %w", uerr)
+		}
+		return err
+	})
+}
+
+// applyMigrations applies migrations that are not recorded yet. In a transaction
+// already, inTx, migrations are not wrapped into transactions of their own.
+func applyMigrations(ctx context.Context, m Migrator, dialect Dialect, table Table, migrations []Migration, inTx bool) error {
+	versionsTable := table.Migrations().String()
+	err := m.Exec(ctx, fmt.Sprintf(dialect.EnsureMigrationsTableQuery(), versionsTable))
+	if err != nil {
+		return fmt.Errorf("ensure migrations table: %w", err)
+	}
+
+	versions, err := m.Versions(ctx, fmt.Sprintf(dialect.AppliedMigrationsQuery(), versionsTable))
+	if err != nil {
+		return fmt.Errorf("applied migrations: %w", err)
+	}
+
+	migrations = slices.SortedFunc(slices.Values(migrations), func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	for _, migration := range migrations {
+		if slices.Contains(versions, migration.Version) {
+			continue
+		}
+
+		apply := func(ctx context.Context, tx Migrator) error {
+			if err := tx.Exec(ctx, fmt.Sprintf(migration.Query, table.String())); err != nil {
+				return err
+			}
+			query := fmt.Sprintf(dialect.InsertMigrationQuery(), versionsTable)
+			return tx.Exec(ctx, query, migration.Version, migration.Name)
+		}
+		if inTx {
+			err = apply(ctx, m)
+		} else {
+			err = m.Tx(ctx, apply)
+		}
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return nil
+}
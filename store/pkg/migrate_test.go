@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMigrator struct {
+	versions []int
+	execs    []string
+	failOn   string
+}
+
+func (m *fakeMigrator) Exec(_ context.Context, query string, args ...any) error {
+	if m.failOn != "" && strings.Contains(query, m.failOn) {
+		return errors.New("exec failed")
+	}
+	m.execs = append(m.execs, query)
+	if strings.HasPrefix(query, "INSERT") {
+		m.versions = append(m.versions, args[0].(int))
+	}
+	return nil
+}
+
+func (m *fakeMigrator) Versions(context.Context, string) ([]int, error) {
+	return m.versions, nil
+}
+
+func (m *fakeMigrator) Tx(ctx context.Context, fn func(context.Context, Migrator) error) error {
+	return fn(ctx, m)
+}
+
+func (m *fakeMigrator) Conn(ctx context.Context, fn func(context.Context, Migrator) error) error {
+	return fn(ctx, m)
+}
+
+func TestMigrateSkipsApplied(t *testing.T) {
+	m := &fakeMigrator{}
+	require.NoError(t, Migrate(context.Background(), m, Postgres, DefaultTable()))
+	assert.Len(t, m.versions, len(Postgres.Migrations()))
+
+	m.execs = nil
+	require.NoError(t, Migrate(context.Background(), m, Postgres, DefaultTable()))
+	require.Len(t, m.execs, 3) // only migrations table DDL under the lock
+	assert.Equal(t, `SELECT pg_advisory_lock(hashtext('telegram_scene_sessions_migrations'))`, m.execs[0])
+	assert.Equal(t, `SELECT pg_advisory_unlock(hashtext('telegram_scene_sessions_migrations'))`, m.execs[2])
+}
+
+func TestMigrateLocks(t *testing.T) {
+	m := &fakeMigrator{}
+	require.NoError(t, Migrate(context.Background(), m, MySQL, DefaultTable()))
+	assert.Equal(t, `SELECT GET_LOCK('telegram_scene_sessions_migrations', -1)`, m.execs[0])
+	assert.Equal(t, `SELECT RELEASE_LOCK('telegram_scene_sessions_migrations')`, m.execs[len(m.execs)-1])
+
+	m = &fakeMigrator{}
+	require.NoError(t, Migrate(context.Background(), m, SQLite, DefaultTable()))
+	assert.Equal(t, `BEGIN IMMEDIATE`, m.execs[0])
+	assert.Equal(t, `COMMIT`, m.execs[len(m.execs)-1])
+
+	m = &fakeMigrator{failOn: "ADD COLUMN meta"}
+	require.Error(t, Migrate(context.Background(), m, SQLite, DefaultTable()))
+	assert.Equal(t, `ROLLBACK`, m.execs[len(m.execs)-1])
+}
+
+func TestMigrateError(t *testing.T) {
+	m := &fakeMigrator{failOn: "chat_id BIGINT"}
+	err := Migrate(context.Background(), m, Postgres, Table{Schema: "bots", Name: "sessions"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migration 1")
+	assert.Empty(t, m.versions)
+	assert.Contains(t, m.execs[1], "bots.sessions_migrations")
+	assert.Contains(t, m.execs[2], "pg_advisory_unlock")
+}
+
+func TestMigrateInvalidTable(t *testing.T) {
+	err := Migrate(context.Background(), &fakeMigrator{}, Postgres, Table{Name: "a-b"})
+	assert.ErrorIs(t, err, ErrInvalidIdentifier)
+}
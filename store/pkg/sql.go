@@ -1,5 +1,11 @@
 package pkg
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
 const (
 	SqlTableName = "telegram_scene_sessions"
 )
@@ -15,7 +21,57 @@ const (
 		PRIMARY KEY (chat_id, user_id)
 	)`
 
-	SqlUpsertSessionQuery = `INSERT INTO %s (chat_id, user_id, data, scene, step, updated_at) VALUES ($1, $2, $3, $4, $5, NOW()) ON CONFLICT (chat_id, user_id) DO UPDATE SET data = excluded.data, scene = excluded.scene, step = excluded.step, updated_at = NOW()`
+	SqlAddCodecQuery = `ALTER TABLE %s ADD COLUMN IF NOT EXISTS codec VARCHAR(32) NOT NULL DEFAULT 'json'`
+
+	SqlAddDataVersionQuery = `ALTER TABLE %s ADD COLUMN IF NOT EXISTS data_version INTEGER NOT NULL DEFAULT 0`
+
+	SqlAddStateQuery = `ALTER TABLE %s ADD COLUMN IF NOT EXISTS state TEXT NOT NULL DEFAULT ''`
+
+	SqlAddSceneDataQuery = `ALTER TABLE %s ADD COLUMN IF NOT EXISTS scene_data JSONB NOT NULL DEFAULT '{}'::jsonb`
+
+	SqlAddMetaQuery = `ALTER TABLE %s ADD COLUMN IF NOT EXISTS meta JSONB NOT NULL DEFAULT '{}'::jsonb`
+
+	SqlUpsertSessionQuery = `INSERT INTO %s (chat_id, user_id, data, scene, step, codec, data_version, state, scene_data, meta, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW()) ON CONFLICT (chat_id, user_id) DO UPDATE SET data = excluded.data, scene = excluded.scene, step = excluded.step, codec = excluded.codec, data_version = excluded.data_version, state = excluded.state, scene_data = excluded.scene_data, meta = excluded.meta, updated_at = NOW()`
 
 	SqlGetSessionQuery = `SELECT * FROM %s WHERE chat_id=$1 AND user_id=$2`
 )
+
+// ErrInvalidIdentifier is returned for table or schema names that are not plain SQL identifiers.
+var ErrInvalidIdentifier = errors.New("invalid sql identifier")
+
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Table is an optionally schema-qualified table name.
+type Table struct {
+	Schema string
+	Name   string
+}
+
+// DefaultTable returns the default sessions table.
+func DefaultTable() Table {
+	return Table{Name: SqlTableName}
+}
+
+// Validate checks that schema and name are plain identifiers, so they are safe to format into queries.
+func (t Table) Validate() error {
+	if !identRe.MatchString(t.Name) {
+		return fmt.Errorf("%w: table %q", ErrInvalidIdentifier, t.Name)
+	}
+	if t.Schema != "" && !identRe.MatchString(t.Schema) {
+		return fmt.Errorf("%w: schema %q", ErrInvalidIdentifier, t.Schema)
+	}
+	return nil
+}
+
+// String returns the qualified table name.
+func (t Table) String() string {
+	if t.Schema == "" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+// Migrations returns the table that records applied migrations of t.
+func (t Table) Migrations() Table {
+	return Table{Schema: t.Schema, Name: t.Name + "_migrations"}
+}
@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"sync"
 
 	"github.com/jmoiron/sqlx"
 
@@ -16,34 +15,82 @@ import (
 
 // Storage .
 type Storage struct {
-	db           *sqlx.DB
-	tableEnsured sync.Once
+	db          *sqlx.DB
+	dialect     pkg.Dialect
+	table       pkg.Table
+	autoMigrate bool
+}
+
+// Option configures Storage.
+type Option func(*Storage)
+
+// WithDialect overrides the SQL dialect detected from the driver name.
+func WithDialect(dialect pkg.Dialect) Option {
+	return func(s *Storage) {
+		if dialect != nil {
+			s.dialect = dialect
+		}
+	}
+}
+
+// WithTable overrides the sessions table name (pkg.SqlTableName by default).
+func WithTable(name string) Option {
+	return func(s *Storage) {
+		s.table.Name = name
+	}
+}
+
+// WithSchema places the sessions table into the given schema.
+// The schema must already exist.
+func WithSchema(schema string) Option {
+	return func(s *Storage) {
+		s.table.Schema = schema
+	}
+}
+
+// WithoutMigrations disables running migrations in NewStorage.
+// Use it when the schema is managed externally; Migrate can still be called explicitly.
+func WithoutMigrations() Option {
+	return func(s *Storage) {
+		s.autoMigrate = false
+	}
 }
 
 // NewStorage .
-func NewStorage(db *sqlx.DB) (*Storage, error) {
-	storage := &Storage{db: db}
+// The SQL dialect is detected from db.DriverName() unless WithDialect is passed.
+func NewStorage(db *sqlx.DB, opts ...Option) (*Storage, error) {
+	storage := &Storage{
+		db:          db,
+		dialect:     pkg.DialectByDriver(db.DriverName()),
+		table:       pkg.DefaultTable(),
+		autoMigrate: true,
+	}
+	for _, opt := range opts {
+		opt(storage)
+	}
 
-	err := storage.ensureTable(context.Background())
-	if err != nil {
+	if err := storage.table.Validate(); err != nil {
 		return nil, err
 	}
 
+	if storage.autoMigrate {
+		err := storage.Migrate(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return storage, nil
 }
 
-func (s *Storage) ensureTable(ctx context.Context) error {
-	var err error
-	s.tableEnsured.Do(func() {
-		query := fmt.Sprintf(pkg.SqlEnsureTableQuery, pkg.SqlTableName)
-		_, err = s.db.ExecContext(ctx, query)
-	})
-	return err
+// Migrate applies pending schema migrations.
+func (s *Storage) Migrate(ctx context.Context) error {
+	return pkg.Migrate(ctx, migrator{db: s.db}, s.dialect, s.table)
 }
 
 // GetSession .
 func (s *Storage) GetSession(ctx context.Context, chatID, userID int64) (*scenario.SessionBase, error) {
-	query := fmt.Sprintf(pkg.SqlGetSessionQuery, pkg.SqlTableName)
+	query := fmt.Sprintf(s.dialect.GetSessionQuery(), s.table)
 
 	var session scenario.SessionBase
 	err := s.db.GetContext(ctx, &session, query, chatID, userID)
@@ -64,9 +111,21 @@ func (s *Storage) SetSession(ctx context.Context, sess *scenario.SessionBase) er
 	if payload == nil {
 		payload = []byte("{}")
 	}
+	codec := sess.Codec
+	if codec == "" {
+		codec = "json"
+	}
+	sceneData := sess.SceneData
+	if sceneData == nil {
+		sceneData = []byte("{}")
+	}
+	meta := sess.Meta
+	if meta == nil {
+		meta = []byte("{}")
+	}
 
-	query := fmt.Sprintf(pkg.SqlUpsertSessionQuery, pkg.SqlTableName)
-	_, err := s.db.ExecContext(ctx, query, sess.ChatID, sess.UserID, payload, sess.Scene, sess.Step)
+	query := fmt.Sprintf(s.dialect.UpsertSessionQuery(), s.table)
+	_, err := s.db.ExecContext(ctx, query, sess.ChatID, sess.UserID, payload, sess.Scene, sess.Step, codec, sess.DataVersion, sess.State, sceneData, meta)
 	if err != nil {
 		slog.ErrorContext(ctx, "failed to upsert session", "error", err)
 		return err
@@ -74,3 +133,55 @@ func (s *Storage) SetSession(ctx context.Context, sess *scenario.SessionBase) er
 
 	return nil
 }
+
+// migrator adapts sqlx to pkg.Migrator.
+type migrator struct {
+	db interface {
+		sqlx.ExecerContext
+		sqlx.QueryerContext
+	}
+}
+
+func (m migrator) Exec(ctx context.Context, query string, args ...any) error {
+	_, err := m.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m migrator) Versions(ctx context.Context, query string) ([]int, error) {
+	var versions []int
+	err := sqlx.SelectContext(ctx, m.db, &versions, query)
+	return versions, err
+}
+
+func (m migrator) Tx(ctx context.Context, fn func(ctx context.Context, m pkg.Migrator) error) error {
+	db, ok := m.db.(interface {
+		BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+	})
+	if !ok {
+		return fn(ctx, m)
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(ctx, migrator{db: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m migrator) Conn(ctx context.Context, fn func(ctx context.Context, m pkg.Migrator) error) error {
+	db, ok := m.db.(*sqlx.DB)
+	if !ok {
+		return fn(ctx, m)
+	}
+
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return fn(ctx, migrator{db: conn})
+}
@@ -0,0 +1,164 @@
+package sqlx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/themgmd/scenario"
+	"github.com/themgmd/scenario/store/pkg"
+)
+
+func newSQLiteDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	// every connection to :memory: opens a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestNewStorageDetectsDialect(t *testing.T) {
+	db := newSQLiteDB(t)
+
+	storage, err := NewStorage(db)
+	require.NoError(t, err)
+	assert.Equal(t, pkg.SQLite, storage.dialect)
+}
+
+func TestStorageSQLiteGetSessionNotFound(t *testing.T) {
+	storage, err := NewStorage(newSQLiteDB(t))
+	require.NoError(t, err)
+
+	sess, err := storage.GetSession(context.Background(), 1, 2)
+	assert.ErrorIs(t, err, scenario.ErrSessionNotFound)
+	assert.Nil(t, sess)
+}
+
+func TestStorageSQLiteSetAndGetSession(t *testing.T) {
+	storage, err := NewStorage(newSQLiteDB(t), WithDialect(pkg.SQLite))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	err = storage.SetSession(ctx, &scenario.SessionBase{
+		ChatID:      100,
+		UserID:      200,
+		Scene:       "register",
+		Step:        1,
+		State:       "awaiting_payment",
+		Data:        []byte(`{"name":"Bob"}`),
+		DataVersion: 2,
+		SceneData:   []byte(`{"order":{"data":{"items":3}}}`),
+		Meta:        []byte(`{"messages":[1,2]}`),
+	})
+	require.NoError(t, err)
+
+	sess, err := storage.GetSession(ctx, 100, 200)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), sess.ChatID)
+	assert.Equal(t, int64(200), sess.UserID)
+	assert.Equal(t, scenario.SceneName("register"), sess.Scene)
+	assert.Equal(t, 1, sess.Step)
+	assert.JSONEq(t, `{"name":"Bob"}`, string(sess.Data))
+	assert.Equal(t, 2, sess.DataVersion)
+	assert.Equal(t, "awaiting_payment", sess.State)
+	assert.JSONEq(t, `{"order":{"data":{"items":3}}}`, string(sess.SceneData))
+	assert.JSONEq(t, `{"messages":[1,2]}`, string(sess.Meta))
+	assert.False(t, sess.UpdatedAt.IsZero())
+
+	// upsert overwrites existing row
+	err = storage.SetSession(ctx, &scenario.SessionBase{
+		ChatID: 100,
+		UserID: 200,
+		Step:   -1,
+	})
+	require.NoError(t, err)
+
+	sess, err = storage.GetSession(ctx, 100, 200)
+	require.NoError(t, err)
+	assert.Equal(t, scenario.SceneName(""), sess.Scene)
+	assert.Equal(t, -1, sess.Step)
+	assert.JSONEq(t, `{}`, string(sess.Data))
+	assert.JSONEq(t, `{}`, string(sess.SceneData))
+}
+
+func TestStorageCustomTableAndSchema(t *testing.T) {
+	db := newSQLiteDB(t)
+
+	storage, err := NewStorage(db, WithSchema("main"), WithTable("bot_sessions"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	err = storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Scene: "s"})
+	require.NoError(t, err)
+
+	var count int
+	require.NoError(t, db.Get(&count, `SELECT COUNT(*) FROM main.bot_sessions`))
+	assert.Equal(t, 1, count)
+
+	var versions []int
+	require.NoError(t, db.Select(&versions, `SELECT version FROM main.bot_sessions_migrations`))
+	assert.Len(t, versions, len(pkg.SQLite.Migrations()))
+}
+
+func TestStorageInvalidTableName(t *testing.T) {
+	_, err := NewStorage(newSQLiteDB(t), WithTable("sessions; DROP TABLE users"))
+	assert.ErrorIs(t, err, pkg.ErrInvalidIdentifier)
+}
+
+func TestStorageMigrationsAreIdempotent(t *testing.T) {
+	db := newSQLiteDB(t)
+
+	storage, err := NewStorage(db)
+	require.NoError(t, err)
+	require.NoError(t, storage.Migrate(context.Background()))
+
+	_, err = NewStorage(db)
+	require.NoError(t, err)
+
+	var count int
+	require.NoError(t, db.Get(&count, `SELECT COUNT(*) FROM telegram_scene_sessions_migrations`))
+	assert.Equal(t, len(pkg.SQLite.Migrations()), count)
+}
+
+func TestStorageWithoutMigrations(t *testing.T) {
+	db := newSQLiteDB(t)
+
+	storage, err := NewStorage(db, WithoutMigrations())
+	require.NoError(t, err)
+
+	// table is not created
+	_, err = storage.GetSession(context.Background(), 1, 2)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, scenario.ErrSessionNotFound)
+
+	require.NoError(t, storage.Migrate(context.Background()))
+	_, err = storage.GetSession(context.Background(), 1, 2)
+	assert.ErrorIs(t, err, scenario.ErrSessionNotFound)
+}
+
+func TestStorageSQLiteCodec(t *testing.T) {
+	storage, err := NewStorage(newSQLiteDB(t))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	err = storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 2, Data: []byte(`"gqRuYW1lo0JvYg=="`), Codec: "msgpack"})
+	require.NoError(t, err)
+
+	sess, err := storage.GetSession(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "msgpack", sess.Codec)
+
+	err = storage.SetSession(ctx, &scenario.SessionBase{ChatID: 1, UserID: 3})
+	require.NoError(t, err)
+
+	sess, err = storage.GetSession(ctx, 1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "json", sess.Codec)
+}
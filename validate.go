@@ -0,0 +1,106 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+var (
+	ErrDuplicateScene = errors.New("duplicate scene")
+	ErrInvalidScene   = errors.New("invalid scene")
+)
+
+// ReasonOrphaned is recorded when a session of an unregistered scene is reset.
+const ReasonOrphaned = "orphaned"
+
+// OrphanPolicy defines what Middleware does with a stored scene that is no longer registered.
+type OrphanPolicy int
+
+const (
+	// OrphanIgnore passes the update to next handlers and keeps the session as is.
+	OrphanIgnore OrphanPolicy = iota
+	// OrphanReset clears the scene and its data, then passes the update to next handlers.
+	OrphanReset
+	// OrphanFail returns ErrSceneNotFound from the middleware.
+	OrphanFail
+)
+
+// ValidatingScene is implemented by scenes that can check their own configuration.
+type ValidatingScene interface {
+	Scene
+	Validate() error
+}
+
+// WithStrict makes entering an unregistered scene return ErrSceneNotFound
+// instead of being silently ignored.
+func (s *Scenario) WithStrict(strict bool) *Scenario {
+	s.strict = strict
+	return s
+}
+
+// WithOrphanPolicy sets what happens to sessions whose stored scene is no longer registered.
+func (s *Scenario) WithOrphanPolicy(policy OrphanPolicy) *Scenario {
+	s.orphanPolicy = policy
+	return s
+}
+
+// Validate checks registered scenes for duplicate or empty names, scene configuration, data upgrades with GobCodec,
+// deep link patterns and declared transitions to unknown scenes. Call it at startup, all problems are joined.
+func (s *Scenario) Validate() error {
+	var errs []error
+
+	s.mu.RLock()
+	errs = append(errs, s.linkErrs...)
+	duplicates := append([]SceneName(nil), s.duplicates...)
+	s.mu.RUnlock()
+
+	for _, name := range duplicates {
+		errs = append(errs, fmt.Errorf("%w: %q registered more than once", ErrDuplicateScene, name))
+	}
+
+	g := s.Graph()
+	for _, node := range g.Nodes {
+		sc, _ := s.scene(node.Scene)
+		if node.Scene == "" {
+			errs = append(errs, fmt.Errorf("%w: empty scene name", ErrInvalidScene))
+		}
+		if vs, ok := sc.(ValidatingScene); ok {
+			if err := vs.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("scene %q: %w", node.Scene, err))
+			}
+		}
+		if vs, ok := sc.(VersionedScene); ok && s.codecs.current.Name() == GobCodec.Name() && vs.DataSchema().hasUpgrades(0) {
+			errs = append(errs, fmt.Errorf("%w: scene %q has data upgrades, %s data can't be upgraded", ErrInvalidScene, node.Scene, GobCodec.Name()))
+		}
+	}
+
+	for _, e := range g.Edges {
+		if _, ok := s.scene(e.From); e.From != "" && !ok {
+			errs = append(errs, fmt.Errorf("%w: transition from %q", ErrSceneNotFound, e.From))
+		}
+		if _, ok := s.scene(e.To); !ok {
+			errs = append(errs, fmt.Errorf("%w: transition from %q to %q", ErrSceneNotFound, e.From, e.To))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// handleOrphan applies the orphan policy to a session of an unregistered scene.
+func (s *Scenario) handleOrphan(ctx context.Context, c tele.Context, base *SessionBase, next tele.HandlerFunc) error {
+	switch s.orphanPolicy {
+	case OrphanFail:
+		return fmt.Errorf("%w: stored scene %q", ErrSceneNotFound, base.Scene)
+	case OrphanReset:
+		scene, step := base.Scene, base.Step
+		base.Scene, base.Step, base.Data, base.DataVersion = "", -1, nil, 0
+		if err := s.store.SetSession(ctx, base); err != nil {
+			return fmt.Errorf("store.SetSession: %w", err)
+		}
+		s.record(ctx, base, scene, step, base.Step, ReasonOrphaned)
+	}
+	return next(c)
+}
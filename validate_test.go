@@ -0,0 +1,101 @@
+package scenario
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestScenarioValidate(t *testing.T) {
+	type Data struct{}
+	step := func(c *Context[Data]) (bool, error) { return true, nil }
+
+	t.Run("valid", func(t *testing.T) {
+		scenario := New(nil)
+		scenario.Use(NewWizard[Data]("register", step, step).DeclareBranch(1, 0, "edit").DeclareEnter(1, "menu", "done"))
+		scenario.Use(NewWizard[Data]("menu", step))
+		scenario.Declare("", "register", "/start")
+		require.NoError(t, scenario.Validate())
+	})
+
+	t.Run("problems", func(t *testing.T) {
+		scenario := New(nil)
+		scenario.Use(NewWizard[Data]("register", step).DeclareEnter(0, "profle", "typo"))
+		scenario.Use(NewWizard[Data]("register", step, step).DeclareBranch(1, 5, "edit"))
+		scenario.Use(NewWizard[Data]("empty"))
+		scenario.Declare("", "missing", "/missing")
+
+		err := scenario.Validate()
+		assert.ErrorIs(t, err, ErrDuplicateScene)
+		assert.ErrorIs(t, err, ErrInvalidScene)
+		assert.ErrorIs(t, err, ErrSceneNotFound)
+		assert.Contains(t, err.Error(), `"missing"`)
+		assert.Contains(t, err.Error(), `scene "empty": invalid scene: wizard has no steps`)
+		assert.Contains(t, err.Error(), "unknown step 5")
+		assert.NotContains(t, err.Error(), "profle") // replaced by the duplicate
+	})
+}
+
+func TestScenarioStrictEnter(t *testing.T) {
+	type Data struct{}
+
+	scenario := New(nil)
+	sceneCtx, err := NewContext[Data](scenario, newSchemaMockCtx(t))
+	require.NoError(t, err)
+	assert.NoError(t, sceneCtx.Enter("unknown"))
+
+	scenario.WithStrict(true)
+	assert.ErrorIs(t, sceneCtx.Enter("unknown"), ErrSceneNotFound)
+}
+
+func TestScenarioMiddlewareOrphanPolicies(t *testing.T) {
+	run := func(t *testing.T, policy OrphanPolicy) (*Scenario, bool, error) {
+		scenario := New(nil).WithOrphanPolicy(policy).WithHistory(NewMemoryHistory(), false)
+		orphan := &SessionBase{ChatID: 2, UserID: 1, Scene: "removed", Step: 3, Data: []byte(`{"a":1}`)}
+		require.NoError(t, scenario.store.SetSession(context.Background(), orphan))
+
+		called := false
+		err := scenario.Middleware(func(tele.Context) error {
+			called = true
+			return nil
+		})(newSchemaMockCtx(t))
+		return scenario, called, err
+	}
+
+	t.Run("ignore", func(t *testing.T) {
+		scenario, called, err := run(t, OrphanIgnore)
+		require.NoError(t, err)
+		assert.True(t, called)
+
+		base, err := scenario.store.GetSession(context.Background(), 2, 1)
+		require.NoError(t, err)
+		assert.Equal(t, SceneName("removed"), base.Scene)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		scenario, called, err := run(t, OrphanReset)
+		require.NoError(t, err)
+		assert.True(t, called)
+
+		base, err := scenario.store.GetSession(context.Background(), 2, 1)
+		require.NoError(t, err)
+		assert.Equal(t, SceneName(""), base.Scene)
+		assert.Equal(t, -1, base.Step)
+		assert.Empty(t, base.Data)
+
+		timeline, err := scenario.history.Timeline(context.Background(), HistoryQuery{ChatID: 2, UserID: 1})
+		require.NoError(t, err)
+		require.Len(t, timeline, 1)
+		assert.Equal(t, ReasonOrphaned, timeline[0].Reason)
+		assert.Equal(t, SceneName("removed"), timeline[0].Scene)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		_, called, err := run(t, OrphanFail)
+		assert.ErrorIs(t, err, ErrSceneNotFound)
+		assert.False(t, called)
+	})
+}
@@ -1,8 +1,10 @@
 package scenario
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	tele "gopkg.in/telebot.v3"
 )
@@ -14,8 +16,19 @@ type WizardStep[T any] func(*Context[T]) (advance bool, err error)
 // WizardScene is a scene that manages a sequence of steps (wizard pattern).
 // T is the type of data stored in the session.
 type WizardScene[T any] struct {
-	name  SceneName
-	steps []WizardStep[T]
+	name   SceneName
+	steps  []WizardStep[T]
+	schema DataSchema
+
+	stepNames []string
+	edges     []Edge
+	onEnter   func(*Context[T]) error
+
+	idleAfter  time.Duration
+	idleText   string
+	dataPolicy DataPolicy
+	cleanup    *CleanupPolicy
+	rateLimit  *RateLimit
 }
 
 // NewWizard creates a new wizard scene with typed steps.
@@ -27,9 +40,133 @@ func NewWizard[T any](name SceneName, steps ...WizardStep[T]) *WizardScene[T] {
 // Name returns the scene name.
 func (w *WizardScene[T]) Name() SceneName { return w.name }
 
+// WithDataVersion sets the schema version of T.
+// Stored data of older versions is upgraded with functions registered by WithUpgrade.
+func (w *WizardScene[T]) WithDataVersion(version int) *WizardScene[T] {
+	w.schema.setVersion(version)
+	return w
+}
+
+// WithUpgrade registers a function that upgrades data of version from to version from+1.
+func (w *WizardScene[T]) WithUpgrade(from int, fn UpgradeFunc) *WizardScene[T] {
+	w.schema.addUpgrade(from, fn)
+	return w
+}
+
+// OnDecodeError sets what happens when stored data can't be decoded into T.
+// message is sent to the user with DecodeNotify.
+func (w *WizardScene[T]) OnDecodeError(policy DecodePolicy, message string) *WizardScene[T] {
+	w.schema.setPolicy(policy, message)
+	return w
+}
+
+// WithOnEnter sets a function called when the wizard is entered, before the first step.
+func (w *WizardScene[T]) WithOnEnter(fn func(*Context[T]) error) *WizardScene[T] {
+	w.onEnter = fn
+	return w
+}
+
+// WithDataPolicy sets what happens to session data when the user leaves the scene.
+func (w *WizardScene[T]) WithDataPolicy(policy DataPolicy) *WizardScene[T] {
+	w.dataPolicy = policy
+	return w
+}
+
+// DataPolicy returns the policy set by WithDataPolicy.
+func (w *WizardScene[T]) DataPolicy() DataPolicy { return w.dataPolicy }
+
+// WithCleanup sets which messages of the scene are removed when the user leaves it.
+func (w *WizardScene[T]) WithCleanup(policy CleanupPolicy) *WizardScene[T] {
+	w.cleanup = &policy
+	return w
+}
+
+// CleanupPolicy returns the policy set by WithCleanup.
+func (w *WizardScene[T]) CleanupPolicy() *CleanupPolicy { return w.cleanup }
+
+// WithRateLimit limits updates in the scene on top of the rate limit of the scenario.
+func (w *WizardScene[T]) WithRateLimit(limit RateLimit) *WizardScene[T] {
+	w.rateLimit = &limit
+	return w
+}
+
+// RateLimit returns the limit set by WithRateLimit.
+func (w *WizardScene[T]) RateLimit() *RateLimit { return w.rateLimit }
+
+// WithIdleReminder sends text to users inactive in the wizard for after.
+// {step} in text is replaced with the 1-based current step. Requires Scenario.WithScheduler.
+func (w *WizardScene[T]) WithIdleReminder(after time.Duration, text string) *WizardScene[T] {
+	w.idleAfter, w.idleText = after, text
+	return w
+}
+
+// IdleReminder returns the reminder set by WithIdleReminder.
+func (w *WizardScene[T]) IdleReminder() (time.Duration, string) {
+	return w.idleAfter, w.idleText
+}
+
+// WithStepNames names wizard steps in order, e.g. for the scene graph.
+func (w *WizardScene[T]) WithStepNames(names ...string) *WizardScene[T] {
+	w.stepNames = names
+	return w
+}
+
+// DeclareEnter declares that step may enter another scene.
+func (w *WizardScene[T]) DeclareEnter(step int, to SceneName, label string) *WizardScene[T] {
+	w.edges = append(w.edges, Edge{From: w.name, FromStep: step, To: to, ToStep: NoStep, Label: label})
+	return w
+}
+
+// DeclareBranch declares a jump between steps besides advancing to the next one.
+func (w *WizardScene[T]) DeclareBranch(from, to int, label string) *WizardScene[T] {
+	w.edges = append(w.edges, Edge{From: w.name, FromStep: from, To: w.name, ToStep: to, Label: label})
+	return w
+}
+
+// Steps returns step names, unnamed steps are empty.
+func (w *WizardScene[T]) Steps() []string {
+	names := make([]string, len(w.steps))
+	copy(names, w.stepNames)
+	return names
+}
+
+// Transitions returns advances between consecutive steps and declared transitions.
+func (w *WizardScene[T]) Transitions() []Edge {
+	edges := make([]Edge, 0, len(w.steps)+len(w.edges))
+	for i := 0; i+1 < len(w.steps); i++ {
+		edges = append(edges, Edge{From: w.name, FromStep: i, To: w.name, ToStep: i + 1})
+	}
+	return append(edges, w.edges...)
+}
+
+// Validate checks that the wizard has steps and its declarations refer to existing steps.
+func (w *WizardScene[T]) Validate() error {
+	var errs []error
+	if len(w.steps) == 0 {
+		errs = append(errs, fmt.Errorf("%w: wizard has no steps", ErrInvalidScene))
+	}
+	if len(w.stepNames) > len(w.steps) {
+		errs = append(errs, fmt.Errorf("%w: %d step names for %d steps", ErrInvalidScene, len(w.stepNames), len(w.steps)))
+	}
+	for _, e := range w.edges {
+		step := e.FromStep
+		if step >= 0 && step < len(w.steps) && e.To == w.name {
+			step = e.ToStep
+		}
+		if step < 0 || step >= len(w.steps) {
+			errs = append(errs, fmt.Errorf("%w: transition to %q refers to unknown step %d", ErrInvalidScene, e.To, step))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DataSchema returns the data schema of the wizard.
+func (w *WizardScene[T]) DataSchema() *DataSchema { return &w.schema }
+
 // CreateContext creates a typed Context[T] from SessionBase.
+// Data of older schema versions is upgraded before decoding.
 func (w *WizardScene[T]) CreateContext(scenario *Scenario, c tele.Context, base *SessionBase) (ContextBase, error) {
-	sess, err := fromBase[T](base)
+	sess, err := decodeSession[T](scenario.codecs, base, &w.schema)
 	if err != nil {
 		return nil, fmt.Errorf("fromBase[%T]: %w", *new(T), err)
 	}
@@ -44,6 +181,9 @@ func (w *WizardScene[T]) Enter(c ContextBase) error {
 	}
 	ctx.Session.Step = 0
 	ctx.markDirty()
+	if w.onEnter != nil {
+		return w.onEnter(ctx)
+	}
 	return nil
 }
 
@@ -63,7 +203,7 @@ func (w *WizardScene[T]) OnUpdate(c ContextBase) error {
 	if m := ctx.Message(); m != nil {
 		if strings.EqualFold(m.Text, "/cancel") {
 			_ = ctx.Reply("Отменено")
-			return ctx.Leave()
+			return ctx.Scenario.leave(ctx, ReasonCancel)
 		}
 	}
 
@@ -74,7 +214,7 @@ func (w *WizardScene[T]) OnUpdate(c ContextBase) error {
 	if advance {
 		idx++
 		if idx >= len(w.steps) {
-			return ctx.Leave()
+			return ctx.Scenario.leave(ctx, ReasonCompleted)
 		}
 		// Update step directly without conversion
 		ctx.Session.Step = idx